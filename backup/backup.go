@@ -0,0 +1,179 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/cihub/seelog"
+	"github.com/pkg/errors"
+
+	"blog/helpers"
+	"blog/models"
+	"blog/storage"
+	"blog/system"
+)
+
+const (
+	DefaultDir = "backups"  // 本地备份目录
+	keyPrefix  = "backups/" // 远程存储中备份文件的前缀
+)
+
+// 同一时间只执行一个备份
+var mutex sync.Mutex
+
+// 配置的备份目的地，默认只保存到本地
+func Destinations() []string {
+	destinations := system.GetConfiguration().BackupDestinations
+	if len(destinations) == 0 {
+		return []string{storage.DriverLocal}
+	}
+	return destinations
+}
+
+// 可用的备份目的地；smms是图床，只接受图片且不能按标识下载，不能保存备份
+var destinationDrivers = []string{storage.DriverLocal, storage.DriverS3, storage.DriverQiniu}
+
+// CheckDestinations 检查配置的备份目的地，启动时调用，避免到备份时才发现无法保存
+func CheckDestinations() error {
+	for _, name := range Destinations() {
+		if !isDestination(name) {
+			return errors.Errorf("invalid backup destination %s, only %s are supported", name, strings.Join(destinationDrivers, ", "))
+		}
+	}
+	return nil
+}
+
+func isDestination(name string) bool {
+	for _, driver := range destinationDrivers {
+		if name == driver {
+			return true
+		}
+	}
+	return false
+}
+
+// 备份目的地，local为本地备份目录，其他复用上传文件的存储驱动
+func NewDestination(name string) (storage.Storage, error) {
+	if !isDestination(name) {
+		return nil, errors.Errorf("invalid backup destination %s", name)
+	}
+	if name == storage.DriverLocal {
+		dir := system.GetConfiguration().BackupDir
+		if dir == "" {
+			dir = DefaultDir
+		}
+		return &storage.LocalStorage{Dir: dir}, nil
+	}
+	return storage.NewStorage(name)
+}
+
+// 备份文件在目的地中的标识
+func Key(destination, fileName string) string {
+	if destination == storage.DriverLocal {
+		return fileName
+	}
+	return keyPrefix + fileName
+}
+
+// Run 备份数据库到所有目的地，记录每个目的地的结果，并按保留策略清理旧备份
+func Run() error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	fileName := fmt.Sprintf("wblog_%s%s", helpers.GetCurrentTime().Format("20060102150405"), extension())
+	path, size, err := encryptedSnapshot()
+	if path != "" {
+		defer os.RemoveAll(filepath.Dir(path))
+	}
+	var failed []string
+	for _, destination := range Destinations() {
+		record := &models.Backup{
+			FileName:    fileName,
+			Destination: destination,
+			Size:        size,
+			Status:      models.BackupStatusSuccess,
+		}
+		putErr := err
+		if putErr == nil {
+			putErr = put(destination, fileName, path, size)
+		}
+		if putErr != nil {
+			record.Status = models.BackupStatusFailed
+			record.Message = putErr.Error()
+			failed = append(failed, destination+": "+putErr.Error())
+		}
+		if err := record.Insert(); err != nil {
+			seelog.Error("[Run]insert backup err", err)
+		}
+		if putErr == nil {
+			if err := Prune(destination); err != nil {
+				seelog.Errorf("[Run]prune backups of %s err %v", destination, err)
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return errors.New(strings.Join(failed, "; "))
+	}
+	seelog.Infof("[Run]backup %s successfully", fileName)
+	return nil
+}
+
+func put(destination, fileName, path string, size int64) error {
+	store, err := NewDestination(destination)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = store.Put(Key(destination, fileName), file, size, "application/octet-stream")
+	return err
+}
+
+// 生成快照并流式加密到同一临时目录中，返回加密文件的路径和大小
+func encryptedSnapshot() (string, int64, error) {
+	path, err := snapshot()
+	if err != nil {
+		return "", 0, err
+	}
+	encryptedPath := path + ".enc"
+	err = encryptFile(path, encryptedPath, system.GetConfiguration().BackupKey)
+	if err != nil {
+		return path, 0, err
+	}
+	info, err := os.Stat(encryptedPath)
+	if err != nil {
+		return path, 0, err
+	}
+	return encryptedPath, info.Size(), nil
+}
+
+func encryptFile(src, dst, passphrase string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w, err := helpers.NewEncryptWriter(out, passphrase)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(w, in); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,38 @@
+package backup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"blog/system"
+)
+
+func TestCheckDestinations(t *testing.T) {
+	tests := []struct {
+		destinations string
+		valid        bool
+	}{
+		{"[]", true},
+		{"[local]", true},
+		{"[local, s3, qiniu]", true},
+		{"[local, smms]", false},
+		{"[ftp]", false},
+	}
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "conf.yaml")
+		if err := ioutil.WriteFile(path, []byte(fmt.Sprintf("backup_destinations: %s\n", test.destinations)), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := system.LoadConfiguration(path); err != nil {
+			t.Fatal(err)
+		}
+		if err := CheckDestinations(); (err == nil) != test.valid {
+			t.Errorf("%s: err = %v, want valid %v", test.destinations, err, test.valid)
+		}
+	}
+	if _, err := NewDestination("smms"); err == nil {
+		t.Error("smms was accepted as a backup destination")
+	}
+}
@@ -0,0 +1,189 @@
+package backup
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"blog/models"
+	"blog/system"
+)
+
+const (
+	defaultMysqldump = "mysqldump"
+	defaultPgDump    = "pg_dump"
+)
+
+var (
+	// go-sql-driver/mysql格式的dsn，[user[:password]@][protocol[(address)]]/dbname[?params]，
+	// 如user:password@tcp(127.0.0.1:3306)/blog?charset=utf8、tcp(db:3306)/blog、/blog
+	mysqlDsnRegexp = regexp.MustCompile(`^(?:([^:@/]*)(?::(.*))?@)?(?:(\w+)(?:\(([^)]*)\))?)?/([^?]+)`)
+	// lib/pq关键字格式dsn中的密码，如host=localhost password='secret' dbname=blog
+	pgPasswordRegexp = regexp.MustCompile(`password=('(?:[^'\\]|\\.)*'|\S*)`)
+)
+
+// 备份文件的扩展名，mysql和postgres为逻辑备份
+func extension() string {
+	if models.Driver() == models.DriverSqlite {
+		return ".db"
+	}
+	return ".sql"
+}
+
+// 在临时目录中生成数据库的一致性快照，返回快照路径，调用方负责删除
+func snapshot() (string, error) {
+	dsn := system.GetConfiguration().DSN
+	dir, err := ioutil.TempDir("", "backup")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "snapshot"+extension())
+	switch models.Driver() {
+	case models.DriverMysql:
+		err = mysqldump(dsn, path)
+	case models.DriverPostgres:
+		err = pgDump(dsn, path)
+	default:
+		err = sqliteSnapshot(path)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return path, nil
+}
+
+// 使用VACUUM INTO在不阻塞写入的情况下生成快照，并检查快照的完整性
+func sqliteSnapshot(path string) error {
+	if err := models.DB.Exec("VACUUM INTO ?", path).Error; err != nil {
+		return errors.Wrap(err, "vacuum into")
+	}
+	return IntegrityCheck(path)
+}
+
+// IntegrityCheck 对sqlite数据库文件执行PRAGMA integrity_check
+func IntegrityCheck(path string) error {
+	db, err := sql.Open(models.DriverSqlite, "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	rows, err := db.Query("PRAGMA integrity_check")
+	if err != nil {
+		return errors.Wrap(err, "integrity check")
+	}
+	defer rows.Close()
+	var problems []string
+	for rows.Next() {
+		var result string
+		if err = rows.Scan(&result); err != nil {
+			return err
+		}
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return errors.Errorf("integrity check failed: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// 调用mysqldump导出逻辑备份，密码通过环境变量传递，避免出现在进程参数中
+func mysqldump(dsn, path string) error {
+	args, password, err := mysqldumpArgs(dsn, path)
+	if err != nil {
+		return err
+	}
+	command := system.GetConfiguration().Mysqldump
+	if command == "" {
+		command = defaultMysqldump
+	}
+	cmd := exec.Command(command, args...)
+	cmd.Env = append(os.Environ(), "MYSQL_PWD="+password)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return errors.Wrapf(err, "mysqldump: %s", out)
+	}
+	return nil
+}
+
+// 由dsn生成mysqldump的参数，密码单独返回
+func mysqldumpArgs(dsn, path string) ([]string, string, error) {
+	match := mysqlDsnRegexp.FindStringSubmatch(dsn)
+	if match == nil {
+		return nil, "", errors.New("mysqldump: unrecognized dsn, expected [user[:password]@][protocol[(address)]]/dbname")
+	}
+	user, password, protocol, address, database := match[1], match[2], match[3], match[4], match[5]
+	args := []string{"--single-transaction", "--routines", "--triggers", "--result-file=" + path}
+	if user != "" {
+		args = append(args, "--user="+user)
+	}
+	switch protocol {
+	case "unix":
+		args = append(args, "--socket="+address)
+	default:
+		if address != "" {
+			host := address
+			if index := strings.LastIndex(address, ":"); index >= 0 {
+				host = address[:index]
+				args = append(args, "--port="+address[index+1:])
+			}
+			args = append(args, "--host="+host, "--protocol=tcp")
+		}
+	}
+	return append(args, database), password, nil
+}
+
+// 调用pg_dump导出逻辑备份，密码从dsn中移除后通过PGPASSWORD传递
+func pgDump(dsn, path string) error {
+	args, password, err := pgDumpArgs(dsn, path)
+	if err != nil {
+		return err
+	}
+	command := system.GetConfiguration().PgDump
+	if command == "" {
+		command = defaultPgDump
+	}
+	cmd := exec.Command(command, args...)
+	cmd.Env = os.Environ()
+	if password != "" {
+		cmd.Env = append(cmd.Env, "PGPASSWORD="+password)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return errors.Wrapf(err, "pg_dump: %s", out)
+	}
+	return nil
+}
+
+// 由dsn生成pg_dump的参数，支持URL和关键字两种格式，密码单独返回
+func pgDumpArgs(dsn, path string) ([]string, string, error) {
+	var password string
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return nil, "", errors.Wrap(err, "parse dsn")
+		}
+		if u.User != nil {
+			password, _ = u.User.Password()
+			u.User = url.User(u.User.Username())
+		}
+		dsn = u.String()
+	} else if match := pgPasswordRegexp.FindStringSubmatch(dsn); match != nil {
+		password = match[1]
+		if strings.HasPrefix(password, "'") {
+			password = strings.NewReplacer(`\'`, "'", `\\`, `\`).Replace(password[1 : len(password)-1])
+		}
+		dsn = strings.TrimSpace(pgPasswordRegexp.ReplaceAllString(dsn, ""))
+	}
+	return []string{"--no-owner", "--file=" + path, "--dbname=" + dsn}, password, nil
+}
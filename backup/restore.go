@@ -0,0 +1,237 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cihub/seelog"
+	"github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+
+	"blog/helpers"
+	"blog/models"
+	"blog/system"
+)
+
+// 恢复的数据库中必须存在的表
+var requiredTables = []string{"posts", "pages", "tags", "post_tags", "users", "comments"}
+
+// 已下载并校验、等待确认的恢复
+type Restore struct {
+	Token    string         `json:"token"`
+	Backup   *models.Backup `json:"backup"`
+	Posts    int            `json:"posts"`
+	Pages    int            `json:"pages"`
+	Tags     int            `json:"tags"`
+	Comments int            `json:"comments"`
+	Users    int            `json:"users"`
+	path     string         // 解密后的数据库，确认后写入当前数据库
+}
+
+var (
+	pending      *Restore
+	pendingMutex sync.Mutex
+)
+
+// sqlite dsn中的数据库文件路径
+func sqlitePath(dsn string) string {
+	path := strings.TrimPrefix(dsn, "file:")
+	if index := strings.Index(path, "?"); index >= 0 {
+		path = path[:index]
+	}
+	return path
+}
+
+// PrepareRestore 下载并解密备份，校验完整性和表结构，统计数据供确认
+func PrepareRestore(backupId uint) (*Restore, error) {
+	dsn := system.GetConfiguration().DSN
+	if models.Driver() != models.DriverSqlite {
+		return nil, errors.New("online restore only supports sqlite, import the sql dump with the mysql or psql client")
+	}
+	record, err := models.GetBackupById(backupId)
+	if err != nil {
+		return nil, err
+	}
+	if record.Status != models.BackupStatusSuccess {
+		return nil, errors.New("backup is not successful")
+	}
+	store, err := NewDestination(record.Destination)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := store.Get(Key(record.Destination, record.FileName))
+	if err != nil {
+		return nil, errors.Wrap(err, "download backup")
+	}
+	defer reader.Close()
+
+	file, err := ioutil.TempFile(filepath.Dir(sqlitePath(dsn)), ".restore-*.db")
+	if err != nil {
+		return nil, err
+	}
+	restore := &Restore{
+		Token:  helpers.UUID(),
+		Backup: record,
+		path:   file.Name(),
+	}
+	err = decryptTo(file, reader)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = restore.validate()
+	}
+	if err != nil {
+		os.Remove(restore.path)
+		return nil, err
+	}
+
+	pendingMutex.Lock()
+	defer pendingMutex.Unlock()
+	if pending != nil {
+		os.Remove(pending.path)
+	}
+	pending = restore
+	return restore, nil
+}
+
+func decryptTo(w io.Writer, r io.Reader) error {
+	plain, err := helpers.NewDecryptReader(r, system.GetConfiguration().BackupKey)
+	if err != nil {
+		return errors.Wrap(err, "decrypt backup")
+	}
+	if _, err = io.Copy(w, plain); err != nil {
+		return errors.Wrap(err, "decrypt backup")
+	}
+	return nil
+}
+
+// 检查完整性和必需的表，并统计各表的行数
+func (restore *Restore) validate() error {
+	if err := IntegrityCheck(restore.path); err != nil {
+		return err
+	}
+	db, err := sql.Open(models.DriverSqlite, "file:"+restore.path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	for _, table := range requiredTables {
+		var name string
+		err = db.QueryRow("select name from sqlite_master where type = 'table' and name = ?", table).Scan(&name)
+		if err == sql.ErrNoRows {
+			return errors.Errorf("table %s not found in backup", table)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	counts := map[string]*int{
+		"posts":    &restore.Posts,
+		"pages":    &restore.Pages,
+		"tags":     &restore.Tags,
+		"comments": &restore.Comments,
+		"users":    &restore.Users,
+	}
+	for table, count := range counts {
+		if err = db.QueryRow("select count(*) from " + table).Scan(count); err != nil {
+			return errors.Wrapf(err, "count %s", table)
+		}
+	}
+	return nil
+}
+
+// ConfirmRestore 通过sqlite的在线备份接口把已校验的备份写入当前数据库，原数据库保留为.pre-restore。
+// 写入在同一个连接池中完成，models.DB不变，也不替换数据库文件，不会与-wal、-shm文件不一致；
+// 写入期间数据库被锁定，其他请求等待写入完成
+func ConfirmRestore(token string) error {
+	pendingMutex.Lock()
+	defer pendingMutex.Unlock()
+	if pending == nil || pending.Token != token {
+		return errors.New("restore expired, please prepare it again")
+	}
+	restore := pending
+	pending = nil
+	defer os.Remove(restore.path)
+
+	// 替换期间不允许备份
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	// VACUUM INTO包括还在-wal中未写回数据库文件的内容，直接复制数据库文件会丢失这些内容
+	previous := sqlitePath(system.GetConfiguration().DSN) + ".pre-restore"
+	os.Remove(previous)
+	if err := sqliteSnapshot(previous); err != nil {
+		return errors.Wrap(err, "keep current database")
+	}
+	if err := restoreInto(restore.path); err != nil {
+		return errors.Wrap(err, "restore database")
+	}
+	// 较早的备份可能缺少之后的结构变更
+	if err := models.MigrateOnStartup(); err != nil {
+		seelog.Error("[ConfirmRestore]migrate restored database err", err)
+	}
+	seelog.Infof("[ConfirmRestore]restored database from %s", restore.Backup.FileName)
+	return nil
+}
+
+// 等待其他连接释放锁的最长时间
+const restoreBusyTimeout = 30 * time.Second
+
+// 用path中的数据库替换models.DB的全部内容，一次写入全部页面，失败时当前数据库不变
+func restoreInto(path string) error {
+	ctx := context.Background()
+	source, err := sql.Open(models.DriverSqlite, "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	sourceConn, err := source.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer sourceConn.Close()
+	destConn, err := models.DB.DB().Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+
+	return destConn.Raw(func(dest interface{}) error {
+		return sourceConn.Raw(func(src interface{}) error {
+			destSqlite, ok := dest.(*sqlite3.SQLiteConn)
+			srcSqlite, ok2 := src.(*sqlite3.SQLiteConn)
+			if !ok || !ok2 {
+				return errors.New("online restore only supports sqlite")
+			}
+			backup, err := destSqlite.Backup("main", srcSqlite, "main")
+			if err != nil {
+				return err
+			}
+			// 其他连接持有锁时Step返回未完成且没有错误，稍后重试
+			deadline := time.Now().Add(restoreBusyTimeout)
+			for {
+				done, err := backup.Step(-1)
+				if err != nil {
+					backup.Finish()
+					return err
+				}
+				if done {
+					return backup.Finish()
+				}
+				if time.Now().After(deadline) {
+					backup.Finish()
+					return errors.New("database is busy")
+				}
+				time.Sleep(100 * time.Millisecond)
+			}
+		})
+	})
+}
@@ -0,0 +1,99 @@
+package backup
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"blog/models"
+	"blog/models/testdb"
+	"blog/system"
+)
+
+// 恢复写入当前连接池，models.DB不变，并发的查询不受影响；原数据库保留为.pre-restore
+func TestConfirmRestore(t *testing.T) {
+	db := testdb.Open(t)
+	if models.Driver() != models.DriverSqlite {
+		t.Skip("online restore only supports sqlite")
+	}
+	kept := &models.Post{Title: "kept", IsPublished: true}
+	if err := kept.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "restore.db")
+	if err := sqliteSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+	discarded := &models.Post{Title: "discarded", IsPublished: true}
+	if err := discarded.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	pending = &Restore{Token: "token", Backup: &models.Backup{FileName: "restore.db"}, path: path}
+
+	if err := ConfirmRestore("other"); err == nil {
+		t.Error("restore with a wrong token succeeded")
+	}
+	var (
+		wg     sync.WaitGroup
+		errs   = make(chan error, 1)
+		stop   = make(chan struct{})
+		count  int
+		titles []string
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err := models.DB.Model(&models.Post{}).Count(&count).Error; err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+	err := ConfirmRestore("token")
+	close(stop)
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err = <-errs:
+		t.Errorf("query during restore: %v", err)
+	default:
+	}
+
+	if models.DB != db {
+		t.Error("models.DB was replaced")
+	}
+	if err = models.DB.Model(&models.Post{}).Order("id").Pluck("title", &titles).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(titles) != 1 || titles[0] != kept.Title {
+		t.Errorf("posts after restore = %v, want [kept]", titles)
+	}
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("restored file was not removed: %v", err)
+	}
+	if err = ConfirmRestore("token"); err == nil {
+		t.Error("confirming the same restore twice succeeded")
+	}
+
+	previous, err := sql.Open(models.DriverSqlite, "file:"+sqlitePath(system.GetConfiguration().DSN)+".pre-restore?mode=ro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer previous.Close()
+	if err = previous.QueryRow("select count(*) from posts").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("posts in pre-restore = %d, want 2", count)
+	}
+}
@@ -0,0 +1,94 @@
+package backup
+
+import (
+	"fmt"
+	"time"
+
+	"blog/models"
+	"blog/system"
+)
+
+// 保留策略，分别保留最近N天、N周、N月中每个周期最新的一个备份，全部为0时不清理
+type Policy struct {
+	Daily   int
+	Weekly  int
+	Monthly int
+}
+
+func configuredPolicy() Policy {
+	config := system.GetConfiguration()
+	return Policy{
+		Daily:   config.BackupKeepDaily,
+		Weekly:  config.BackupKeepWeekly,
+		Monthly: config.BackupKeepMonthly,
+	}
+}
+
+// 按保留策略挑选需要删除的备份，backups需按时间倒序，最新的备份总是保留
+func Expired(backups []*models.Backup, policy Policy) []*models.Backup {
+	if policy.Daily <= 0 && policy.Weekly <= 0 && policy.Monthly <= 0 {
+		return nil
+	}
+	keep := make(map[uint]bool)
+	if len(backups) > 0 {
+		keep[backups[0].ID] = true
+	}
+	keepPeriods(backups, policy.Daily, keep, func(t time.Time) string {
+		return t.Format("2006-01-02")
+	})
+	keepPeriods(backups, policy.Weekly, keep, func(t time.Time) string {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-%02d", year, week)
+	})
+	keepPeriods(backups, policy.Monthly, keep, func(t time.Time) string {
+		return t.Format("2006-01")
+	})
+	var expired []*models.Backup
+	for _, backup := range backups {
+		if !keep[backup.ID] {
+			expired = append(expired, backup)
+		}
+	}
+	return expired
+}
+
+// 保留最近n个周期中每个周期的第一个(即最新的)备份
+func keepPeriods(backups []*models.Backup, n int, keep map[uint]bool, period func(time.Time) string) {
+	seen := make(map[string]bool)
+	for _, backup := range backups {
+		if len(seen) >= n {
+			return
+		}
+		key := period(backup.CreatedAt)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		keep[backup.ID] = true
+	}
+}
+
+// Prune 删除目的地中超出保留策略的备份
+func Prune(destination string) error {
+	backups, err := models.ListBackupByDestination(destination, models.BackupStatusSuccess)
+	if err != nil {
+		return err
+	}
+	expired := Expired(backups, configuredPolicy())
+	if len(expired) == 0 {
+		return nil
+	}
+	store, err := NewDestination(destination)
+	if err != nil {
+		return err
+	}
+	for _, backup := range expired {
+		if err = store.Delete(Key(destination, backup.FileName)); err != nil {
+			return err
+		}
+		if err = backup.Delete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
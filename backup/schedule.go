@@ -0,0 +1,63 @@
+package backup
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/cihub/seelog"
+	"github.com/claudiu/gocron"
+	"github.com/pkg/errors"
+
+	"blog/system"
+)
+
+const (
+	DefaultSchedule = "7d"
+	ScheduleOff     = "off"
+)
+
+// 间隔+单位(h小时、d天、w周)，按天或周备份时可指定时间，如1d@03:00
+var scheduleRegexp = regexp.MustCompile(`^(\d+)([hdw])(?:@(\d{2}:\d{2}))?$`)
+
+// Schedule 按backup_schedule注册定时备份
+func Schedule() error {
+	schedule := system.GetConfiguration().BackupSchedule
+	if schedule == "" {
+		schedule = DefaultSchedule
+	}
+	if schedule == ScheduleOff {
+		return nil
+	}
+	match := scheduleRegexp.FindStringSubmatch(schedule)
+	if match == nil {
+		return errors.Errorf("invalid backup_schedule %s", schedule)
+	}
+	interval, err := strconv.ParseUint(match[1], 10, 64)
+	if err != nil || interval == 0 {
+		return errors.Errorf("invalid backup_schedule %s", schedule)
+	}
+	job := gocron.Every(interval)
+	switch match[2] {
+	case "h":
+		job = job.Hours()
+	case "d":
+		job = job.Days()
+	case "w":
+		job = job.Weeks()
+	}
+	if at := match[3]; at != "" {
+		if _, err = time.Parse("15:04", at); err != nil || match[2] == "h" {
+			return errors.Errorf("invalid backup_schedule %s", schedule)
+		}
+		job = job.At(at)
+	}
+	job.Do(scheduledRun)
+	return nil
+}
+
+func scheduledRun() {
+	if err := Run(); err != nil {
+		seelog.Error("[scheduledRun]backup err", err)
+	}
+}
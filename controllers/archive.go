@@ -1,11 +1,6 @@
 package controllers
 
 import (
-	"net/http"
-	"strconv"
-
-	"math"
-
 	"github.com/gin-gonic/gin"
 	"github.com/microcosm-cc/bluemonday"
 	"github.com/russross/blackfriday"
@@ -15,52 +10,42 @@ import (
 	. "blog/helpers"
 )
 
-func ArchiveGet(c *gin.Context) {
+func (h *Handler) ArchiveGet(c *gin.Context) {
 	var (
-		year      string
-		month     string
-		page      string
-		pageIndex int
-		pageSize  = system.GetConfiguration().PageSize
-		total     int
-		err       error
-		posts     []*models.Post
-		policy    *bluemonday.Policy
+		year       string
+		month      string
+		pagination *models.Pagination
+		err        error
+		posts      []*models.Post
+		policy     *bluemonday.Policy
 	)
 	year = c.Param("year")
 	month = c.Param("month")
-	page = c.Query("page")
-	pageIndex, _ = strconv.Atoi(page)
-	if pageIndex <= 0 {
-		pageIndex = 1
-	}
-	posts, err = models.ListPostByArchive(year, month, pageIndex, pageSize)
+	pagination = parsePagination(c, system.GetConfiguration().PageSize)
+	posts, err = h.Posts.ListByArchive(year, month, pagination)
 	if err != nil {
 		seelog.Info("[ArchiveGet]list archive err", err)
-		c.AbortWithStatus(http.StatusInternalServerError)
+		abortListError(c, err)
 		return
 	}
-	total, err = models.CountPostByArchive(year, month)
-	if err != nil {
-		seelog.Info("[ArchiveGet]count archive err", err)
-		c.AbortWithStatus(http.StatusInternalServerError)
-		return
+	categories := h.mustListCategories()
+	if err = h.loadPostList(posts, categories); err != nil {
+		seelog.Error("[ArchiveGet]load post list err", err)
 	}
 	policy = bluemonday.StrictPolicy()
 	for _, post := range posts {
-		post.Tags, _ = models.ListTagByPostId(strconv.FormatUint(uint64(post.ID), 10))
 		post.Body = policy.Sanitize(string(blackfriday.Run([]byte(post.Body), blackfriday.WithNoExtensions())))
 	}
 	user, _ := c.Get(ContextUserKey)
 	HtmlSuccess(c, "index/index.html", gin.H{
 		"posts":           posts,
-		"tags":            models.MustListTag(),
-		"archives":        models.MustListPostArchives(),
-		"links":           models.MustListLinks(),
-		"pageIndex":       pageIndex,
-		"totalPage":       int(math.Ceil(float64(total) / float64(pageSize))),
-		"maxReadPosts":    models.MustListMaxReadPost(),
-		"maxCommentPosts": models.MustListMaxCommentPost(),
+		"categories":      rootCategories(categories),
+		"tags":            h.mustListPublishedTag(),
+		"archives":        h.mustListArchives(),
+		"links":           h.mustListLinks(),
+		"pager":           newPager(c, pagination, false),
+		"maxReadPosts":    h.mustListMaxReadPost(),
+		"maxCommentPosts": h.mustListMaxCommentPost(),
 		"user": user,
 	})
 
@@ -1,30 +1,40 @@
 package controllers
 
 import (
-	"bytes"
-	"context"
-	"fmt"
-	"io/ioutil"
 	"net/http"
-	"net/url"
-	"os"
+	"strconv"
 
 	"github.com/cihub/seelog"
 	"github.com/gin-gonic/gin"
-	"github.com/pkg/errors"
-	"github.com/qiniu/go-sdk/v7/auth/qbox"
-	"github.com/qiniu/go-sdk/v7/storage"
+	"blog/backup"
 	. "blog/helpers"
+	"blog/related"
 	"blog/system"
 )
 
+func (h *Handler) BackupIndex(c *gin.Context) {
+	backups, _ := h.Backups.ListAll()
+	user, _ := c.Get(ContextUserKey)
+	schedule := system.GetConfiguration().BackupSchedule
+	if schedule == "" {
+		schedule = backup.DefaultSchedule
+	}
+	c.HTML(http.StatusOK, "admin/backup.html", gin.H{
+		"backups":      backups,
+		"destinations": backup.Destinations(),
+		"schedule":     schedule,
+		"user":         user,
+		"comments":     h.mustListUnreadComment(),
+	})
+}
+
 func BackupPost(c *gin.Context) {
 	var (
 		err error
 		res = gin.H{}
 	)
 	defer WriteJSON(c, res)
-	err = Backup()
+	err = backup.Run()
 	if err != nil {
 		seelog.Error("[BackupPost]backup err", err)
 		res["message"] = err.Error()
@@ -33,99 +43,43 @@ func BackupPost(c *gin.Context) {
 	res["succeed"] = true
 }
 
+// 下载、解密并校验备份，返回数据统计供确认
 func RestorePost(c *gin.Context) {
 	var (
-		fileName  string
-		fileUrl   string
-		err       error
-		res       = gin.H{}
-		resp      *http.Response
-		bodyBytes []byte
+		err     error
+		res     = gin.H{}
+		id      uint64
+		restore *backup.Restore
 	)
 	defer WriteJSON(c, res)
-	fileName = c.PostForm("fileName")
-	if fileName == "" {
-		res["message"] = "fileName cannot be empty."
-		return
-	}
-	fileUrl = system.GetConfiguration().QiniuFileServer + fileName
-	resp, err = http.Get(fileUrl)
+	id, err = strconv.ParseUint(c.PostForm("id"), 10, 64)
 	if err != nil {
-		seelog.Error("[RestorePost]get file err", err)
-		res["message"] = err.Error()
+		res["message"] = "invalid backup id"
 		return
 	}
-	defer resp.Body.Close()
-
-	bodyBytes, err = ioutil.ReadAll(resp.Body)
+	restore, err = backup.PrepareRestore(uint(id))
 	if err != nil {
-		seelog.Error("[RestorePost]read body err", err)
-		res["message"] = err.Error()
-		return
-	}
-	bodyBytes, err = Decrypt(bodyBytes, system.GetConfiguration().BackupKey)
-	if err != nil {
-		seelog.Error("[RestorePost]decrypt body err", err)
-		res["message"] = err.Error()
-		return
-	}
-	err = ioutil.WriteFile(fileName, bodyBytes, os.ModePerm)
-	if err == nil {
-		seelog.Error("[RestorePost]write file err", err)
+		seelog.Error("[RestorePost]prepare restore err", err)
 		res["message"] = err.Error()
 		return
 	}
+	res["restore"] = restore
 	res["succeed"] = true
 }
 
-func Backup() (err error) {
+// 确认后替换数据库
+func RestoreConfirm(c *gin.Context) {
 	var (
-		u           *url.URL
-		exist       bool
-		ret         PutRet
-		bodyBytes   []byte
-		encryptData []byte
+		err error
+		res = gin.H{}
 	)
-	u, err = url.Parse(system.GetConfiguration().DSN)
-	if err != nil {
-		seelog.Debug("[Backup]parse dsn error:%v", err)
-		return
-	}
-	exist, _ = PathExists(u.Path)
-	if !exist {
-		err = errors.New("database file doesn't exists.")
-		seelog.Debug("[Backup]database file doesn't exists.")
-		return
-	}
-	seelog.Debug("start backup...")
-	bodyBytes, err = ioutil.ReadFile(u.Path)
-	if err != nil {
-		seelog.Error("[Backup]read file err", err)
-		seelog.Error(err)
-		return
-	}
-	encryptData, err = Encrypt(bodyBytes, system.GetConfiguration().BackupKey)
-	if err != nil {
-		seelog.Error("[Backup]encrypt file err", err)
-		seelog.Error(err)
-		return
-	}
-
-	putPolicy := storage.PutPolicy{
-		Scope: system.GetConfiguration().QiniuBucket,
-	}
-	mac := qbox.NewMac(system.GetConfiguration().QiniuAccessKey, system.GetConfiguration().QiniuSecretKey)
-	token := putPolicy.UploadToken(mac)
-	cfg := storage.Config{}
-	uploader := storage.NewFormUploader(&cfg)
-	putExtra := storage.PutExtra{}
-
-	fileName := fmt.Sprintf("wblog_%s.db", GetCurrentTime().Format("20060102150405"))
-	err = uploader.Put(context.Background(), &ret, token, fileName, bytes.NewReader(encryptData), int64(len(encryptData)), &putExtra)
+	defer WriteJSON(c, res)
+	err = backup.ConfirmRestore(c.PostForm("token"))
 	if err != nil {
-		seelog.Debugf("backup error:%v", err)
+		seelog.Error("[RestoreConfirm]restore err", err)
+		res["message"] = err.Error()
 		return
 	}
-	seelog.Debug("backup successfully.")
-	return err
+	related.Refresh()
+	res["succeed"] = true
 }
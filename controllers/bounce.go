@@ -0,0 +1,194 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cihub/seelog"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/jinzhu/gorm"
+	"blog/mailer"
+	"blog/models"
+	"blog/system"
+	. "blog/helpers"
+)
+
+// 退信webhook的JSON格式，id是服务商的事件id，重复推送同一事件时只记录一次
+type bounceEvent struct {
+	Id     string `json:"id" binding:"required"`
+	Email  string `json:"email" binding:"required,email"`
+	Type   string `json:"type" binding:"required,oneof=hard soft complaint"`
+	Status string `json:"status"`
+}
+
+const (
+	// 无法解析的退信移入bounce_maildir下的该目录，留待人工检查
+	bounceBadDir = "bad"
+	// webhook请求体的大小上限，原始DSN邮件可能附带被退回的原邮件
+	maxBounceSize = 5 * megabyte
+)
+
+// InitBounceMaildir 启动时创建bounce_maildir下处理退信需要的目录
+func InitBounceMaildir() error {
+	dir := system.GetConfiguration().BounceMaildir
+	if dir == "" {
+		return nil
+	}
+	for _, name := range []string{"new", "cur", bounceBadDir} {
+		if err := os.MkdirAll(filepath.Join(dir, name), os.ModePerm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ProcessBounces 定时任务，处理bounce_maildir/new下新收到的退信，处理成功后移入cur目录，
+// 无法解析的移入bad目录，处理失败的留在new中下次重试，重试时已记录的收件人不会重复计数
+func (h *Handler) ProcessBounces() {
+	dir := system.GetConfiguration().BounceMaildir
+	if dir == "" {
+		return
+	}
+	files, err := ioutil.ReadDir(filepath.Join(dir, "new"))
+	if err != nil {
+		seelog.Error("[ProcessBounces]read maildir err", err)
+		return
+	}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		if err = h.processBounceFile(dir, file.Name()); err != nil {
+			seelog.Errorf("[ProcessBounces]process %s err %v", file.Name(), err)
+		}
+	}
+}
+
+func (h *Handler) processBounceFile(dir, name string) error {
+	path := filepath.Join(dir, "new", name)
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	bounces, err := mailer.ParseBounce(bytes.NewReader(raw))
+	if err != nil {
+		seelog.Warnf("[processBounceFile]move unparseable %s to %s, err %v", name, bounceBadDir, err)
+		return os.Rename(path, filepath.Join(dir, bounceBadDir, name))
+	}
+	for _, bounce := range bounces {
+		if err = h.handleBounce(bounce, bounceEventId(bounce, raw)); err != nil {
+			return err
+		}
+	}
+	// 按maildir约定标记为已读
+	return os.Rename(path, filepath.Join(dir, "cur", name+":2,S"))
+}
+
+// 退信邮件的标识，使用Message-ID，没有时使用邮件内容；经过哈希后长度固定
+func bounceEventId(bounce *mailer.Bounce, raw []byte) string {
+	var sum [sha256.Size]byte
+	if bounce.MessageId != "" {
+		sum = sha256.Sum256([]byte(bounce.MessageId))
+	} else {
+		sum = sha256.Sum256(raw)
+	}
+	return hex.EncodeToString(sum[:])
+}
+
+// 记录退信次数，永久退信达到bounce_limit或收到投诉后自动退订；
+// 同一个eventId只记录一次，重复收到的退信直接忽略
+func (h *Handler) handleBounce(bounce *mailer.Bounce, eventId string) error {
+	subscriber, err := h.Subscribers.GetByEmail(bounce.Email)
+	if err == gorm.ErrRecordNotFound {
+		seelog.Infof("[handleBounce]bounce of unknown address %s", bounce.Email)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	switch bounce.Type {
+	case mailer.BounceSoft:
+		subscriber.SoftBounceCount++
+	case mailer.BounceHard:
+		subscriber.HardBounceCount++
+		if subscriber.HardBounceCount >= system.GetConfiguration().BounceLimit {
+			subscriber.SubscribeState = false
+		}
+	case mailer.BounceComplaint:
+		subscriber.SubscribeState = false
+	}
+	subscriber.LastBounceAt = GetCurrentTime()
+	err = h.Subscribers.UpdateBounce(subscriber, eventId)
+	if err == models.ErrBounceRecorded {
+		seelog.Infof("[handleBounce]skip recorded bounce of %s", bounce.Email)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	seelog.Infof("[handleBounce]%s bounce of %s, status %s", bounce.Type, bounce.Email, bounce.Status)
+	return nil
+}
+
+// 接收邮件服务商推送的退信，支持JSON事件或原始DSN邮件
+func (h *Handler) BounceWebhook(c *gin.Context) {
+	var (
+		err     error
+		res     = gin.H{}
+		raw     []byte
+		bounces []*mailer.Bounce
+	)
+	token := system.GetConfiguration().BounceWebhookToken
+	if token == "" {
+		Handle404(c)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(c.Query("token"))) != 1 {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	defer WriteJSON(c, res)
+	raw, err = ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBounceSize))
+	if err != nil {
+		seelog.Error("[BounceWebhook]read body err", err)
+		res["message"] = err.Error()
+		return
+	}
+	if strings.HasPrefix(c.ContentType(), "application/json") {
+		var event bounceEvent
+		if err = binding.JSON.BindBody(raw, &event); err != nil {
+			seelog.Error("[BounceWebhook]input param err", err)
+			res["message"] = err.Error()
+			return
+		}
+		bounces = append(bounces, &mailer.Bounce{
+			Email:     event.Email,
+			Type:      event.Type,
+			Status:    event.Status,
+			MessageId: event.Id,
+		})
+	} else {
+		bounces, err = mailer.ParseBounce(bytes.NewReader(raw))
+		if err != nil {
+			seelog.Error("[BounceWebhook]parse bounce err", err)
+			res["message"] = err.Error()
+			return
+		}
+	}
+	for _, bounce := range bounces {
+		if err = h.handleBounce(bounce, bounceEventId(bounce, raw)); err != nil {
+			seelog.Error("[BounceWebhook]handle bounce err", err)
+			res["message"] = err.Error()
+			return
+		}
+	}
+	res["succeed"] = true
+}
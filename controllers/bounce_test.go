@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"blog/models"
+	"blog/system"
+)
+
+// 两个收件人的退信
+const testDSN = `From: MAILER-DAEMON@example.com
+To: blog@example.com
+Subject: Undelivered Mail Returned to Sender
+Message-Id: <dsn-1@mx.example.com>
+MIME-Version: 1.0
+Content-Type: multipart/report; report-type=delivery-status; boundary="boundary"
+
+--boundary
+Content-Type: text/plain
+
+Delivery failed.
+--boundary
+Content-Type: message/delivery-status
+
+Reporting-MTA: dns; mx.example.com
+
+Final-Recipient: rfc822; a@example.com
+Action: failed
+Status: 5.1.1
+
+Final-Recipient: rfc822; b@example.com
+Action: failed
+Status: 5.1.1
+--boundary--
+`
+
+// 第一次保存email的退信时失败，用于检查部分收件人处理失败后的重试
+type failingBounceRepository struct {
+	models.SubscriberRepository
+	email  string
+	failed bool
+}
+
+func (r *failingBounceRepository) UpdateBounce(subscriber *models.Subscriber, eventId string) error {
+	if subscriber.Email == r.email && !r.failed {
+		r.failed = true
+		return errors.New("update bounce failed")
+	}
+	return r.SubscriberRepository.UpdateBounce(subscriber, eventId)
+}
+
+// 启用退信处理的测试服务，返回bounce_maildir
+func newBounceServer(t *testing.T) (*testServer, *Handler, string) {
+	s := newTestServer(t)
+	dir := t.TempDir()
+	config := filepath.Join(t.TempDir(), "conf.yaml")
+	content := "bounce_maildir: " + dir + "\nbounce_webhook_token: secret\nbounce_limit: 5\n"
+	if err := ioutil.WriteFile(config, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := system.LoadConfiguration(config); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitBounceMaildir(); err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(s.repos)
+	s.engine.POST("/bounce/webhook", h.BounceWebhook)
+	return s, h, dir
+}
+
+func (s *testServer) bounceCounts(t *testing.T, email string) (int, int) {
+	t.Helper()
+	subscriber, err := s.repos.Subscribers.GetByEmail(email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return subscriber.SoftBounceCount, subscriber.HardBounceCount
+}
+
+func (s *testServer) postBounce(t *testing.T, contentType, body string) (bool, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/bounce/webhook?token=secret", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	s.engine.ServeHTTP(w, req)
+	var res struct {
+		Succeed bool   `json:"succeed"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("%v: %s", err, w.Body.String())
+	}
+	return res.Succeed, res.Message
+}
+
+// 部分收件人处理失败时退信留在new中，重试和重复收到同一封退信都不会重复计数
+func TestProcessBounceFileRetry(t *testing.T) {
+	s, h, dir := newBounceServer(t)
+	s.addSubscriber(t, "a@example.com")
+	s.addSubscriber(t, "b@example.com")
+	s.repos.Subscribers = &failingBounceRepository{SubscriberRepository: s.repos.Subscribers, email: "b@example.com"}
+	for _, name := range []string{"1.eml", "2.eml"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, "new", name), []byte(testDSN), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := h.processBounceFile(dir, "1.eml"); err == nil {
+		t.Fatal("processing succeeded although saving a bounce failed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new", "1.eml")); err != nil {
+		t.Fatalf("failed bounce was moved: %v", err)
+	}
+	h.ProcessBounces()
+	for _, name := range []string{"1.eml:2,S", "2.eml:2,S"} {
+		if _, err := os.Stat(filepath.Join(dir, "cur", name)); err != nil {
+			t.Errorf("%s was not processed: %v", name, err)
+		}
+	}
+	for _, email := range []string{"a@example.com", "b@example.com"} {
+		if _, hard := s.bounceCounts(t, email); hard != 1 {
+			t.Errorf("hard bounces of %s = %d, want 1", email, hard)
+		}
+	}
+}
+
+// webhook重复推送同一事件或同一封退信时只记录一次
+func TestBounceWebhookDuplicate(t *testing.T) {
+	s, _, _ := newBounceServer(t)
+	s.addSubscriber(t, "a@example.com")
+	s.addSubscriber(t, "b@example.com")
+
+	events := []string{
+		`{"id": "evt-1", "email": "a@example.com", "type": "soft"}`,
+		`{"id": "evt-1", "email": "a@example.com", "type": "soft"}`,
+		`{"id": "evt-2", "email": "a@example.com", "type": "soft"}`,
+	}
+	for _, event := range events {
+		if succeed, message := s.postBounce(t, "application/json", event); !succeed {
+			t.Fatalf("%s: %s", event, message)
+		}
+	}
+	if soft, _ := s.bounceCounts(t, "a@example.com"); soft != 2 {
+		t.Errorf("soft bounces = %d, want 2", soft)
+	}
+	if succeed, _ := s.postBounce(t, "application/json", `{"email": "a@example.com", "type": "soft"}`); succeed {
+		t.Error("event without an id was accepted")
+	}
+
+	for i := 0; i < 2; i++ {
+		if succeed, message := s.postBounce(t, "message/rfc822", testDSN); !succeed {
+			t.Fatalf("dsn: %s", message)
+		}
+	}
+	for _, email := range []string{"a@example.com", "b@example.com"} {
+		if _, hard := s.bounceCounts(t, email); hard != 1 {
+			t.Errorf("hard bounces of %s = %d, want 1", email, hard)
+		}
+	}
+}
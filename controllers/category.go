@@ -0,0 +1,223 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/russross/blackfriday"
+	"blog/models"
+	"blog/system"
+	. "blog/helpers"
+	"github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+// 分类页，地址由各级别名组成，如/category/backend/go；按最后一级别名查找分类，
+// 上级别名与当前的分类结构不一致时(如分类被移动)重定向到正确的地址
+func (h *Handler) CategoryGet(c *gin.Context) {
+	var (
+		category   *models.Category
+		categories []*models.Category
+		pagination *models.Pagination
+		err        error
+		policy     *bluemonday.Policy
+		posts      []*models.Post
+	)
+	categories, err = h.Categories.ListAll()
+	if err != nil {
+		seelog.Error("[CategoryGet]list category err", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	requested := strings.TrimRight(c.Param("path"), "/")
+	slug := requested[strings.LastIndex(requested, "/")+1:]
+	for _, value := range categories {
+		if value.Slug == slug {
+			category = value
+			break
+		}
+	}
+	if category == nil {
+		Handle404(c)
+		return
+	}
+	if "/category"+requested != category.Path {
+		target := category.Path
+		if c.Request.URL.RawQuery != "" {
+			target += "?" + c.Request.URL.RawQuery
+		}
+		c.Redirect(http.StatusMovedPermanently, target)
+		return
+	}
+	pagination = parsePagination(c, system.GetConfiguration().PageSize)
+	posts, err = h.Posts.ListByCategory(models.CategoryDescendantIds(categories, category.ID), pagination)
+	if err != nil {
+		seelog.Error("[CategoryGet]list post by category err", err)
+		abortListError(c, err)
+		return
+	}
+	if err = h.loadPostList(posts, categories); err != nil {
+		seelog.Error("[CategoryGet]load post list err", err)
+	}
+	policy = bluemonday.StrictPolicy()
+	for _, post := range posts {
+		post.Body = policy.Sanitize(string(blackfriday.Run([]byte(post.Body), blackfriday.WithNoExtensions())))
+	}
+	user, _ := c.Get(ContextUserKey)
+	HtmlSuccess(c, "index/index.html", gin.H{
+		"category":        category,
+		"breadcrumbs":     models.CategoryPath(categories, category.ID),
+		"posts":           posts,
+		"categories":      rootCategories(categories),
+		"tags":            h.mustListPublishedTag(),
+		"archives":        h.mustListArchives(),
+		"links":           h.mustListLinks(),
+		"pager":           newPager(c, pagination, false),
+		"maxReadPosts":    h.mustListMaxReadPost(),
+		"maxCommentPosts": h.mustListMaxCommentPost(),
+		"user":            user,
+	})
+}
+
+func (h *Handler) CategoryIndex(c *gin.Context) {
+	categories, _ := h.Categories.ListAll()
+	user, _ := c.Get(ContextUserKey)
+	HtmlSuccess(c, "admin/category.html", gin.H{
+		"categories": categories,
+		"user":       user,
+		"comments":   h.mustListUnreadComment(),
+	})
+}
+
+func (h *Handler) CategoryCreate(c *gin.Context) {
+	var (
+		err      error
+		category *models.Category
+		res      = gin.H{}
+	)
+	defer WriteJSON(c, res)
+	category, err = bindCategoryForm(c)
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	err = h.Categories.Insert(category)
+	if err != nil {
+		seelog.Error("[CategoryCreate]insert category err", err)
+		res["message"] = saveCategoryMessage(err)
+		return
+	}
+	res["succeed"] = true
+}
+
+func (h *Handler) CategoryUpdate(c *gin.Context) {
+	var (
+		id       uint64
+		err      error
+		category *models.Category
+		res      = gin.H{}
+	)
+	defer WriteJSON(c, res)
+	id, err = ParseIdToUint(c.Param("id"), "CategoryUpdate")
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	category, err = bindCategoryForm(c)
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	category.ID = uint(id)
+	err = h.Categories.Update(category)
+	if err != nil {
+		seelog.Error("[CategoryUpdate]update category err", err)
+		res["message"] = saveCategoryMessage(err)
+		return
+	}
+	res["succeed"] = true
+}
+
+func (h *Handler) CategoryDelete(c *gin.Context) {
+	var (
+		err error
+		id  uint64
+		res = gin.H{}
+	)
+	defer WriteJSON(c, res)
+	id, err = ParseIdToUint(c.Param("id"), "CategoryDelete")
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	err = h.Categories.Delete(uint(id))
+	if err != nil {
+		seelog.Error("[CategoryDelete]delete category err", err)
+		res["message"] = saveCategoryMessage(err)
+		return
+	}
+	res["succeed"] = true
+}
+
+// 从表单读取名称、别名、上级分类、排序和介绍
+func bindCategoryForm(c *gin.Context) (*models.Category, error) {
+	category := &models.Category{
+		Name:        strings.TrimSpace(c.PostForm("name")),
+		Slug:        strings.ToLower(strings.TrimSpace(c.PostForm("slug"))),
+		Description: c.PostForm("description"),
+	}
+	if category.Name == "" {
+		return nil, errors.New("请填写分类名称")
+	}
+	if !models.ValidSlug(category.Slug) {
+		return nil, errors.New("别名只能包含小写字母、数字和连字符")
+	}
+	parentId, err := parseOptionalId(c.PostForm("parentId"))
+	if err != nil {
+		return nil, errors.New("上级分类格式不正确")
+	}
+	category.ParentId = parentId
+	if sort := strings.TrimSpace(c.PostForm("sort")); sort != "" {
+		if category.Sort, err = strconv.Atoi(sort); err != nil {
+			return nil, errors.New("排序必须是整数")
+		}
+	}
+	return category, nil
+}
+
+// 表单中可以为空的id，为空时返回0
+func parseOptionalId(value string) (uint, error) {
+	if value = strings.TrimSpace(value); value == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	return uint(id), err
+}
+
+func saveCategoryMessage(err error) string {
+	switch err {
+	case models.ErrCategorySlugExists:
+		return "别名已被其他分类使用"
+	case models.ErrCategoryNotFound:
+		return "上级分类不存在"
+	case models.ErrCategoryCycle:
+		return "不能移动到自身或子分类之下"
+	case models.ErrCategoryHasChildren:
+		return "请先删除或移走子分类"
+	}
+	return err.Error()
+}
+
+// 顶级分类，用于侧边栏的分类树
+func rootCategories(categories []*models.Category) []*models.Category {
+	var roots []*models.Category
+	for _, category := range categories {
+		if category.Depth == 0 {
+			roots = append(roots, category)
+		}
+	}
+	return roots
+}
@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"blog/models"
+)
+
+// 分类页包括子分类的文章，上级别名不一致时重定向
+func TestCategoryGet(t *testing.T) {
+	s := newTestServer(t)
+	backend := s.addCategory(t, "Backend", "backend", 0)
+	golang := s.addCategory(t, "Go", "go", backend.ID)
+	s.addPost(t, &models.Post{Title: "backend", IsPublished: true, CategoryId: backend.ID})
+	s.addPost(t, &models.Post{Title: "go", IsPublished: true, CategoryId: golang.ID})
+	s.addPost(t, &models.Post{Title: "draft", CategoryId: golang.ID})
+	s.addPost(t, &models.Post{Title: "other", IsPublished: true})
+
+	if w := s.get("/category/backend"); w.Code != http.StatusOK || s.html.name != "index/index.html" {
+		t.Fatalf("backend = %d %s", w.Code, s.html.name)
+	}
+	if titles := renderedTitles(t, s.html.data); strings.Join(titles, ",") != "go,backend" {
+		t.Errorf("posts of backend = %v", titles)
+	}
+	if category := s.html.data["category"].(*models.Category); category.Total != 2 || category.Count != 1 {
+		t.Errorf("backend total %d, count %d", category.Total, category.Count)
+	}
+
+	s.get("/category/backend/go")
+	if titles := renderedTitles(t, s.html.data); strings.Join(titles, ",") != "go" {
+		t.Errorf("posts of go = %v", titles)
+	}
+	w := s.get("/category/go?page=1")
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/category/backend/go?page=1" {
+		t.Errorf("moved category = %d %s", w.Code, w.Header().Get("Location"))
+	}
+	if w = s.get("/category/missing"); w.Code != http.StatusNotFound {
+		t.Errorf("missing category = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestCategorySaveMessages(t *testing.T) {
+	s := newTestServer(t)
+	backend := s.addCategory(t, "Backend", "backend", 0)
+	golang := s.addCategory(t, "Go", "go", backend.ID)
+	id := func(category *models.Category) string {
+		return strconv.Itoa(int(category.ID))
+	}
+
+	tests := []struct {
+		target  string
+		form    url.Values
+		message string
+	}{
+		{"/admin/new_category", url.Values{"name": {"Go"}, "slug": {"go"}}, saveCategoryMessage(models.ErrCategorySlugExists)},
+		{"/admin/new_category", url.Values{"name": {"Gin"}, "slug": {"gin"}, "parentId": {"9999"}}, saveCategoryMessage(models.ErrCategoryNotFound)},
+		{"/admin/new_category", url.Values{"name": {"Gin"}, "slug": {"Gin Web"}}, "别名只能包含小写字母、数字和连字符"},
+		{fmt.Sprintf("/admin/category/%d/edit", backend.ID), url.Values{"name": {"Backend"}, "slug": {"backend"}, "parentId": {id(golang)}}, saveCategoryMessage(models.ErrCategoryCycle)},
+		{fmt.Sprintf("/admin/category/%d/delete", backend.ID), nil, saveCategoryMessage(models.ErrCategoryHasChildren)},
+	}
+	for _, test := range tests {
+		succeed, message := s.postJSON(t, test.target, test.form)
+		if succeed || message != test.message {
+			t.Errorf("%s %v = %v %s, want %s", test.target, test.form, succeed, message, test.message)
+		}
+	}
+
+	if succeed, message := s.postJSON(t, "/admin/new_category", url.Values{"name": {"Gin"}, "slug": {"gin"}, "parentId": {id(golang)}, "sort": {"2"}}); !succeed {
+		t.Fatalf("create failed: %s", message)
+	}
+	if succeed, message := s.postJSON(t, fmt.Sprintf("/admin/category/%d/edit", backend.ID), url.Values{"name": {"Server"}, "slug": {"server"}}); !succeed {
+		t.Fatalf("update failed: %s", message)
+	}
+	categories, _ := s.repos.Categories.ListAll()
+	var paths []string
+	for _, category := range categories {
+		paths = append(paths, category.Path)
+	}
+	if strings.Join(paths, ",") != "/category/server,/category/server/go,/category/server/go/gin" {
+		t.Errorf("paths = %v", paths)
+	}
+}
@@ -12,7 +12,7 @@ import (
 	"github.com/cihub/seelog"
 )
 
-func CommentPost(c *gin.Context) {
+func (h *Handler) CommentPost(c *gin.Context) {
 	var (
 		err  error
 		res  = gin.H{}
@@ -38,23 +38,18 @@ func CommentPost(c *gin.Context) {
 		return
 	}
 
-	post, err = models.GetPostById(postId)
+	post, err = h.Posts.GetById(postId)
 	if err != nil {
 		seelog.Error("[CommentPost]get post id err", err)
 		res["message"] = err.Error()
 		return
 	}
-	pid, err := ParseIdToUint(postId, "CommentPost")
-	if err != nil {
-		res["message"] = err.Error()
-		return
-	}
 	comment := &models.Comment{
-		PostID:  uint(pid),
+		PostID:  post.ID,
 		Content: content,
 		UserID:  userId,
 	}
-	err = comment.Insert()
+	err = h.Comments.Insert(comment)
 	if err != nil {
 		seelog.Error("[CommentPost]insert comment err", err)
 		res["message"] = err.Error()
@@ -64,7 +59,7 @@ func CommentPost(c *gin.Context) {
 	res["succeed"] = true
 }
 
-func CommentDelete(c *gin.Context) {
+func (h *Handler) CommentDelete(c *gin.Context) {
 	var (
 		err error
 		res = gin.H{}
@@ -79,11 +74,7 @@ func CommentDelete(c *gin.Context) {
 		res["message"] = err.Error()
 		return
 	}
-	comment := &models.Comment{
-		UserID: uint(userId),
-	}
-	comment.ID = uint(cid)
-	err = comment.Delete()
+	err = h.Comments.Delete(uint(cid), userId)
 	if err != nil {
 		seelog.Error("[CommentDelete]delete comment err", err)
 		res["message"] = err.Error()
@@ -92,7 +83,7 @@ func CommentDelete(c *gin.Context) {
 	res["succeed"] = true
 }
 
-func CommentRead(c *gin.Context) {
+func (h *Handler) CommentRead(c *gin.Context) {
 	var (
 		id uint64
 		err error
@@ -104,9 +95,7 @@ func CommentRead(c *gin.Context) {
 		res["message"] = err.Error()
 		return
 	}
-	comment := new(models.Comment)
-	comment.ID = uint(id)
-	err = comment.Update()
+	err = h.Comments.MarkRead(uint(id))
 	if err != nil {
 		seelog.Error("[CommentRead]update comment err", err)
 		res["message"] = err.Error()
@@ -115,13 +104,13 @@ func CommentRead(c *gin.Context) {
 	res["succeed"] = true
 }
 
-func CommentReadAll(c *gin.Context) {
+func (h *Handler) CommentReadAll(c *gin.Context) {
 	var (
 		err error
 		res = gin.H{}
 	)
 	defer WriteJSON(c, res)
-	err = models.SetAllCommentRead()
+	err = h.Comments.MarkAllRead()
 	if err != nil {
 		seelog.Error("[CommentReadAll]update all comment err", err)
 		res["message"] = err.Error()
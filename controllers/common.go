@@ -5,13 +5,13 @@ import (
 	"path"
 	"os"
 	"github.com/denisbakhtin/sitemap"
-	"blog/models"
 	"fmt"
 	"github.com/cihub/seelog"
 	"blog/helpers"
 )
 
-func CreateXMLSitemap() {
+// CreateXMLSitemap 定时任务，生成文章、分类、系列和页面的sitemap
+func (h *Handler) CreateXMLSitemap() {
 	configuration := system.GetConfiguration()
 	folder := path.Join(configuration.Public, "sitemap")
 	os.MkdirAll(folder, os.ModePerm)
@@ -26,7 +26,7 @@ func CreateXMLSitemap() {
 		Priority:   1,
 	})
 
-	posts, err := models.ListPublishedPost("", 0, 0)
+	posts, err := h.Posts.ListPublished("", nil)
 	if err == nil {
 		for _, post := range posts {
 			items = append(items, sitemap.Item{
@@ -38,7 +38,38 @@ func CreateXMLSitemap() {
 		}
 	}
 
-	pages, err := models.ListPublishedPage()
+	categories, err := h.Categories.ListAll()
+	if err == nil {
+		for _, category := range categories {
+			// 没有已发布文章的分类页内容为空，不加入sitemap
+			if category.Total == 0 {
+				continue
+			}
+			items = append(items, sitemap.Item{
+				Loc:        domain + category.Path,
+				LastMod:    now,
+				Changefreq: "weekly",
+				Priority:   0.7,
+			})
+		}
+	}
+
+	series, err := h.Series.ListAll()
+	if err == nil {
+		for _, s := range series {
+			if s.Total == 0 {
+				continue
+			}
+			items = append(items, sitemap.Item{
+				Loc:        fmt.Sprintf("%s/series/%s", domain, s.Slug),
+				LastMod:    s.UpdatedAt,
+				Changefreq: "weekly",
+				Priority:   0.8,
+			})
+		}
+	}
+
+	pages, err := h.Pages.ListPublished()
 	if err == nil {
 		for _, page := range pages {
 			items = append(items, sitemap.Item{
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"time"
+
+	"blog/models"
+	"blog/system"
+	"github.com/cihub/seelog"
+	. "blog/helpers"
+)
+
+const (
+	dailyPeriod  = 24 * time.Hour
+	weeklyPeriod = 7 * 24 * time.Hour
+	// 定时任务存在一定的执行误差，避免因几秒之差跳过一个周期
+	digestTolerance = time.Hour
+)
+
+var digestTemplate = template.Must(template.New("digest").Parse(`<p>{{.title}}</p>
+<ul>
+{{range .posts}}<li><a href="{{$.domain}}/post/{{.ID}}" target="_blank">{{.Title}}</a> {{.PublishedAt.Format "2006-01-02"}}</li>
+{{end}}</ul>`))
+
+// SendDigest 定时任务，给每日/每周摘要订阅者发送周期内发布的文章
+func (h *Handler) SendDigest() {
+	h.sendDigest(models.FrequencyDaily, dailyPeriod, "[blog]每日文章摘要")
+	h.sendDigest(models.FrequencyWeekly, weeklyPeriod, "[blog]每周文章摘要")
+}
+
+func (h *Handler) sendDigest(frequency string, period time.Duration, subject string) {
+	subscribers, err := h.Subscribers.ListByFrequency(frequency)
+	if err != nil {
+		seelog.Error("[sendDigest]list subscriber by frequency err", err)
+		return
+	}
+	now := GetCurrentTime()
+	for _, subscriber := range subscribers {
+		since := subscriber.LastDigestAt
+		if since.IsZero() {
+			since = now.Add(-period)
+		} else if now.Sub(since) < period-digestTolerance {
+			continue
+		}
+		posts, err := h.Posts.ListPublishedSinceBySubscriber(since, subscriber.ID)
+		if err != nil {
+			seelog.Error("[sendDigest]list published post err", err)
+			return
+		}
+		if len(posts) > 0 {
+			body, err := renderDigest(subject, posts)
+			if err != nil {
+				seelog.Error("[sendDigest]render digest err", err)
+				return
+			}
+			if err = sendSubscriberEmail(subscriber, subject, body); err != nil {
+				seelog.Errorf("[sendDigest]send digest to %s err %v", subscriber.Email, err)
+				continue
+			}
+		}
+		subscriber.LastDigestAt = now
+		if err = h.Subscribers.UpdateLastDigest(subscriber); err != nil {
+			seelog.Error("[sendDigest]update last digest err", err)
+		}
+	}
+}
+
+func renderDigest(title string, posts []*models.Post) (string, error) {
+	var buf bytes.Buffer
+	err := digestTemplate.Execute(&buf, map[string]interface{}{
+		"title":  title,
+		"posts":  posts,
+		"domain": system.GetConfiguration().Domain,
+	})
+	return buf.String(), err
+}
+
+// 文章发布时通知选择即时推送、且关注了文章标签的订阅者
+func (h *Handler) notifySubscribers(post *models.Post) {
+	subscribers, err := h.Subscribers.ListByPost(models.FrequencyImmediate, post.ID)
+	if err != nil {
+		seelog.Error("[notifySubscribers]list subscriber by post err", err)
+		return
+	}
+	subject := fmt.Sprintf("[blog]%s", post.Title)
+	body := fmt.Sprintf("<a href=\"%s/post/%d\" target=\"_blank\">%s</a><p>%s</p>", system.GetConfiguration().Domain, post.ID, post.Title, post.Excerpt())
+	for _, subscriber := range subscribers {
+		if err = sendSubscriberEmail(subscriber, subject, body); err != nil {
+			seelog.Errorf("[notifySubscribers]send email to %s err %v", subscriber.Email, err)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/cihub/seelog"
+	"github.com/gin-gonic/gin"
+	"blog/export"
+	. "blog/helpers"
+)
+
+// 下载Markdown/JSON格式的全部内容
+func ExportGet(c *gin.Context) {
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", "attachment; filename="+export.FileName(GetCurrentTime()))
+	c.Status(http.StatusOK)
+	if err := export.Write(c.Writer); err != nil {
+		seelog.Error("[ExportGet]export err", err)
+	}
+}
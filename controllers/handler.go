@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"blog/models"
+)
+
+// Handler 文章、页面、标签和评论相关的控制器，通过接口访问数据，测试时可替换为models/memory中的实现
+type Handler struct {
+	*models.Repositories
+}
+
+func NewHandler(repositories *models.Repositories) *Handler {
+	return &Handler{Repositories: repositories}
+}
+
+// 以下与models中的Must*函数对应，出错时返回空列表，用于页面侧边栏等非关键数据
+
+func (h *Handler) mustListPublishedTag() []*models.Tag {
+	tags, _ := h.Tags.ListPublished()
+	return tags
+}
+
+func (h *Handler) mustListCategories() []*models.Category {
+	categories, _ := h.Categories.ListAll()
+	return categories
+}
+
+func (h *Handler) mustListArchives() []*models.QrArchive {
+	archives, _ := h.Posts.ListArchives()
+	return archives
+}
+
+func (h *Handler) mustListLinks() []*models.Link {
+	links, _ := h.Links.ListAll()
+	return links
+}
+
+func (h *Handler) mustListMaxReadPost() []*models.Post {
+	posts, _ := h.Posts.ListMaxRead()
+	return posts
+}
+
+func (h *Handler) mustListMaxCommentPost() []*models.Post {
+	posts, _ := h.Posts.ListMaxComment()
+	return posts
+}
+
+func (h *Handler) mustListUnreadComment() []*models.Comment {
+	comments, _ := h.Comments.ListUnread()
+	return comments
+}
+
+// 为列表页的文章批量加载标签和评论数，每项各一次查询；分类从categories中查找
+func (h *Handler) loadPostList(posts []*models.Post, categories []*models.Category) error {
+	postIds := make([]uint, len(posts))
+	for i, post := range posts {
+		postIds[i] = post.ID
+	}
+	postTags, err := h.Tags.ListByPostIds(postIds)
+	if err != nil {
+		return err
+	}
+	totals, err := h.Comments.CountByPostIds(postIds)
+	if err != nil {
+		return err
+	}
+	categoryById := make(map[uint]*models.Category, len(categories))
+	for _, category := range categories {
+		categoryById[category.ID] = category
+	}
+	for _, post := range posts {
+		post.Tags = postTags[post.ID]
+		post.CommentTotal = totals[post.ID]
+		post.Category = categoryById[post.CategoryId]
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package controllers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+
+	"blog/helpers"
+	"blog/mailer"
+	"blog/models"
+	"blog/models/memory"
+	"blog/system"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// 记录最近一次渲染的模板和数据，测试时不加载views中的模板
+type htmlRecorder struct {
+	name string
+	data gin.H
+}
+
+func (r *htmlRecorder) Instance(name string, data interface{}) render.Render {
+	r.name = name
+	r.data, _ = data.(gin.H)
+	return render.Data{ContentType: "text/html; charset=utf-8", Data: []byte(name)}
+}
+
+// 使用内存数据的Handler及其路由，与routers中的地址一致
+type testServer struct {
+	engine *gin.Engine
+	repos  *models.Repositories
+	html   *htmlRecorder
+}
+
+func newTestServer(t *testing.T) *testServer {
+	config := filepath.Join(t.TempDir(), "conf.yaml")
+	if err := ioutil.WriteFile(config, []byte("page_size: 2\nadmin_page_size: 2\nmail_transport: memory\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := system.LoadConfiguration(config); err != nil {
+		t.Fatal(err)
+	}
+	if err := mailer.InitTransport(); err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{
+		engine: gin.New(),
+		repos:  memory.NewRepositories(memory.NewStore()),
+		html:   &htmlRecorder{},
+	}
+	s.engine.HTMLRender = s.html
+	h := NewHandler(s.repos)
+	s.engine.GET("/", h.IndexGet)
+	s.engine.GET("/post/:id", h.PostGet)
+	s.engine.GET("/category/*path", h.CategoryGet)
+	s.engine.GET("/series/:slug", h.SeriesGet)
+	s.engine.POST("/subscribe", h.Subscribe)
+	s.engine.POST("/subscription", h.SubscriptionPost)
+	admin := s.engine.Group("/admin")
+	// 代替AdminScopeRequired，以管理员身份访问后台
+	admin.Use(func(c *gin.Context) {
+		c.Set(helpers.ContextUserKey, &models.User{IsAdmin: true})
+	})
+	admin.POST("/upload", h.Upload)
+	admin.GET("/media", h.MediaIndex)
+	admin.GET("/media/list", h.MediaList)
+	admin.POST("/media/:id/delete", h.MediaDelete)
+	admin.POST("/post/:id/edit", h.PostUpdate)
+	admin.POST("/post/:id/publish", h.PostPublish)
+	admin.POST("/tag/:id/edit", h.TagUpdate)
+	admin.POST("/tag/:id/merge", h.TagMerge)
+	admin.POST("/new_category", h.CategoryCreate)
+	admin.POST("/category/:id/edit", h.CategoryUpdate)
+	admin.POST("/category/:id/delete", h.CategoryDelete)
+	return s
+}
+
+func (s *testServer) get(target string) *httptest.ResponseRecorder {
+	s.html.name, s.html.data = "", nil
+	w := httptest.NewRecorder()
+	s.engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	return w
+}
+
+func (s *testServer) post(target string, form url.Values) *httptest.ResponseRecorder {
+	s.html.name, s.html.data = "", nil
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	s.engine.ServeHTTP(w, req)
+	return w
+}
+
+// 提交表单并解析WriteJSON的结果
+func (s *testServer) postJSON(t *testing.T, target string, form url.Values) (bool, string) {
+	t.Helper()
+	w := s.post(target, form)
+	var res struct {
+		Succeed bool   `json:"succeed"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("%s: %v: %s", target, err, w.Body.String())
+	}
+	return res.Succeed, res.Message
+}
+
+func (s *testServer) addTag(t *testing.T, name string) *models.Tag {
+	t.Helper()
+	tag := &models.Tag{Name: name}
+	if err := s.repos.Tags.Insert(tag); err != nil {
+		t.Fatal(err)
+	}
+	return tag
+}
+
+func (s *testServer) addCategory(t *testing.T, name, slug string, parentId uint) *models.Category {
+	t.Helper()
+	category := &models.Category{Name: name, Slug: slug, ParentId: parentId}
+	if err := s.repos.Categories.Insert(category); err != nil {
+		t.Fatal(err)
+	}
+	return category
+}
+
+// 新建文章，按添加顺序递增创建时间，列表中后添加的排在前面
+func (s *testServer) addPost(t *testing.T, post *models.Post, tagIds ...uint) *models.Post {
+	t.Helper()
+	post.CreatedAt = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(s.repos.Posts.Count()) * time.Hour)
+	if err := s.repos.Posts.Save(post, tagIds, nil); err != nil {
+		t.Fatal(err)
+	}
+	return post
+}
+
+// 添加已激活、即时推送的订阅者
+func (s *testServer) addSubscriber(t *testing.T, email string) *models.Subscriber {
+	t.Helper()
+	subscriber := &models.Subscriber{Email: email, Frequency: models.FrequencyImmediate}
+	if err := s.repos.Subscribers.Insert(subscriber); err != nil {
+		t.Fatal(err)
+	}
+	subscriber.VerifyState = true
+	if err := s.repos.Subscribers.Update(subscriber); err != nil {
+		t.Fatal(err)
+	}
+	return subscriber
+}
+
+// 等待后台发送的邮件，超时后返回已发送的全部邮件
+func sentMails(t *testing.T, want int) []*mailer.Message {
+	t.Helper()
+	outbox := mailer.GetTransport().(mailer.Outbox)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		messages, _ := outbox.List()
+		if len(messages) >= want || time.Now().After(deadline) {
+			return messages
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func renderedTitles(t *testing.T, data gin.H) []string {
+	t.Helper()
+	posts, ok := data["posts"].([]*models.Post)
+	if !ok {
+		t.Fatalf("posts were not rendered: %v", data)
+	}
+	titles := make([]string, len(posts))
+	for i, post := range posts {
+		titles[i] = post.Title
+	}
+	return titles
+}
+
+func TestIndexGetPagination(t *testing.T) {
+	s := newTestServer(t)
+	tag := s.addTag(t, "go")
+	s.addPost(t, &models.Post{Title: "first", IsPublished: true})
+	s.addPost(t, &models.Post{Title: "draft"})
+	s.addPost(t, &models.Post{Title: "second", IsPublished: true}, tag.ID)
+	s.addPost(t, &models.Post{Title: "third", IsPublished: true})
+
+	if w := s.get("/"); w.Code != http.StatusOK || s.html.name != "index/index.html" {
+		t.Fatalf("index = %d %s", w.Code, s.html.name)
+	}
+	if titles := renderedTitles(t, s.html.data); strings.Join(titles, ",") != "third,second" {
+		t.Errorf("page 1 = %v", titles)
+	}
+	pager := s.html.data["pager"].(*pager)
+	if pager.Total != 3 || pager.NextURL() != "/?page=2" {
+		t.Errorf("pager total %d, next %s", pager.Total, pager.NextURL())
+	}
+	posts := s.html.data["posts"].([]*models.Post)
+	if len(posts[1].Tags) != 1 || posts[1].Tags[0].Name != "go" {
+		t.Errorf("tags of second = %v", posts[1].Tags)
+	}
+
+	s.get("/?page=2")
+	if titles := renderedTitles(t, s.html.data); strings.Join(titles, ",") != "first" {
+		t.Errorf("page 2 = %v", titles)
+	}
+	if w := s.get("/?cursor=bad"); w.Code != http.StatusBadRequest {
+		t.Errorf("bad cursor = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
@@ -1,11 +1,6 @@
 package controllers
 
 import (
-	"net/http"
-	"strconv"
-
-	"math"
-
 	"github.com/gin-gonic/gin"
 	"github.com/microcosm-cc/bluemonday"
 	"github.com/russross/blackfriday"
@@ -15,62 +10,51 @@ import (
 	"github.com/cihub/seelog"
 )
 
-func IndexGet(c *gin.Context) {
+func (h *Handler) IndexGet(c *gin.Context) {
 	var (
-		pageIndex int
-		pageSize  = system.GetConfiguration().PageSize
-		total     int
-		page      string
-		err       error
-		posts     []*models.Post
-		policy    *bluemonday.Policy
+		pagination *models.Pagination
+		err        error
+		posts      []*models.Post
+		policy     *bluemonday.Policy
 	)
-	page = c.Query("page")
-	pageIndex, _ = strconv.Atoi(page)
-	if pageIndex <= 0 {
-		pageIndex = 1
-	}
-	posts, err = models.ListPublishedPost("", pageIndex, pageSize)
+	pagination = parsePagination(c, system.GetConfiguration().PageSize)
+	posts, err = h.Posts.ListPublished("", pagination)
 	if err != nil {
 		seelog.Error("[IndexGet]list publish post err", err)
-		c.AbortWithStatus(http.StatusInternalServerError)
+		abortListError(c, err)
 		return
 	}
-	total, err = models.CountPostByTag("")
-	if err != nil {
-		seelog.Error("[IndexGet]count publish post by tag err", err)
-		c.AbortWithStatus(http.StatusInternalServerError)
-		return
+	categories := h.mustListCategories()
+	if err = h.loadPostList(posts, categories); err != nil {
+		seelog.Error("[IndexGet]load post list err", err)
 	}
 	policy = bluemonday.StrictPolicy()
 	for _, post := range posts {
-		post.Tags, _ = models.ListTagByPostId(strconv.FormatUint(uint64(post.ID), 10))
 		post.Body = policy.Sanitize(string(blackfriday.Run([]byte(post.Body), blackfriday.WithNoExtensions())))
 	}
 	user, _ := c.Get(ContextUserKey)
 	HtmlSuccess(c, "index/index.html", gin.H{
 		"posts":           posts,
-		"tags":            models.MustListTag(),
-		"archives":        models.MustListPostArchives(),
-		"links":           models.MustListLinks(),
+		"categories":      rootCategories(categories),
+		"tags":            h.mustListPublishedTag(),
+		"archives":        h.mustListArchives(),
+		"links":           h.mustListLinks(),
 		"user":            user,
-		"pageIndex":       pageIndex,
-		"totalPage":       int(math.Ceil(float64(total) / float64(pageSize))),
-		"path":            c.Request.URL.Path,
-		"maxReadPosts":    models.MustListMaxReadPost(),
-		"maxCommentPosts": models.MustListMaxCommentPost(),
+		"pager":           newPager(c, pagination, false),
+		"maxReadPosts":    h.mustListMaxReadPost(),
+		"maxCommentPosts": h.mustListMaxCommentPost(),
 	})
 }
 
-func AdminIndex(c *gin.Context) {
+func (h *Handler) AdminIndex(c *gin.Context) {
 	user, _ := c.Get(ContextUserKey)
 	HtmlSuccess(c, "admin/index.html", gin.H{
-		"pageCount":    models.CountPage(),
-		"postCount":    models.CountPost(),
-		"tagCount":     models.CountTag(),
-		"commentCount": models.CountComment(),
+		"pageCount":    h.Pages.Count(),
+		"postCount":    h.Posts.Count(),
+		"tagCount":     h.Tags.Count(),
+		"commentCount": h.Comments.Count(),
 		"user":         user,
-		"comments":     models.MustListUnreadComment(),
+		"comments":     h.mustListUnreadComment(),
 		"active":       "index",
 	})
 }
@@ -9,17 +9,17 @@ import (
 	. "blog/helpers"
 )
 
-func LinkIndex(c *gin.Context) {
-	links, _ := models.ListLinks()
+func (h *Handler) LinkIndex(c *gin.Context) {
+	links, _ := h.Links.ListAll()
 	user, _ := c.Get(ContextUserKey)
 	HtmlSuccess(c, "admin/link.html", gin.H{
 		"links":    links,
 		"user":     user,
-		"comments": models.MustListUnreadComment(),
+		"comments": h.mustListUnreadComment(),
 	})
 }
 
-func LinkCreate(c *gin.Context) {
+func (h *Handler) LinkCreate(c *gin.Context) {
 	var (
 		err   error
 		res   = gin.H{}
@@ -42,7 +42,7 @@ func LinkCreate(c *gin.Context) {
 		Url:  LinkForm.Url,
 		Sort: int(sort),
 	}
-	err = link.Insert()
+	err = h.Links.Insert(link)
 	if err != nil {
 		seelog.Error("[LinkCreate]insert link err", err)
 		res["message"] = err.Error()
@@ -51,7 +51,7 @@ func LinkCreate(c *gin.Context) {
 	res["succeed"] = true
 }
 
-func LinkUpdate(c *gin.Context) {
+func (h *Handler) LinkUpdate(c *gin.Context) {
 	var (
 		id   uint64
 		sort uint64
@@ -81,7 +81,7 @@ func LinkUpdate(c *gin.Context) {
 		Sort: int(sort),
 	}
 	link.ID = uint(id)
-	err = link.Update()
+	err = h.Links.Update(link)
 	if err != nil {
 		seelog.Error("[LinkUpdate]update link err", err)
 		res["message"] = err.Error()
@@ -90,20 +90,20 @@ func LinkUpdate(c *gin.Context) {
 	res["succeed"] = true
 }
 
-func LinkGet(c *gin.Context) {
+func (h *Handler) LinkGet(c *gin.Context) {
 	id, _ := ParseIdToUint(c.Param("id"), "LinkGet")
-	link, err := models.GetLinkById(uint(id))
+	link, err := h.Links.GetById(uint(id))
 	if err != nil {
 		seelog.Error("[LinkGet]get link by id err", err)
-		c.AbortWithStatus(http.StatusInternalServerError)
+		Handle404(c)
 		return
 	}
 	link.View++
-	link.Update()
+	h.Links.UpdateView(link)
 	c.Redirect(http.StatusFound, link.Url)
 }
 
-func LinkDelete(c *gin.Context) {
+func (h *Handler) LinkDelete(c *gin.Context) {
 	var (
 		err error
 		id uint64
@@ -116,9 +116,7 @@ func LinkDelete(c *gin.Context) {
 		return
 	}
 
-	link := new(models.Link)
-	link.ID = uint(id)
-	err = link.Delete()
+	err = h.Links.Delete(uint(id))
 	if err != nil {
 		seelog.Error("[LinkDelete]delete link err", err)
 		res["message"] = err.Error()
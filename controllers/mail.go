@@ -1,15 +1,18 @@
 package controllers
 
 import (
+	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"blog/mailer"
 	"blog/models"
+	"blog/system"
 	. "blog/helpers"
 	"github.com/cihub/seelog"
 )
 
-func SendMail(c *gin.Context) {
+func (h *Handler) SendMail(c *gin.Context) {
 	var (
 		err        error
 		res        = gin.H{}
@@ -29,13 +32,13 @@ func SendMail(c *gin.Context) {
 		res["message"] = err.Error()
 		return
 	}
-	subscriber, err = models.GetSubscriberById(uint(uid))
+	subscriber, err = h.Subscribers.GetById(uint(uid))
 	if err != nil {
 		seelog.Error("[SendMail]get subscriber by id err", err)
 		res["message"] = err.Error()
 		return
 	}
-	err = SendEmail(subscriber.Email, subject, content)
+	err = sendSubscriberEmail(subscriber, subject, content)
 	if err != nil {
 		seelog.Error("[SendMail]send email err", err)
 		res["message"] = err.Error()
@@ -44,12 +47,10 @@ func SendMail(c *gin.Context) {
 	res["succeed"] = true
 }
 
-func SendBatchMail(c *gin.Context) {
+func (h *Handler) SendBatchMail(c *gin.Context) {
 	var (
-		err         error
-		res         = gin.H{}
-		subscribers []*models.Subscriber
-		emails      = make([]string, 0)
+		err error
+		res = gin.H{}
 	)
 	defer WriteJSON(c, res)
 	subject := c.PostForm("subject")
@@ -58,20 +59,53 @@ func SendBatchMail(c *gin.Context) {
 		res["message"] = "error parameter"
 		return
 	}
-	subscribers, err = models.ListSubscriber(true)
+	err = h.sendEmailToSubscribers(subject, content)
 	if err != nil {
-		seelog.Error("[SendBatchMail]list subscriber err", err)
+		seelog.Error("[SendBatchMail]send email err", err)
 		res["message"] = err.Error()
 		return
 	}
-	for _, subscriber := range subscribers {
-		emails = append(emails, subscriber.Email)
+	res["succeed"] = true
+}
+
+// 预览已发送的邮件，仅file和memory发送方式支持
+func (h *Handler) MailOutbox(c *gin.Context) {
+	var messages []*mailer.Message
+	outbox, ok := mailer.GetTransport().(mailer.Outbox)
+	if ok {
+		var err error
+		messages, err = outbox.List()
+		if err != nil {
+			seelog.Error("[MailOutbox]list messages err", err)
+		}
+	}
+	user, _ := c.Get(ContextUserKey)
+	HtmlSuccess(c, "admin/outbox.html", gin.H{
+		"messages":    messages,
+		"previewable": ok,
+		"transport":   system.GetConfiguration().MailTransport,
+		"user":        user,
+		"comments":    h.mustListUnreadComment(),
+	})
+}
+
+// 输出邮件正文，页面中以sandbox的iframe展示
+func MailOutboxGet(c *gin.Context) {
+	outbox, ok := mailer.GetTransport().(mailer.Outbox)
+	if !ok {
+		Handle404(c)
+		return
 	}
-	err = SendEmail(strings.Join(emails, ";"), subject, content)
+	msg, err := outbox.Get(c.Param("id"))
 	if err != nil {
-		seelog.Error("[SendBatchMail]send email err", err)
-		res["message"] = err.Error()
+		seelog.Error("[MailOutboxGet]get message err", err)
+		Handle404(c)
 		return
 	}
-	res["succeed"] = true
+	contentType := "text/plain; charset=utf-8"
+	if strings.HasPrefix(msg.ContentType, "text/html") {
+		contentType = "text/html; charset=utf-8"
+	}
+	c.Header("Content-Security-Policy", "sandbox")
+	c.Data(http.StatusOK, contentType, []byte(msg.Body))
 }
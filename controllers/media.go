@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/cihub/seelog"
+	"github.com/gin-gonic/gin"
+	. "blog/helpers"
+	"blog/models"
+	"blog/storage"
+	"blog/system"
+)
+
+func (h *Handler) MediaIndex(c *gin.Context) {
+	keyword := c.Query("q")
+	pagination := parsePagination(c, system.GetConfiguration().AdminPageSize)
+	medias, err := h.Media.List(keyword, pagination)
+	if err != nil {
+		seelog.Error("[MediaIndex]list media err", err)
+		abortListError(c, err)
+		return
+	}
+	urls := make([]string, len(medias))
+	mediaIds := make([]uint, len(medias))
+	for i, media := range medias {
+		urls[i] = media.Url
+		mediaIds[i] = media.ID
+	}
+	usage, err := h.Posts.ListByMediaUrls(urls)
+	if err != nil {
+		seelog.Error("[MediaIndex]list posts of media err", err)
+	}
+	variants, err := h.Media.ListVariantsByMediaIds(mediaIds)
+	if err != nil {
+		seelog.Error("[MediaIndex]list media variant err", err)
+	}
+	for _, media := range medias {
+		media.Posts = usage[media.Url]
+		media.Variants = variants[media.ID]
+	}
+	user, _ := c.Get(ContextUserKey)
+	c.HTML(http.StatusOK, "admin/media.html", gin.H{
+		"medias":   medias,
+		"pager":    newPager(c, pagination, true),
+		"keyword":  keyword,
+		"user":     user,
+		"comments": h.mustListUnreadComment(),
+	})
+}
+
+// 编辑器中选择已上传文件时使用
+func (h *Handler) MediaList(c *gin.Context) {
+	var (
+		err    error
+		res    = gin.H{}
+		medias []*models.Media
+	)
+	defer WriteJSON(c, res)
+	pagination := parsePagination(c, system.GetConfiguration().AdminPageSize)
+	medias, err = h.Media.List(c.Query("q"), pagination)
+	if err != nil {
+		seelog.Error("[MediaList]list media err", err)
+		res["message"] = err.Error()
+		return
+	}
+	writeList(res, medias, pagination)
+}
+
+// 先从存储中删除文件，再删除记录；仍有文章引用时需要确认(force=true)，避免文章中的图片失效
+func (h *Handler) MediaDelete(c *gin.Context) {
+	var (
+		err   error
+		res   = gin.H{}
+		id    uint64
+		media *models.Media
+		usage map[string][]*models.Post
+		store storage.Storage
+	)
+	defer WriteJSON(c, res)
+	id, err = ParseIdToUint(c.Param("id"), "MediaDelete")
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	media, err = h.Media.GetById(uint(id))
+	if err != nil {
+		seelog.Error("[MediaDelete]get media err", err)
+		res["message"] = err.Error()
+		return
+	}
+	usage, err = h.Posts.ListByMediaUrls([]string{media.Url})
+	if err != nil {
+		seelog.Error("[MediaDelete]list posts of media err", err)
+		res["message"] = err.Error()
+		return
+	}
+	if posts := usage[media.Url]; len(posts) > 0 && c.PostForm("force") != "true" {
+		res["message"] = fmt.Sprintf("仍有%d篇文章引用了该文件，确认后才能删除", len(posts))
+		res["posts"] = posts
+		return
+	}
+	store, err = storage.NewStorage(media.Driver)
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	media.Variants, err = h.Media.ListVariants(media.ID)
+	if err != nil {
+		seelog.Error("[MediaDelete]list media variant err", err)
+		res["message"] = err.Error()
+		return
+	}
+	for _, variant := range media.Variants {
+		if err = store.Delete(variant.StorageKey); err != nil {
+			seelog.Error("[MediaDelete]delete variant file err", err)
+			res["message"] = err.Error()
+			return
+		}
+	}
+	if err = store.Delete(media.StorageKey); err != nil {
+		seelog.Error("[MediaDelete]delete file err", err)
+		res["message"] = err.Error()
+		return
+	}
+	if err = h.Media.Delete(media.ID); err != nil {
+		seelog.Error("[MediaDelete]delete media err", err)
+		res["message"] = err.Error()
+		return
+	}
+	res["succeed"] = true
+}
+
+// markdown中的图片地址
+var markdownImageRegexp = regexp.MustCompile(`!\[[^\]]*\]\(\s*<?([^)\s>]+)`)
+
+// 供前端markdown渲染使用的响应式图片信息
+type responsiveImage struct {
+	Srcset string `json:"srcset"`
+	Webp   string `json:"webp,omitempty"`
+	Sizes  string `json:"sizes"`
+}
+
+// 查找正文中引用的已上传图片，返回地址到srcset的映射
+func (h *Handler) responsiveImages(body string) map[string]*responsiveImage {
+	images := make(map[string]*responsiveImage)
+	var urls []string
+	for _, match := range markdownImageRegexp.FindAllStringSubmatch(body, -1) {
+		urls = append(urls, match[1])
+	}
+	medias, err := h.Media.ListByUrls(urls)
+	if err != nil {
+		seelog.Error("[responsiveImages]list media err", err)
+		return images
+	}
+	for _, media := range medias {
+		if len(media.Variants) == 0 || media.Width == 0 {
+			continue
+		}
+		images[media.Url] = &responsiveImage{
+			Srcset: media.Srcset(media.ContentType),
+			Webp:   media.Srcset("image/webp"),
+			Sizes:  fmt.Sprintf("(max-width: %dpx) 100vw, %dpx", media.Width, media.Width),
+		}
+	}
+	return images
+}
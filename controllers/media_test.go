@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"blog/models"
+)
+
+// 媒体库列表一次加载全部文件的引用文章和衍生文件；被引用的文件需要确认后才能删除
+func TestMediaDeleteReferenced(t *testing.T) {
+	s, dir := newUploadServer(t)
+	if succeed, message := s.upload(t, "a.png", testPNG(t)); !succeed {
+		t.Fatalf("upload failed: %s", message)
+	}
+	if succeed, message := s.upload(t, "notes.txt", []byte("plain text notes")); !succeed {
+		t.Fatalf("upload failed: %s", message)
+	}
+	uploaded, _ := s.repos.Media.List("", nil)
+	file, image := uploaded[0], uploaded[1]
+	s.addPost(t, &models.Post{Title: "uses image", Body: "![a](" + image.Url + ")"})
+
+	s.get("/admin/media")
+	medias, ok := s.html.data["medias"].([]*models.Media)
+	if !ok || len(medias) != 2 {
+		t.Fatalf("medias = %v", s.html.data["medias"])
+	}
+	for _, media := range medias {
+		wantPosts, wantVariants := 0, 0
+		if media.ID == image.ID {
+			wantPosts, wantVariants = 1, 1
+		}
+		if len(media.Posts) != wantPosts || len(media.Variants) != wantVariants {
+			t.Errorf("%s: %d posts, %d variants, want %d, %d", media.FileName, len(media.Posts), len(media.Variants), wantPosts, wantVariants)
+		}
+	}
+
+	remove := fmt.Sprintf("/admin/media/%d/delete", image.ID)
+	if succeed, message := s.postJSON(t, remove, nil); succeed || message != "仍有1篇文章引用了该文件，确认后才能删除" {
+		t.Errorf("deleting a referenced image = %v %s", succeed, message)
+	}
+	if files := storedFiles(t, dir); len(files) != 3 {
+		t.Errorf("stored files after a refused delete = %v", files)
+	}
+	if succeed, message := s.postJSON(t, remove, url.Values{"force": {"true"}}); !succeed {
+		t.Fatalf("confirmed delete failed: %s", message)
+	}
+	if succeed, message := s.postJSON(t, fmt.Sprintf("/admin/media/%d/delete", file.ID), nil); !succeed {
+		t.Fatalf("deleting an unreferenced file failed: %s", message)
+	}
+	if files := storedFiles(t, dir); len(files) != 0 {
+		t.Errorf("stored files after delete = %v", files)
+	}
+}
+
+// 编辑器中的文件列表按游标翻页，响应中包括分页信息
+func TestMediaList(t *testing.T) {
+	s := newTestServer(t)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		media := &models.Media{Driver: "local", StorageKey: name, Url: "/static/uploads/" + name, FileName: name}
+		if err := s.repos.Media.Insert(media); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list := func(query string) ([]string, *models.Pagination) {
+		t.Helper()
+		w := s.get("/admin/media/list?" + query)
+		var res struct {
+			Succeed    bool               `json:"succeed"`
+			Data       []*models.Media    `json:"data"`
+			Pagination *models.Pagination `json:"pagination"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || !res.Succeed || res.Pagination == nil {
+			t.Fatalf("%s: %v %s", query, err, w.Body.String())
+		}
+		names := make([]string, len(res.Data))
+		for i, media := range res.Data {
+			names[i] = media.FileName
+		}
+		return names, res.Pagination
+	}
+
+	names, pagination := list("page_size=2")
+	if strings.Join(names, ",") != "c.txt,b.txt" || pagination.Total != 3 || pagination.NextCursor == "" {
+		t.Fatalf("first page = %v, %+v", names, pagination)
+	}
+	names, pagination = list("page_size=2&cursor=" + url.QueryEscape(pagination.NextCursor))
+	if strings.Join(names, ",") != "a.txt" || pagination.NextCursor != "" {
+		t.Errorf("second page = %v, %+v", names, pagination)
+	}
+}
@@ -13,30 +13,31 @@ import (
 	. "blog/helpers"
 )
 
-func PageGet(c *gin.Context) {
-	page, err := models.GetPageById(c.Param("id"))
+func (h *Handler) PageGet(c *gin.Context) {
+	page, err := h.Pages.GetById(c.Param("id"))
 	if err != nil || !page.IsPublished {
 		seelog.Error("[PageGet]get page by id err", err)
 		Handle404(c)
 		return
 	}
 	page.View++
-	page.UpdateView()
+	h.Pages.UpdateView(page)
 	user, _ := c.Get(ContextUserKey)
 	HtmlSuccess(c, "page/display.html", gin.H{
 		"page": page,
+		"images": h.responsiveImages(page.Body),
 		"user": user,
 	})
 }
 
-func PageNew(c *gin.Context) {
+func (h *Handler) PageNew(c *gin.Context) {
 	user, _ := c.Get(ContextUserKey)
 	HtmlSuccess(c, "page/new.html", gin.H{
 		"user": user,
 	})
 }
 
-func PageCreate(c *gin.Context) {
+func (h *Handler) PageCreate(c *gin.Context) {
 	var PageForm forms.PageFrom
 	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
 		v.RegisterValidation("CheckPublish", forms.CheckPublish)
@@ -52,7 +53,7 @@ func PageCreate(c *gin.Context) {
 		Body:        PageForm.Body,
 		IsPublished: published,
 	}
-	err := page.Insert()
+	err := h.Pages.Insert(page)
 	if err != nil {
 		seelog.Error("[PageCreate]insert page err", err)
 		HtmlSuccess(c, "page/new.html", gin.H{
@@ -65,11 +66,12 @@ func PageCreate(c *gin.Context) {
 
 }
 
-func PageEdit(c *gin.Context) {
-	page, err := models.GetPageById(c.Param("id"))
+func (h *Handler) PageEdit(c *gin.Context) {
+	page, err := h.Pages.GetById(c.Param("id"))
 	if err != nil {
 		seelog.Error("[PageEdit]get page by id err", err)
 		Handle404(c)
+		return
 	}
 	user, _ := c.Get(ContextUserKey)
 	HtmlSuccess(c, "page/modify.html", gin.H{
@@ -78,7 +80,7 @@ func PageEdit(c *gin.Context) {
 	})
 }
 
-func PageUpdate(c *gin.Context) {
+func (h *Handler) PageUpdate(c *gin.Context) {
 	var PageForm forms.PageFrom
 	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
 		v.RegisterValidation("CheckPublish", forms.CheckPublish)
@@ -97,7 +99,7 @@ func PageUpdate(c *gin.Context) {
 	}
 	page := &models.Page{Title: PageForm.Title, Body: PageForm.Body, IsPublished: published}
 	page.ID = uint(pid)
-	err = page.Update()
+	err = h.Pages.Update(page)
 	if err != nil {
 		seelog.Error("[PageUpdate]update page err", err)
 		c.AbortWithError(http.StatusInternalServerError, err)
@@ -106,21 +108,21 @@ func PageUpdate(c *gin.Context) {
 	c.Redirect(http.StatusMovedPermanently, "/admin/page")
 }
 
-func PagePublish(c *gin.Context) {
+func (h *Handler) PagePublish(c *gin.Context) {
 	var (
 		err error
 		res = gin.H{}
 	)
 	defer WriteJSON(c, res)
-	page, err := models.GetPageById(c.Param("id"))
-	if err == nil {
+	page, err := h.Pages.GetById(c.Param("id"))
+	if err != nil {
 		seelog.Error("[PagePublish]get page by id err", err)
 		res["message"] = err.Error()
 		return
 	}
 	page.IsPublished = !page.IsPublished
-	err = page.Update()
-	if err == nil {
+	err = h.Pages.Update(page)
+	if err != nil {
 		seelog.Error("[PagePublish]update page err", err)
 		res["message"] = err.Error()
 		return
@@ -128,7 +130,7 @@ func PagePublish(c *gin.Context) {
 	res["succeed"] = true
 }
 
-func PageDelete(c *gin.Context) {
+func (h *Handler) PageDelete(c *gin.Context) {
 	var (
 		err error
 		res = gin.H{}
@@ -139,9 +141,7 @@ func PageDelete(c *gin.Context) {
 		res["message"] = err.Error()
 		return
 	}
-	page := &models.Page{}
-	page.ID = uint(pid)
-	err = page.Delete()
+	err = h.Pages.Delete(uint(pid))
 	if err != nil {
 		seelog.Error("[PageDelete]delete page err", err)
 		res["message"] = err.Error()
@@ -150,12 +150,12 @@ func PageDelete(c *gin.Context) {
 	res["succeed"] = true
 }
 
-func PageIndex(c *gin.Context) {
-	pages, _ := models.ListAllPage()
+func (h *Handler) PageIndex(c *gin.Context) {
+	pages, _ := h.Pages.ListAll()
 	user, _ := c.Get(ContextUserKey)
 	HtmlSuccess(c, "admin/page.html", gin.H{
 		"pages":    pages,
 		"user":     user,
-		"comments": models.MustListUnreadComment(),
+		"comments": h.mustListUnreadComment(),
 	})
 }
@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"blog/models"
+)
+
+// 从查询参数page、page_size和cursor解析分页，page_size为空时使用defaultSize
+func parsePagination(c *gin.Context, defaultSize int) *models.Pagination {
+	page, _ := strconv.Atoi(c.Query("page"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	return models.NewPagination(page, pageSize, defaultSize, c.Query("cursor"))
+}
+
+// 游标无效时返回400，其他查询错误返回500
+func abortListError(c *gin.Context, err error) {
+	if err == models.ErrInvalidCursor {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	c.AbortWithStatus(http.StatusInternalServerError)
+}
+
+// JSON列表接口的响应：data为当前页，pagination包括页码分页的总数和下一页的游标，新增的列表接口都使用该格式
+func writeList(res gin.H, data interface{}, pagination *models.Pagination) {
+	res["data"] = data
+	res["pagination"] = pagination
+	res["succeed"] = true
+}
+
+// 页面中的分页导航，翻页时保留当前地址的其他查询参数。
+// keyset为true时下一页使用游标，用于后台等数据变化较快的列表，前台列表使用页码以保持地址稳定
+type pager struct {
+	*models.Pagination
+	url    url.URL
+	keyset bool
+}
+
+func newPager(c *gin.Context, pagination *models.Pagination, keyset bool) *pager {
+	return &pager{Pagination: pagination, url: *c.Request.URL, keyset: keyset}
+}
+
+func (p *pager) PageURL(page int) string {
+	return p.with(func(query url.Values) {
+		query.Del("cursor")
+		if page > 1 {
+			query.Set("page", strconv.Itoa(page))
+		} else {
+			query.Del("page")
+		}
+	})
+}
+
+func (p *pager) PrevURL() string {
+	return p.PageURL(p.Page - 1)
+}
+
+func (p *pager) NextURL() string {
+	if !p.keyset && p.Cursor == "" {
+		return p.PageURL(p.Page + 1)
+	}
+	return p.with(func(query url.Values) {
+		query.Del("page")
+		query.Set("cursor", p.NextCursor)
+	})
+}
+
+func (p *pager) with(change func(query url.Values)) string {
+	u := p.url
+	query := u.Query()
+	change(query)
+	u.RawQuery = query.Encode()
+	return u.RequestURI()
+}
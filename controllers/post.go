@@ -2,190 +2,200 @@ package controllers
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"blog/models"
+	"blog/related"
 	"github.com/cihub/seelog"
 	"blog/forms"
+	"blog/system"
 	. "blog/helpers"
 	"github.com/gin-gonic/gin/binding"
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
 	"github.com/go-playground/validator/v10"
 )
 
-func PostGet(c *gin.Context) {
+func (h *Handler) PostGet(c *gin.Context) {
 	id := c.Param("id")
-	post, err := models.GetPostById(id)
+	post, err := h.Posts.GetById(id)
 	if err != nil || !post.IsPublished {
 		seelog.Error("[PostGet]get post by id err", err)
 		Handle404(c)
 		return
 	}
 	post.View++
-	post.UpdateView()
-	post.Tags, _ = models.ListTagByPostId(id)
-	post.Comments, _ = models.ListCommentByPostID(id)
+	h.Posts.UpdateView(post)
+	post.Tags, _ = h.Tags.ListByPostId(post.ID)
+	post.Comments, _ = h.Comments.ListByPostId(post.ID)
+	relatedPosts, _ := h.Posts.ListRelated(post.ID)
+	breadcrumbs := models.CategoryPath(h.mustListCategories(), post.CategoryId)
+	if len(breadcrumbs) > 0 {
+		post.Category = breadcrumbs[len(breadcrumbs)-1]
+	}
 	user, _ := c.Get(ContextUserKey)
 	HtmlSuccess(c, "post/display.html", gin.H{
 		"post": post,
+		"breadcrumbs": breadcrumbs,
+		"series": h.postSeries(post),
+		"related": relatedPosts,
+		"images": h.responsiveImages(post.Body),
 		"user": user,
 	})
 }
 
-func PostNew(c *gin.Context) {
-	tags, _ := models.ListAllTag()
-	user, _ := c.Get(ContextUserKey)
-	HtmlSuccess(c, "post/new.html", gin.H{
-		"user": user,
-		"tags": tags,
-	})
+func (h *Handler) PostNew(c *gin.Context) {
+	h.renderPostForm(c, "post/new.html", &models.Post{}, nil, "")
 }
 
-func PostCreate(c *gin.Context) {
-	var PageForm forms.PageFrom
-	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
-		v.RegisterValidation("CheckPublish", forms.CheckPublish)
-	}
-	if err := c.ShouldBind(&PageForm); err != nil {
+func (h *Handler) PostCreate(c *gin.Context) {
+	post := &models.Post{}
+	tagIds, err := bindPostForm(c, post)
+	if err != nil {
 		seelog.Error("[PostCreate]input param err", err)
-		c.AbortWithError(http.StatusInternalServerError, err)
+		h.renderPostForm(c, "post/new.html", post, tagIds, forms.ErrorMessage(err))
 		return
 	}
-	tags := c.PostForm("tags")
-	isPublished := PageForm.IsPublished
-	published := "on" == isPublished
-
-	post := &models.Post{
-		Title:       PageForm.Title,
-		Body:        PageForm.Body,
-		IsPublished: published,
-	}
-	err := post.Insert()
-	if err != nil {
-		seelog.Error("[PostCreate]insert post err", err)
-		user, _ := c.Get(ContextUserKey)
-		HtmlSuccess(c, "post/new.html", gin.H{
-			"post":    post,
-			"message": err.Error(),
-			"user": user,
-		})
+	if err = h.Posts.Save(post, tagIds, parseTagNames(c.PostForm("newTags"))); err != nil {
+		seelog.Error("[PostCreate]save post err", err)
+		h.renderPostForm(c, "post/new.html", post, tagIds, savePostMessage(err))
 		return
 	}
-
-	// add tag for post
-	if len(tags) > 0 {
-		tagArr := strings.Split(tags, ",")
-		for _, tag := range tagArr {
-			tagId, err := ParseIdToUint(tag, "PostCreate")
-			if err != nil {
-				continue
-			}
-			pt := &models.PostTag{
-				PostId: post.ID,
-				TagId:  uint(tagId),
-			}
-			pt.Insert()
-		}
+	related.Refresh()
+	if post.IsPublished {
+		go h.notifySubscribers(post)
 	}
 	c.Redirect(http.StatusMovedPermanently, "/admin/post")
 }
 
-func PostEdit(c *gin.Context) {
-	post, err := models.GetPostById(c.Param("id"))
+func (h *Handler) PostEdit(c *gin.Context) {
+	post, err := h.Posts.GetById(c.Param("id"))
 	if err != nil {
 		seelog.Error("[PostEdit]get post by id err", err)
 		Handle404(c)
 		return
 	}
-	tags, _ := models.ListAllTag()
-	user, _ := c.Get(ContextUserKey)
-	HtmlSuccess(c, "post/modify.html", gin.H{
-		"post": post,
-		"tags": tags,
-		"user": user,
-	})
+	tags, _ := h.Tags.ListByPostId(post.ID)
+	tagIds := make([]uint, len(tags))
+	for i, tag := range tags {
+		tagIds[i] = tag.ID
+	}
+	h.renderPostForm(c, "post/modify.html", post, tagIds, "")
 }
 
-func PostUpdate(c *gin.Context) {
-	var PageForm forms.PageFrom
-	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
-		v.RegisterValidation("CheckPublish", forms.CheckPublish)
-	}
-	if err := c.ShouldBind(&PageForm); err != nil {
-		seelog.Error("[PostCreate]input param err", err)
-		c.AbortWithError(http.StatusInternalServerError, err)
+func (h *Handler) PostUpdate(c *gin.Context) {
+	// 保存前的发布状态，由草稿改为发布时与PostPublish一样通知订阅者
+	stored, err := h.Posts.GetById(c.Param("id"))
+	if err != nil {
+		Handle404(c)
 		return
 	}
-	tags := c.PostForm("tags")
-	published := "on" == PageForm.IsPublished
-
-	pid, err := ParseIdToUint(c.Param("id"), "PostUpdate")
+	post := &models.Post{}
+	post.ID = stored.ID
+	tagIds, err := bindPostForm(c, post)
 	if err != nil {
-		Handle404(c)
+		seelog.Error("[PostUpdate]input param err", err)
+		h.renderPostForm(c, "post/modify.html", post, tagIds, forms.ErrorMessage(err))
 		return
 	}
-
-	post := &models.Post{
-		Title:       PageForm.Title,
-		Body:        PageForm.Body,
-		IsPublished: published,
+	if err = h.Posts.Save(post, tagIds, parseTagNames(c.PostForm("newTags"))); err == gorm.ErrRecordNotFound {
+		Handle404(c)
+		return
 	}
-	post.ID = uint(pid)
-	err = post.Update()
 	if err != nil {
-		seelog.Error("[PostUpdate]update post err", err)
-		user, _ := c.Get(ContextUserKey)
-		HtmlSuccess(c, "post/modify.html", gin.H{
-			"post":    post,
-			"message": err.Error(),
-			"user": user,
-		})
+		seelog.Error("[PostUpdate]save post err", err)
+		h.renderPostForm(c, "post/modify.html", post, tagIds, savePostMessage(err))
 		return
 	}
-	// 删除tag
-	models.DeletePostTagByPostId(post.ID)
-	// 添加tag
-	if len(tags) > 0 {
-		tagArr := strings.Split(tags, ",")
-		for _, tag := range tagArr {
-			tagId, err := ParseIdToUint(tag, "PostUpdate")
-			if err != nil {
-				continue
-			}
-			pt := &models.PostTag{
-				PostId: post.ID,
-				TagId:  uint(tagId),
-			}
-			pt.Insert()
-		}
+	related.Refresh()
+	if post.IsPublished && !stored.IsPublished {
+		go h.notifySubscribers(post)
 	}
 	c.Redirect(http.StatusMovedPermanently, "/admin/post")
 }
 
-func PostPublish(c *gin.Context) {
+// 将表单内容填入post，校验失败时post和tagIds仍包含已填写的内容，用于重新显示表单
+func bindPostForm(c *gin.Context, post *models.Post) ([]uint, error) {
+	var PageForm forms.PageFrom
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterValidation("CheckPublish", forms.CheckPublish)
+	}
+	err := c.ShouldBind(&PageForm)
+	post.Title = PageForm.Title
+	post.Body = PageForm.Body
+	post.IsPublished = "on" == PageForm.IsPublished
+	tagIds, tagErr := parseTagIds(c.PostForm("tags"))
+	if err == nil {
+		err = tagErr
+	}
+	categoryId, categoryErr := parseOptionalId(c.PostForm("categoryId"))
+	post.CategoryId = categoryId
+	if err == nil && categoryErr != nil {
+		err = errors.New("分类格式不正确")
+	}
+	return tagIds, err
+}
+
+// 渲染文章编辑表单，保留已填写的内容和选中的标签
+func (h *Handler) renderPostForm(c *gin.Context, name string, post *models.Post, tagIds []uint, message string) {
+	tags, _ := h.Tags.ListAll()
+	categories, _ := h.Categories.ListAll()
+	selected := make(map[uint]bool, len(tagIds))
+	for _, tagId := range tagIds {
+		selected[tagId] = true
+	}
+	user, _ := c.Get(ContextUserKey)
+	HtmlSuccess(c, name, gin.H{
+		"post":       post,
+		"tags":       tags,
+		"categories": categories,
+		"selected":   selected,
+		"newTags":    c.PostForm("newTags"),
+		"message":    message,
+		"user":       user,
+	})
+}
+
+func savePostMessage(err error) string {
+	if err == models.ErrTagNotFound {
+		return "所选标签不存在，请刷新后重新选择"
+	}
+	if err == models.ErrCategoryNotFound {
+		return "所选分类不存在，请刷新后重新选择"
+	}
+	return err.Error()
+}
+
+func (h *Handler) PostPublish(c *gin.Context) {
 	var (
 		err  error
 		res  = gin.H{}
 		post *models.Post
 	)
 	defer WriteJSON(c, res)
-	post, err = models.GetPostById(c.Param("id"))
+	post, err = h.Posts.GetById(c.Param("id"))
 	if err != nil {
 		seelog.Error("[PostPublish]get post by id err", err)
 		res["message"] = err.Error()
 		return
 	}
 	post.IsPublished = !post.IsPublished
-	err = post.Update()
+	err = h.Posts.Update(post)
 	if err != nil {
 		seelog.Error("[PostPublish]update post err", err)
 		res["message"] = err.Error()
 		return
 	}
+	related.Refresh()
+	if post.IsPublished {
+		go h.notifySubscribers(post)
+	}
 	res["succeed"] = true
 }
 
-func PostDelete(c *gin.Context) {
+func (h *Handler) PostDelete(c *gin.Context) {
 	var (
 		err error
 		res = gin.H{}
@@ -196,24 +206,67 @@ func PostDelete(c *gin.Context) {
 		res["message"] = err.Error()
 		return
 	}
-	post := &models.Post{}
-	post.ID = uint(pid)
-	err = post.Delete()
+	err = h.Posts.Delete(uint(pid))
 	if err != nil {
 		seelog.Error("[PostDelete]delete post err", err)
 		res["message"] = err.Error()
 		return
 	}
-	models.DeletePostTagByPostId(uint(pid))
+	related.Refresh()
 	res["succeed"] = true
 }
 
-func PostIndex(c *gin.Context) {
-	posts, _ := models.ListAllPost("")
+func (h *Handler) PostIndex(c *gin.Context) {
+	pagination := parsePagination(c, system.GetConfiguration().AdminPageSize)
+	posts, err := h.Posts.ListAll("", pagination)
+	if err != nil {
+		seelog.Error("[PostIndex]list post err", err)
+		abortListError(c, err)
+		return
+	}
 	user, _ := c.Get(ContextUserKey)
 	HtmlSuccess(c, "admin/post.html", gin.H{
 		"posts":    posts,
+		"pager":    newPager(c, pagination, true),
 		"user":     user,
-		"comments": models.MustListUnreadComment(),
+		"comments": h.mustListUnreadComment(),
 	})
 }
+
+// 表单中以逗号分隔的标签id
+func parseTagIds(tags string) ([]uint, error) {
+	tagIds, err := parseIds(tags)
+	if err != nil {
+		return tagIds, errors.New("标签格式不正确")
+	}
+	return tagIds, nil
+}
+
+// 以逗号分隔的id，保留顺序，出错时返回已解析的部分
+func parseIds(value string) ([]uint, error) {
+	var ids []uint
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(item, 10, 64)
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+// 编辑文章时新输入的标签名，以中英文逗号分隔
+func parseTagNames(names string) []string {
+	var tagNames []string
+	for _, name := range strings.FieldsFunc(names, func(r rune) bool {
+		return r == ',' || r == '，'
+	}) {
+		if name = strings.TrimSpace(name); name != "" {
+			tagNames = append(tagNames, name)
+		}
+	}
+	return tagNames
+}
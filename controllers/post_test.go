@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"blog/models"
+)
+
+func TestPostUpdate(t *testing.T) {
+	s := newTestServer(t)
+	tag := s.addTag(t, "go")
+	post := s.addPost(t, &models.Post{Title: "title", Body: "body"}, tag.ID)
+	target := fmt.Sprintf("/admin/post/%d/edit", post.ID)
+	form := func(tags, categoryId string) url.Values {
+		return url.Values{"title": {"new title"}, "body": {"new body"}, "isPublished": {"on"},
+			"tags": {tags}, "categoryId": {categoryId}, "newTags": {"gorm，go"}}
+	}
+
+	tests := []struct {
+		tags, categoryId string
+		message          string
+	}{
+		{"9999", "", savePostMessage(models.ErrTagNotFound)},
+		{strconv.Itoa(int(tag.ID)), "9999", savePostMessage(models.ErrCategoryNotFound)},
+	}
+	for _, test := range tests {
+		w := s.post(target, form(test.tags, test.categoryId))
+		if w.Code != http.StatusOK || s.html.name != "post/modify.html" || s.html.data["message"] != test.message {
+			t.Errorf("tags %s, category %s: %d %s %v, want message %s", test.tags, test.categoryId,
+				w.Code, s.html.name, s.html.data["message"], test.message)
+		}
+		// 表单保留已填写的内容
+		if rendered := s.html.data["post"].(*models.Post); rendered.Title != "new title" {
+			t.Errorf("form title = %s", rendered.Title)
+		}
+	}
+	if stored, _ := s.repos.Posts.GetById(strconv.Itoa(int(post.ID))); stored.Title != "title" {
+		t.Errorf("failed update changed the title to %s", stored.Title)
+	}
+
+	if w := s.post("/admin/post/9999/edit", form("", "")); w.Code != http.StatusNotFound {
+		t.Errorf("updating a missing post = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	category := s.addCategory(t, "Backend", "backend", 0)
+	w := s.post(target, form(strconv.Itoa(int(tag.ID)), strconv.Itoa(int(category.ID))))
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/admin/post" {
+		t.Fatalf("update = %d %s", w.Code, w.Header().Get("Location"))
+	}
+	stored, _ := s.repos.Posts.GetById(strconv.Itoa(int(post.ID)))
+	if stored.Title != "new title" || !stored.IsPublished || stored.PublishedAt == nil || stored.CategoryId != category.ID {
+		t.Errorf("stored post = %+v", stored)
+	}
+	tags, _ := s.repos.Tags.ListByPostId(post.ID)
+	if len(tags) != 2 {
+		t.Errorf("tags after update = %v, want go and gorm", tags)
+	}
+}
+
+// 编辑时由草稿改为发布才通知订阅者，已发布的文章再次保存不重复通知
+func TestPostUpdateNotifiesSubscribers(t *testing.T) {
+	s := newTestServer(t)
+	s.addSubscriber(t, "reader@example.com")
+	post := s.addPost(t, &models.Post{Title: "draft", Body: "body"})
+	target := fmt.Sprintf("/admin/post/%d/edit", post.ID)
+	form := url.Values{"title": {"published"}, "body": {"body"}, "isPublished": {"on"}}
+
+	if w := s.post(target, form); w.Code != http.StatusMovedPermanently {
+		t.Fatalf("publish by update = %d", w.Code)
+	}
+	messages := sentMails(t, 1)
+	if len(messages) != 1 || messages[0].To[0] != "reader@example.com" || messages[0].Subject != "[blog]published" {
+		t.Fatalf("mails after publishing = %v", messages)
+	}
+
+	form.Set("title", "edited")
+	if w := s.post(target, form); w.Code != http.StatusMovedPermanently {
+		t.Fatalf("update published post = %d", w.Code)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if messages = sentMails(t, 1); len(messages) != 1 {
+		t.Errorf("updating a published post sent %d mails, want none", len(messages)-1)
+	}
+}
+
+// 只测试取消发布，发布时会在后台通知订阅者
+func TestPostPublish(t *testing.T) {
+	s := newTestServer(t)
+	post := s.addPost(t, &models.Post{Title: "title", IsPublished: true})
+
+	if succeed, message := s.postJSON(t, fmt.Sprintf("/admin/post/%d/publish", post.ID), nil); !succeed {
+		t.Fatalf("unpublish failed: %s", message)
+	}
+	stored, _ := s.repos.Posts.GetById(strconv.Itoa(int(post.ID)))
+	if stored.IsPublished || stored.PublishedAt != nil {
+		t.Errorf("stored post is published %v at %v", stored.IsPublished, stored.PublishedAt)
+	}
+	if succeed, _ := s.postJSON(t, "/admin/post/9999/publish", nil); succeed {
+		t.Error("publishing a missing post succeeded")
+	}
+}
+
+func TestPostGet(t *testing.T) {
+	s := newTestServer(t)
+	backend := s.addCategory(t, "Backend", "backend", 0)
+	golang := s.addCategory(t, "Go", "go", backend.ID)
+	first := s.addPost(t, &models.Post{Title: "first", IsPublished: true, CategoryId: golang.ID})
+	draft := s.addPost(t, &models.Post{Title: "draft"})
+	series := &models.Series{Title: "Gin", Slug: "gin"}
+	if err := s.repos.Series.Save(series, []uint{first.ID, draft.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := s.get(fmt.Sprintf("/post/%d", draft.ID)); w.Code != http.StatusNotFound {
+		t.Errorf("draft = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := s.get(fmt.Sprintf("/post/%d", first.ID)); w.Code != http.StatusOK || s.html.name != "post/display.html" {
+		t.Fatalf("post = %d %s", w.Code, s.html.name)
+	}
+	breadcrumbs := s.html.data["breadcrumbs"].([]*models.Category)
+	if len(breadcrumbs) != 2 || breadcrumbs[1].Path != "/category/backend/go" {
+		t.Errorf("breadcrumbs = %v", breadcrumbs)
+	}
+	// 系列导航只包括已发布的文章
+	rendered := s.html.data["series"].(*models.Series)
+	if rendered == nil || len(rendered.Posts) != 1 || rendered.Part(first.ID) != 1 {
+		t.Errorf("series = %+v", rendered)
+	}
+	if stored, _ := s.repos.Posts.GetById(strconv.Itoa(int(first.ID))); stored.View != 1 {
+		t.Errorf("view = %d, want 1", stored.View)
+	}
+}
@@ -7,11 +7,10 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/feeds"
 	"blog/helpers"
-	"blog/models"
 	"blog/system"
 )
 
-func RssGet(c *gin.Context) {
+func (h *Handler) RssGet(c *gin.Context) {
 	now := helpers.GetCurrentTime()
 	domain := system.GetConfiguration().Domain
 	feed := &feeds.Feed{
@@ -23,7 +22,7 @@ func RssGet(c *gin.Context) {
 	}
 
 	feed.Items = make([]*feeds.Item, 0)
-	posts, err := models.ListPublishedPost("", 0, 0)
+	posts, err := h.Posts.ListPublished("", nil)
 	if err != nil {
 		seelog.Error("[RssGet]list publish post err", err)
 		return
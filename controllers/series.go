@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"blog/models"
+	. "blog/helpers"
+	"github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+// 系列页，按顺序列出系列中已发布的文章
+func (h *Handler) SeriesGet(c *gin.Context) {
+	series, err := h.Series.GetBySlug(c.Param("slug"))
+	if err != nil {
+		seelog.Error("[SeriesGet]get series by slug err", err)
+		Handle404(c)
+		return
+	}
+	series.Posts, err = h.Series.ListPosts(series.ID, true)
+	if err != nil {
+		seelog.Error("[SeriesGet]list series post err", err)
+	}
+	user, _ := c.Get(ContextUserKey)
+	HtmlSuccess(c, "series/display.html", gin.H{
+		"series": series,
+		"user":   user,
+	})
+}
+
+// 文章所属的系列及其中已发布的文章，用于文章页的系列导航；不属于系列或文章未发布时返回nil
+func (h *Handler) postSeries(post *models.Post) *models.Series {
+	series, err := h.Series.GetByPostId(post.ID)
+	if err != nil {
+		return nil
+	}
+	if series.Posts, err = h.Series.ListPosts(series.ID, true); err != nil {
+		seelog.Error("[postSeries]list series post err", err)
+		return nil
+	}
+	if series.Part(post.ID) == 0 {
+		return nil
+	}
+	return series
+}
+
+func (h *Handler) SeriesIndex(c *gin.Context) {
+	list, _ := h.Series.ListAll()
+	for _, series := range list {
+		series.Posts, _ = h.Series.ListPosts(series.ID, false)
+	}
+	posts, _ := h.Posts.ListAll("", nil)
+	user, _ := c.Get(ContextUserKey)
+	HtmlSuccess(c, "admin/series.html", gin.H{
+		"series":   list,
+		"posts":    posts,
+		"user":     user,
+		"comments": h.mustListUnreadComment(),
+	})
+}
+
+func (h *Handler) SeriesCreate(c *gin.Context) {
+	var (
+		err     error
+		series  *models.Series
+		postIds []uint
+		res     = gin.H{}
+	)
+	defer WriteJSON(c, res)
+	series, postIds, err = bindSeriesForm(c)
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	err = h.Series.Save(series, postIds)
+	if err != nil {
+		seelog.Error("[SeriesCreate]save series err", err)
+		res["message"] = saveSeriesMessage(err)
+		return
+	}
+	res["succeed"] = true
+}
+
+func (h *Handler) SeriesUpdate(c *gin.Context) {
+	var (
+		id      uint64
+		err     error
+		series  *models.Series
+		postIds []uint
+		res     = gin.H{}
+	)
+	defer WriteJSON(c, res)
+	id, err = ParseIdToUint(c.Param("id"), "SeriesUpdate")
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	series, postIds, err = bindSeriesForm(c)
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	series.ID = uint(id)
+	err = h.Series.Save(series, postIds)
+	if err != nil {
+		seelog.Error("[SeriesUpdate]save series err", err)
+		res["message"] = saveSeriesMessage(err)
+		return
+	}
+	res["succeed"] = true
+}
+
+func (h *Handler) SeriesDelete(c *gin.Context) {
+	var (
+		err error
+		id  uint64
+		res = gin.H{}
+	)
+	defer WriteJSON(c, res)
+	id, err = ParseIdToUint(c.Param("id"), "SeriesDelete")
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	err = h.Series.Delete(uint(id))
+	if err != nil {
+		seelog.Error("[SeriesDelete]delete series err", err)
+		res["message"] = err.Error()
+		return
+	}
+	res["succeed"] = true
+}
+
+// 从表单读取标题、别名、介绍和按顺序以逗号分隔的文章id
+func bindSeriesForm(c *gin.Context) (*models.Series, []uint, error) {
+	series := &models.Series{
+		Title:       strings.TrimSpace(c.PostForm("title")),
+		Slug:        strings.ToLower(strings.TrimSpace(c.PostForm("slug"))),
+		Description: c.PostForm("description"),
+	}
+	if series.Title == "" {
+		return nil, nil, errors.New("请填写系列标题")
+	}
+	if !models.ValidSlug(series.Slug) {
+		return nil, nil, errors.New("别名只能包含小写字母、数字和连字符")
+	}
+	postIds, err := parseIds(c.PostForm("posts"))
+	if err != nil {
+		return nil, nil, errors.New("文章格式不正确")
+	}
+	return series, postIds, nil
+}
+
+func saveSeriesMessage(err error) string {
+	switch err {
+	case models.ErrSeriesSlugExists:
+		return "别名已被其他系列使用"
+	case models.ErrPostNotFound:
+		return "所选文章不存在，请刷新后重新选择"
+	}
+	return err.Error()
+}
@@ -0,0 +1,30 @@
+package controllers
+
+import (
+	"net/http"
+	"testing"
+
+	"blog/models"
+)
+
+// 系列页按顺序列出已发布的文章
+func TestSeriesGet(t *testing.T) {
+	s := newTestServer(t)
+	first := s.addPost(t, &models.Post{Title: "first", IsPublished: true})
+	draft := s.addPost(t, &models.Post{Title: "draft"})
+	second := s.addPost(t, &models.Post{Title: "second", IsPublished: true})
+	if err := s.repos.Series.Save(&models.Series{Title: "Gin", Slug: "gin"}, []uint{second.ID, draft.ID, first.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := s.get("/series/gin"); w.Code != http.StatusOK || s.html.name != "series/display.html" {
+		t.Fatalf("series = %d %s", w.Code, s.html.name)
+	}
+	series := s.html.data["series"].(*models.Series)
+	if len(series.Posts) != 2 || series.Posts[0].Title != "second" || series.Posts[1].Title != "first" {
+		t.Errorf("series posts = %v", series.Posts)
+	}
+	if w := s.get("/series/missing"); w.Code != http.StatusNotFound {
+		t.Errorf("missing series = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
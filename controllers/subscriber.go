@@ -1,8 +1,12 @@
 package controllers
 
 import (
+	"encoding/csv"
 	"fmt"
+	"mime/multipart"
 	"net/http"
+	"net/mail"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,22 +19,26 @@ import (
 	"blog/forms"
 	"github.com/gin-gonic/gin/binding"
 	"github.com/go-playground/validator/v10"
+	"github.com/jinzhu/gorm"
 )
 
-func SubscribeGet(c *gin.Context) {
-	count, _ := models.CountSubscriber()
+func (h *Handler) SubscribeGet(c *gin.Context) {
+	count := h.Subscribers.Count()
+	tags, _ := h.Tags.ListAll()
 	user, _ := c.Get(ContextUserKey)
 	HtmlSuccess(c, "other/subscribe.html", gin.H{
 		"user": user,
 		"total": count,
+		"tags": tags,
 	})
 }
 
-func Subscribe(c *gin.Context) {
+func (h *Handler) Subscribe(c *gin.Context) {
 	var (
 		err error
 		count int
 		mail string
+		frequency string
 		SubscribeForm forms.SubscribeForm
 	)
 	if e := c.ShouldBind(&SubscribeForm); e != nil {
@@ -38,21 +46,38 @@ func Subscribe(c *gin.Context) {
 		err = errors.New("input params error")
 		goto response
 	}
+	// 先检查标签，避免创建了订阅者或发送了激活邮件后才保存标签失败
+	if err = h.checkTags(SubscribeForm.Tags); err != nil {
+		err = errors.New(savePostMessage(err))
+		goto response
+	}
 	mail = SubscribeForm.Email
+	frequency = SubscribeForm.Frequency
+	if frequency == "" {
+		frequency = models.FrequencyImmediate
+	}
 	if len(mail) > 0 {
 		var subscriber *models.Subscriber
-		subscriber, err = models.GetSubscriberByEmail(mail)
+		subscriber, err = h.Subscribers.GetByEmail(mail)
 		if err == nil {
 			if !subscriber.VerifyState && GetCurrentTime().After(subscriber.OutTime) { //激活链接超时
-				err = sendActiveEmail(subscriber)
+				subscriber.Frequency = frequency
+				err = h.sendActiveEmail(subscriber)
+				if err == nil {
+					err = h.Subscribers.SetTags(subscriber.ID, SubscribeForm.Tags)
+				}
 				if err == nil {
-					count, _ = models.CountSubscriber()
+					count = h.Subscribers.Count()
 					err = errors.New("subscribe succeed")
 					goto response
 				}
 			} else if subscriber.VerifyState && !subscriber.SubscribeState { //已认证，未订阅
 				subscriber.SubscribeState = true
-				err = subscriber.Update()
+				subscriber.Frequency = frequency
+				err = h.Subscribers.Update(subscriber)
+				if err == nil {
+					err = h.Subscribers.SetTags(subscriber.ID, SubscribeForm.Tags)
+				}
 				if err == nil {
 					err = errors.New("subscribe succeed.")
 				}
@@ -61,13 +86,17 @@ func Subscribe(c *gin.Context) {
 			}
 		} else {
 			subscriber := &models.Subscriber{
-				Email: mail,
+				Email:     mail,
+				Frequency: frequency,
 			}
-			err = subscriber.Insert()
+			err = h.Subscribers.Insert(subscriber)
 			if err == nil {
-				err = sendActiveEmail(subscriber)
+				err = h.Subscribers.SetTags(subscriber.ID, SubscribeForm.Tags)
+			}
+			if err == nil {
+				err = h.sendActiveEmail(subscriber)
 				if err == nil {
-					count, _ = models.CountSubscriber()
+					count = h.Subscribers.Count()
 					err = errors.New("subscribe succeed")
 					goto response
 				}
@@ -76,17 +105,19 @@ func Subscribe(c *gin.Context) {
 	} else {
 		err = errors.New("empty mail address.")
 	}
-	count, _ = models.CountSubscriber()
+	count = h.Subscribers.Count()
 	response:
+	tags, _ := h.Tags.ListAll()
 	user, _ := c.Get(ContextUserKey)
 	HtmlSuccess(c, "other/subscribe.html", gin.H{
 		"message": err.Error(),
 		"total":   count,
 		"user": user,
+		"tags":    tags,
 	})
 }
 
-func sendActiveEmail(subscriber *models.Subscriber) (err error) {
+func (h *Handler) sendActiveEmail(subscriber *models.Subscriber) (err error) {
 	uuid := UUID()
 	duration, _ := time.ParseDuration("30m")
 	subscriber.OutTime = GetCurrentTime().Add(duration)
@@ -98,11 +129,11 @@ func sendActiveEmail(subscriber *models.Subscriber) (err error) {
 		seelog.Error("[sendActiveEmail]send active email err ", err)
 		return
 	}
-	err = subscriber.Update()
+	err = h.Subscribers.Update(subscriber)
 	return
 }
 
-func ActiveSubscriber(c *gin.Context) {
+func (h *Handler) ActiveSubscriber(c *gin.Context) {
 	var (
 		err        error
 		subscriber *models.Subscriber
@@ -112,7 +143,7 @@ func ActiveSubscriber(c *gin.Context) {
 		HandleMessage(c, http.StatusBadRequest, "激活链接有误，请重新获取！")
 		return
 	}
-	subscriber, err = models.GetSubscriberBySignature(sid)
+	subscriber, err = h.Subscribers.GetBySignature(sid)
 	if err != nil {
 		seelog.Error("[ActiveSubscriber]get subscriber by signature err", err)
 		HandleMessage(c, http.StatusBadRequest,"激活链接有误，请重新获取！")
@@ -124,7 +155,7 @@ func ActiveSubscriber(c *gin.Context) {
 	}
 	subscriber.VerifyState = true
 	subscriber.OutTime = GetCurrentTime()
-	err = subscriber.Update()
+	err = h.Subscribers.Update(subscriber)
 	if err != nil {
 		HandleMessage(c, http.StatusBadRequest, fmt.Sprintf("激活失败！%s", err.Error()))
 		return
@@ -132,68 +163,208 @@ func ActiveSubscriber(c *gin.Context) {
 	HandleMessage(c, http.StatusBadRequest, "激活成功！")
 }
 
-func UnSubscribe(c *gin.Context) {
-	sid := c.Query("sid")
-	if sid == "" {
-		HandleMessage(c, http.StatusBadRequest, "Internal Server Error!")
+// 退订确认页，GET请求不修改状态，避免邮件客户端预取链接时误退订
+func (h *Handler) UnSubscribeGet(c *gin.Context) {
+	token := c.Query("token")
+	subscriber, err := h.getSubscriberByToken(token)
+	if err != nil {
+		HandleMessage(c, http.StatusBadRequest, "退订链接有误！")
 		return
 	}
-	subscriber, err := models.GetSubscriberBySignature(sid)
-	if err != nil || !subscriber.VerifyState || !subscriber.SubscribeState {
+	user, _ := c.Get(ContextUserKey)
+	HtmlSuccess(c, "other/unsubscribe.html", gin.H{
+		"subscriber": subscriber,
+		"token":      token,
+		"user":       user,
+	})
+}
+
+// 退订，同时支持RFC 8058的一键退订（List-Unsubscribe=One-Click）
+func (h *Handler) UnSubscribe(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		token = c.PostForm("token")
+	}
+	subscriber, err := h.getSubscriberByToken(token)
+	if err != nil {
 		HandleMessage(c, http.StatusBadRequest, "Unsubscribe failed.")
 		return
 	}
-	subscriber.SubscribeState = false
-	err = subscriber.Update()
-	if err == nil {
-		HandleMessage(c, http.StatusBadRequest, fmt.Sprintf("Unscribe failed.%s", err.Error()))
+	if subscriber.SubscribeState {
+		subscriber.SubscribeState = false
+		err = h.Subscribers.Update(subscriber)
+		if err != nil {
+			seelog.Error("[UnSubscribe]update subscriber err", err)
+			HandleMessage(c, http.StatusInternalServerError, fmt.Sprintf("Unsubscribe failed.%s", err.Error()))
+			return
+		}
+	}
+	HandleMessage(c, http.StatusOK, "Unsubscribe Successful!")
+}
+
+// 订阅偏好设置页
+func (h *Handler) SubscriptionGet(c *gin.Context) {
+	token := c.Query("token")
+	subscriber, err := h.getSubscriberByToken(token)
+	if err != nil {
+		HandleMessage(c, http.StatusBadRequest, "链接有误！")
 		return
 	}
-	HandleMessage(c, http.StatusBadRequest, "Unsubscribe Successful!")
+	h.renderSubscription(c, subscriber, token, "")
 }
 
-func GetUnSubcribeUrl(subscriber *models.Subscriber) (string, error) {
-	uuid := UUID()
-	signature := Md5(subscriber.Email + uuid)
-	subscriber.SecretKey = uuid
-	subscriber.Signature = signature
-	err := subscriber.Update()
-	return fmt.Sprintf("%s/unsubscribe?sid=%s", system.GetConfiguration().Domain, signature), err
+func (h *Handler) SubscriptionPost(c *gin.Context) {
+	var PreferenceForm forms.PreferenceForm
+	if e := c.ShouldBind(&PreferenceForm); e != nil {
+		seelog.Error("[SubscriptionPost]validate err", e)
+		HandleMessage(c, http.StatusBadRequest, "input params error")
+		return
+	}
+	subscriber, err := h.getSubscriberByToken(PreferenceForm.Token)
+	if err != nil {
+		HandleMessage(c, http.StatusBadRequest, "链接有误！")
+		return
+	}
+	if err = h.checkTags(PreferenceForm.Tags); err != nil {
+		h.renderSubscription(c, subscriber, PreferenceForm.Token, savePostMessage(err))
+		return
+	}
+	subscriber.Frequency = PreferenceForm.Frequency
+	subscriber.SubscribeState = "on" == PreferenceForm.SubscribeState
+	err = h.Subscribers.Update(subscriber)
+	if err == nil {
+		err = h.Subscribers.SetTags(subscriber.ID, PreferenceForm.Tags)
+	}
+	message := "保存成功！"
+	if err != nil {
+		seelog.Error("[SubscriptionPost]update subscriber err", err)
+		message = err.Error()
+	}
+	h.renderSubscription(c, subscriber, PreferenceForm.Token, message)
+}
+
+// 订阅表单中的标签都存在时返回nil，否则返回ErrTagNotFound
+func (h *Handler) checkTags(tagIds []uint) error {
+	for _, tagId := range tagIds {
+		_, err := h.Tags.GetById(tagId)
+		if err == gorm.ErrRecordNotFound {
+			return models.ErrTagNotFound
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *Handler) renderSubscription(c *gin.Context, subscriber *models.Subscriber, token, message string) {
+	tags, _ := h.Tags.ListAll()
+	followed := make(map[uint]bool)
+	subscriberTags, _ := h.Subscribers.ListTags(subscriber.ID)
+	for _, tag := range subscriberTags {
+		followed[tag.ID] = true
+	}
+	user, _ := c.Get(ContextUserKey)
+	HtmlSuccess(c, "other/subscription.html", gin.H{
+		"subscriber": subscriber,
+		"tags":       tags,
+		"followed":   followed,
+		"token":      token,
+		"message":    message,
+		"user":       user,
+	})
+}
+
+// 订阅者令牌由id和HMAC签名组成，签名密钥为session_secret，
+// 不依赖数据库中会被激活流程改写的Signature，因此历史邮件中的链接始终有效
+func subscriberToken(subscriber *models.Subscriber) string {
+	id := strconv.FormatUint(uint64(subscriber.ID), 10)
+	return id + "." + HmacSign(fmt.Sprintf("subscriber:%s:%s", id, subscriber.Email))
+}
+
+func (h *Handler) getSubscriberByToken(token string) (*models.Subscriber, error) {
+	index := strings.Index(token, ".")
+	if index <= 0 {
+		return nil, errors.New("invalid token")
+	}
+	id, err := ParseIdToUint(token[:index], "getSubscriberByToken")
+	if err != nil {
+		return nil, err
+	}
+	subscriber, err := h.Subscribers.GetById(uint(id))
+	if err != nil {
+		return nil, err
+	}
+	if !HmacVerify(fmt.Sprintf("subscriber:%s:%s", token[:index], subscriber.Email), token[index+1:]) {
+		return nil, errors.New("invalid token")
+	}
+	return subscriber, nil
 }
 
-func sendEmailToSubscribers(subject, body string) (err error) {
+func GetUnSubcribeUrl(subscriber *models.Subscriber) string {
+	return fmt.Sprintf("%s/unsubscribe?token=%s", system.GetConfiguration().Domain, subscriberToken(subscriber))
+}
+
+func GetSubscriptionUrl(subscriber *models.Subscriber) string {
+	return fmt.Sprintf("%s/subscription?token=%s", system.GetConfiguration().Domain, subscriberToken(subscriber))
+}
+
+// 给订阅者发送邮件，附带偏好设置和退订链接，以及RFC 8058一键退订邮件头
+func sendSubscriberEmail(subscriber *models.Subscriber, subject, body string) error {
+	unsubscribeUrl := GetUnSubcribeUrl(subscriber)
+	body += fmt.Sprintf("<hr><p style=\"font-size: 12px; color: #999;\"><a href=\"%s\" target=\"_blank\">管理订阅</a> | <a href=\"%s\" target=\"_blank\">退订</a></p>", GetSubscriptionUrl(subscriber), unsubscribeUrl)
+	return SendEmailWithHeaders(subscriber.Email, subject, body, map[string]string{
+		"List-Unsubscribe":      "<" + unsubscribeUrl + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	})
+}
+
+func (h *Handler) sendEmailToSubscribers(subject, body string) (err error) {
 	var (
 		subscribers []*models.Subscriber
-		emails      = make([]string, 0)
 	)
-	subscribers, err = models.ListSubscriber(true)
+	subscribers, err = h.Subscribers.ListByState(models.SubscriberStateVerified, nil)
 	if err != nil {
 		seelog.Error("[sendEmailToSubscribers]list subscriber err", err)
 		return
 	}
-	for _, subscriber := range subscribers {
-		emails = append(emails, subscriber.Email)
-	}
-	if len(emails) == 0 {
+	if len(subscribers) == 0 {
 		err = errors.New("no subscribers!")
 		return
 	}
-	err = SendEmail(strings.Join(emails, ";"), subject, body)
+	for _, subscriber := range subscribers {
+		if e := sendSubscriberEmail(subscriber, subject, body); e != nil {
+			seelog.Errorf("[sendEmailToSubscribers]send email to %s err %v", subscriber.Email, e)
+			err = e
+		}
+	}
 	return
 }
 
-func SubscriberIndex(c *gin.Context) {
-	subscribers, _ := models.ListSubscriber(false)
+func (h *Handler) SubscriberIndex(c *gin.Context) {
+	state := c.Query("state")
+	pagination := parsePagination(c, system.GetConfiguration().AdminPageSize)
+	subscribers, err := h.Subscribers.ListByState(state, pagination)
+	if err != nil {
+		seelog.Error("[SubscriberIndex]list subscriber err", err)
+		abortListError(c, err)
+		return
+	}
+	for _, subscriber := range subscribers {
+		subscriber.Tags, _ = h.Subscribers.ListTags(subscriber.ID)
+	}
 	user, _ := c.Get(ContextUserKey)
 	c.HTML(http.StatusOK, "admin/subscriber.html", gin.H{
 		"subscribers": subscribers,
+		"pager":       newPager(c, pagination, true),
+		"state":       state,
 		"user":        user,
-		"comments":    models.MustListUnreadComment(),
+		"comments":    h.mustListUnreadComment(),
 	})
 }
 
 // 邮箱为空时，发送给所有订阅者
-func SubscriberPost(c *gin.Context) {
+func (h *Handler) SubscriberPost(c *gin.Context) {
 	var (
 		err error
 		res = gin.H{}
@@ -214,7 +385,7 @@ func SubscriberPost(c *gin.Context) {
 	if len(mail) > 0 {
 		err = SendEmail(mail, subject, body)
 	} else {
-		err = sendEmailToSubscribers(subject, body)
+		err = h.sendEmailToSubscribers(subject, body)
 	}
 	if err != nil {
 		seelog.Error("[SubscriberPost]send email fail", err)
@@ -223,3 +394,126 @@ func SubscriberPost(c *gin.Context) {
 	}
 	res["succeed"] = true
 }
+
+// 订阅者CSV文件的列
+var subscriberCSVHeader = []string{"email", "verify_state", "subscribe_state", "frequency", "tags", "created_at"}
+
+// 导出订阅者为CSV，标签以"|"分隔
+func (h *Handler) SubscriberExport(c *gin.Context) {
+	subscribers, err := h.Subscribers.ListByState(c.Query("state"), nil)
+	if err != nil {
+		seelog.Error("[SubscriberExport]list subscriber err", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=subscribers_%s.csv", GetCurrentTime().Format("20060102150405")))
+	w := csv.NewWriter(c.Writer)
+	w.Write(subscriberCSVHeader)
+	for _, subscriber := range subscribers {
+		tags, _ := h.Subscribers.ListTags(subscriber.ID)
+		tagNames := make([]string, 0, len(tags))
+		for _, tag := range tags {
+			tagNames = append(tagNames, tag.Name)
+		}
+		w.Write([]string{
+			subscriber.Email,
+			strconv.FormatBool(subscriber.VerifyState),
+			strconv.FormatBool(subscriber.SubscribeState),
+			subscriber.Frequency,
+			strings.Join(tagNames, "|"),
+			subscriber.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	w.Flush()
+	if err = w.Error(); err != nil {
+		seelog.Error("[SubscriberExport]write csv err", err)
+	}
+}
+
+// 从CSV导入订阅者，已存在的邮箱会被更新，保留文件中的激活和订阅状态
+func (h *Handler) SubscriberImport(c *gin.Context) {
+	var (
+		err      error
+		res      = gin.H{}
+		file     multipart.File
+		records  [][]string
+		imported int
+		skipped  int
+	)
+	defer WriteJSON(c, res)
+	file, _, err = c.Request.FormFile("file")
+	if err != nil {
+		seelog.Error("[SubscriberImport]get file err", err)
+		res["message"] = err.Error()
+		return
+	}
+	defer file.Close()
+	records, err = csv.NewReader(file).ReadAll()
+	if err != nil {
+		seelog.Error("[SubscriberImport]read csv err", err)
+		res["message"] = err.Error()
+		return
+	}
+	if len(records) == 0 {
+		res["message"] = "empty csv file."
+		return
+	}
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["email"]; !ok {
+		res["message"] = "csv file must contain an email column."
+		return
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	for _, record := range records[1:] {
+		email := field(record, "email")
+		if _, e := mail.ParseAddress(email); e != nil {
+			skipped++
+			continue
+		}
+		subscriber := &models.Subscriber{Email: email}
+		if err = h.Subscribers.Insert(subscriber); err != nil {
+			seelog.Errorf("[SubscriberImport]insert subscriber %s err %v", email, err)
+			skipped++
+			continue
+		}
+		subscriber.VerifyState, _ = strconv.ParseBool(field(record, "verify_state"))
+		subscriber.SubscribeState, _ = strconv.ParseBool(field(record, "subscribe_state"))
+		subscriber.Frequency = field(record, "frequency")
+		switch subscriber.Frequency {
+		case models.FrequencyImmediate, models.FrequencyDaily, models.FrequencyWeekly:
+		default:
+			subscriber.Frequency = models.FrequencyImmediate
+		}
+		if err = h.Subscribers.Update(subscriber); err != nil {
+			seelog.Errorf("[SubscriberImport]update subscriber %s err %v", email, err)
+			skipped++
+			continue
+		}
+		tagIds := make([]uint, 0)
+		for _, name := range strings.Split(field(record, "tags"), "|") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			tag := &models.Tag{Name: name}
+			if err = h.Tags.Insert(tag); err == nil {
+				tagIds = append(tagIds, tag.ID)
+			}
+		}
+		if err = h.Subscribers.SetTags(subscriber.ID, tagIds); err != nil {
+			seelog.Errorf("[SubscriberImport]set subscriber %s tags err %v", email, err)
+		}
+		imported++
+	}
+	res["imported"] = imported
+	res["skipped"] = skipped
+	res["succeed"] = true
+}
@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+
+	"blog/models"
+)
+
+// 订阅时选择了不存在的标签，不创建订阅者
+func TestSubscribeMissingTag(t *testing.T) {
+	s := newTestServer(t)
+	tag := s.addTag(t, "go")
+
+	s.post("/subscribe", url.Values{"email": {"gopher@example.com"}, "tags": {strconv.Itoa(int(tag.ID)), "9999"}})
+	if message := s.html.data["message"]; message != savePostMessage(models.ErrTagNotFound) {
+		t.Errorf("message = %v", message)
+	}
+	if _, err := s.repos.Subscribers.GetByEmail("gopher@example.com"); err != gorm.ErrRecordNotFound {
+		t.Errorf("subscriber with a missing tag = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+}
+
+// 修改订阅设置时选择了不存在的标签，不修改已有的设置
+func TestSubscriptionPostMissingTag(t *testing.T) {
+	s := newTestServer(t)
+	tag := s.addTag(t, "go")
+	subscriber := s.addSubscriber(t, "gopher@example.com")
+	if err := s.repos.Subscribers.SetTags(subscriber.ID, []uint{tag.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	form := url.Values{"token": {subscriberToken(subscriber)}, "frequency": {models.FrequencyWeekly}, "tags": {"9999"}}
+	s.post("/subscription", form)
+	if message := s.html.data["message"]; message != savePostMessage(models.ErrTagNotFound) {
+		t.Errorf("message = %v", message)
+	}
+	stored, _ := s.repos.Subscribers.GetById(subscriber.ID)
+	if stored.Frequency != models.FrequencyImmediate {
+		t.Errorf("frequency = %s, want %s", stored.Frequency, models.FrequencyImmediate)
+	}
+	if tags, _ := s.repos.Subscribers.ListTags(subscriber.ID); len(tags) != 1 || tags[0].ID != tag.ID {
+		t.Errorf("tags = %v, want [go]", tags)
+	}
+}
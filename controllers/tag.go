@@ -1,28 +1,35 @@
 package controllers
 
 import (
-	"net/http"
-	"strconv"
-
-	"math"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/microcosm-cc/bluemonday"
 	"github.com/russross/blackfriday"
 	"blog/models"
+	"blog/related"
 	"blog/system"
 	. "blog/helpers"
 	"github.com/cihub/seelog"
 )
 
-func TagCreate(c *gin.Context) {
+func (h *Handler) TagCreate(c *gin.Context) {
 	var (
 		err error
 		res = gin.H{}
 	)
 	defer WriteJSON(c, res)
-	tag := &models.Tag{Name: c.PostForm("name")}
-	err = tag.Insert()
+	name := strings.TrimSpace(c.PostForm("name"))
+	if len(name) == 0 {
+		res["message"] = "error parameter"
+		return
+	}
+	tag := &models.Tag{
+		Name:        name,
+		Description: c.PostForm("description"),
+		Cover:       c.PostForm("cover"),
+	}
+	err = h.Tags.Insert(tag)
 	if err != nil {
 		seelog.Error("[TagCreate]insert tag err", err)
 		res["message"] = err.Error()
@@ -31,14 +38,14 @@ func TagCreate(c *gin.Context) {
 	res["succeed"] = true
 }
 
-func TagUpdate(c *gin.Context) {
+func (h *Handler) TagUpdate(c *gin.Context) {
 	var (
 		id   uint64
 		err   error
 		res   = gin.H{}
 	)
 	defer WriteJSON(c, res)
-	name := c.PostForm("name")
+	name := strings.TrimSpace(c.PostForm("name"))
 	if len(name) == 0 {
 		res["message"] = "error parameter"
 		return
@@ -49,10 +56,16 @@ func TagUpdate(c *gin.Context) {
 		return
 	}
 	tag := &models.Tag{
-		Name: name,
+		Name:        name,
+		Description: c.PostForm("description"),
+		Cover:       c.PostForm("cover"),
 	}
 	tag.ID = uint(id)
-	err = tag.Update()
+	err = h.Tags.Update(tag)
+	if err == models.ErrTagNameExists {
+		res["message"] = "已存在同名标签，请使用合并"
+		return
+	}
 	if err != nil {
 		seelog.Error("[TagUpdate]update tag err", err)
 		res["message"] = err.Error()
@@ -61,7 +74,7 @@ func TagUpdate(c *gin.Context) {
 	res["succeed"] = true
 }
 
-func TagDelete(c *gin.Context) {
+func (h *Handler) TagDelete(c *gin.Context) {
 	var (
 		err error
 		id uint64
@@ -74,71 +87,100 @@ func TagDelete(c *gin.Context) {
 		return
 	}
 
-	tag := new(models.Tag)
-	tag.ID = uint(id)
-	err = tag.Delete()
+	err = h.Tags.Delete(uint(id))
 	if err != nil {
 		seelog.Error("[TagDelete]delete tag err", err)
 		res["message"] = err.Error()
 		return
 	}
+	related.Refresh()
 	res["succeed"] = true
 }
 
-func TagGet(c *gin.Context) {
+// 将标签合并到target，原标签的文章和订阅者改为关联target
+func (h *Handler) TagMerge(c *gin.Context) {
 	var (
-		tagName   string
-		page      string
-		pageIndex int
-		pageSize  = system.GetConfiguration().PageSize
-		total     int
-		err       error
-		policy    *bluemonday.Policy
-		posts     []*models.Post
+		err      error
+		id       uint64
+		targetId uint64
+		res      = gin.H{}
+	)
+	defer WriteJSON(c, res)
+	id, err = ParseIdToUint(c.Param("id"), "TagMerge")
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	targetId, err = ParseIdToUint(c.PostForm("target"), "TagMerge")
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	err = h.Tags.Merge(uint(id), uint(targetId))
+	if err != nil {
+		seelog.Error("[TagMerge]merge tag err", err)
+		res["message"] = err.Error()
+		return
+	}
+	related.Refresh()
+	res["succeed"] = true
+}
+
+func (h *Handler) TagGet(c *gin.Context) {
+	var (
+		tagName    string
+		tagId      uint64
+		tag        *models.Tag
+		pagination *models.Pagination
+		err        error
+		policy     *bluemonday.Policy
+		posts      []*models.Post
 	)
 	tagName = c.Param("tag")
-	page = c.Query("page")
-	pageIndex, _ = strconv.Atoi(page)
-	if pageIndex <= 0 {
-		pageIndex = 1
+	if tagId, err = ParseIdToUint(tagName, "TagGet"); err == nil {
+		tag, err = h.Tags.GetById(uint(tagId))
 	}
-	posts, err = models.ListPublishedPost(tagName, pageIndex, pageSize)
 	if err != nil {
-		seelog.Error("[TagGet]list publish post err", err)
-		c.AbortWithStatus(http.StatusInternalServerError)
+		seelog.Error("[TagGet]get tag err", err)
+		Handle404(c)
 		return
 	}
-	total, err = models.CountPostByTag(tagName)
+	pagination = parsePagination(c, system.GetConfiguration().PageSize)
+	posts, err = h.Posts.ListPublished(tagName, pagination)
 	if err != nil {
-		seelog.Error("[TagGet]count post by tag err", err)
-		c.AbortWithStatus(http.StatusInternalServerError)
+		seelog.Error("[TagGet]list publish post err", err)
+		abortListError(c, err)
 		return
 	}
+	categories := h.mustListCategories()
+	if err = h.loadPostList(posts, categories); err != nil {
+		seelog.Error("[TagGet]load post list err", err)
+	}
 	policy = bluemonday.StrictPolicy()
 	for _, post := range posts {
-		post.Tags, _ = models.ListTagByPostId(strconv.FormatUint(uint64(post.ID), 10))
 		post.Body = policy.Sanitize(string(blackfriday.Run([]byte(post.Body), blackfriday.WithNoExtensions())))
 	}
 	user, _ := c.Get(ContextUserKey)
 	HtmlSuccess(c, "index/index.html", gin.H{
+		"tag":             tag,
 		"posts":           posts,
-		"tags":            models.MustListTag(),
-		"archives":        models.MustListPostArchives(),
-		"links":           models.MustListLinks(),
-		"pageIndex":       pageIndex,
-		"totalPage":       int(math.Ceil(float64(total) / float64(pageSize))),
-		"maxReadPosts":    models.MustListMaxReadPost(),
-		"maxCommentPosts": models.MustListMaxCommentPost(),
+		"categories":      rootCategories(categories),
+		"tags":            h.mustListPublishedTag(),
+		"archives":        h.mustListArchives(),
+		"links":           h.mustListLinks(),
+		"pager":           newPager(c, pagination, false),
+		"maxReadPosts":    h.mustListMaxReadPost(),
+		"maxCommentPosts": h.mustListMaxCommentPost(),
 		"user": 		   user,
 	})
 }
 
-func TagIndex(c *gin.Context) {
-	tags, _ := models.ListAllTag()
+func (h *Handler) TagIndex(c *gin.Context) {
+	tags, _ := h.Tags.ListAll()
 	user, _ := c.Get(ContextUserKey)
 	HtmlSuccess(c, "admin/tag.html", gin.H{
 		"tags":    tags,
 		"user":     user,
-		"comments": models.MustListUnreadComment(),
+		"comments": h.mustListUnreadComment(),
 	})
 }
@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"blog/models"
+)
+
+func TestTagMerge(t *testing.T) {
+	s := newTestServer(t)
+	source := s.addTag(t, "golang")
+	target := s.addTag(t, "go")
+	post := s.addPost(t, &models.Post{Title: "title", IsPublished: true}, source.ID)
+	merge := fmt.Sprintf("/admin/tag/%d/merge", source.ID)
+
+	if succeed, _ := s.postJSON(t, merge, url.Values{"target": {"9999"}}); succeed {
+		t.Error("merging into a missing tag succeeded")
+	}
+	if succeed, _ := s.postJSON(t, merge, url.Values{"target": {"go"}}); succeed {
+		t.Error("merging into an invalid id succeeded")
+	}
+	if succeed, message := s.postJSON(t, merge, url.Values{"target": {strconv.Itoa(int(target.ID))}}); !succeed {
+		t.Fatalf("merge failed: %s", message)
+	}
+	tags, _ := s.repos.Tags.ListByPostId(post.ID)
+	if len(tags) != 1 || tags[0].ID != target.ID {
+		t.Errorf("tags after merge = %v", tags)
+	}
+	if s.repos.Tags.Count() != 1 {
+		t.Errorf("tag count = %d, want 1", s.repos.Tags.Count())
+	}
+}
+
+// 重命名为已有标签的名称时提示使用合并
+func TestTagUpdate(t *testing.T) {
+	s := newTestServer(t)
+	golang := s.addTag(t, "golang")
+	s.addTag(t, "go")
+	edit := fmt.Sprintf("/admin/tag/%d/edit", golang.ID)
+
+	if succeed, message := s.postJSON(t, edit, url.Values{"name": {"go"}}); succeed || message != "已存在同名标签，请使用合并" {
+		t.Errorf("renaming to an existing name = %v %s", succeed, message)
+	}
+	if succeed, message := s.postJSON(t, edit, url.Values{"name": {"Go语言"}}); !succeed {
+		t.Fatalf("rename failed: %s", message)
+	}
+	if tag, _ := s.repos.Tags.GetById(golang.ID); tag.Name != "Go语言" {
+		t.Errorf("name after rename = %s", tag.Name)
+	}
+}
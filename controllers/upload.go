@@ -1,39 +1,277 @@
 package controllers
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
 	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+	"unicode"
 
 	"github.com/gin-gonic/gin"
 	"github.com/cihub/seelog"
+	"github.com/pkg/errors"
 	. "blog/helpers"
+	"blog/imaging"
+	"blog/models"
+	"blog/storage"
+	"blog/system"
 )
 
-func Upload(c *gin.Context) {
+const (
+	megabyte          = 1 << 20
+	maxFileNameLength = 100
+)
+
+func (h *Handler) Upload(c *gin.Context) {
 	var (
-		err      error
-		res      = gin.H{}
-		url      string
-		uploader Uploader
-		file     multipart.File
-		fh       *multipart.FileHeader
+		err         error
+		res         = gin.H{}
+		media       *models.Media
+		file        multipart.File
+		fh          *multipart.FileHeader
+		contentType string
 	)
 	defer WriteJSON(c, res)
+	config := system.GetConfiguration()
+	maxSize := config.UploadMaxSize * megabyte
+	// 限制请求体大小，预留multipart边界和头部的空间
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+megabyte)
 	file, fh, err = c.Request.FormFile("file")
 	if err != nil {
 		seelog.Error("[Upload]get file err", err)
 		res["message"] = err.Error()
 		return
 	}
+	defer file.Close()
+	if fh.Size > maxSize {
+		res["message"] = fmt.Sprintf("file size exceeds %d MB", config.UploadMaxSize)
+		return
+	}
+
+	// 以文件内容判断类型，扩展名声称是图片时必须与内容一致
+	contentType, err = imaging.Sniff(file)
+	if err != nil {
+		seelog.Error("[Upload]sniff file err", err)
+		res["message"] = err.Error()
+		return
+	}
+	if !uploadAllowed(contentType) {
+		res["message"] = fmt.Sprintf("file type %s is not allowed", contentType)
+		return
+	}
+	claimed := mime.TypeByExtension(strings.ToLower(path.Ext(fh.Filename)))
+	if strings.HasPrefix(claimed, "image/") && claimed != contentType {
+		res["message"] = "file content does not match its extension"
+		return
+	}
+
+	media = &models.Media{
+		Driver:      storage.GetDriver(),
+		FileName:    sanitizeFileName(fh.Filename),
+		ContentType: contentType,
+	}
+	media.Hash, err = fileHash(file)
+	if err != nil {
+		seelog.Error("[Upload]hash file err", err)
+		res["message"] = err.Error()
+		return
+	}
+	// 相同内容只保存一次
+	if existing, err := h.Media.GetByHash(media.Driver, media.Hash); err == nil {
+		res["succeed"] = true
+		res["url"] = existing.Url
+		return
+	}
 
-	//uploader = QiniuUploader{}
-	uploader = SmmsUploader{}
+	if user, ok := c.MustGet(ContextUserKey).(*models.User); ok {
+		media.UserId = user.ID
+	}
+	quota, err := h.uploadQuota(media.UserId)
+	if err != nil {
+		seelog.Error("[Upload]sum media size err", err)
+		res["message"] = err.Error()
+		return
+	}
 
-	url, err = uploader.upload(file, fh)
+	if imaging.Ext(contentType) != "" {
+		err = h.uploadImage(media, file, quota)
+	} else {
+		err = h.uploadFile(media, file, fh, quota)
+	}
 	if err != nil {
 		seelog.Error("[Upload]upload file err", err)
 		res["message"] = err.Error()
 		return
 	}
 	res["succeed"] = true
-	res["url"] = url
+	res["url"] = media.Url
+}
+
+func uploadAllowed(contentType string) bool {
+	for _, allowed := range system.GetConfiguration().UploadAllowedTypes {
+		if allowed == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+// 计算文件内容的sha256，计算后将文件重置到开头
+func fileHash(file multipart.File) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// 去除文件名中的路径、控制字符和特殊字符，文件名只用于展示
+func sanitizeFileName(name string) string {
+	name = path.Base(strings.Replace(name, "\\", "/", -1))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, " .")
+	if runes := []rune(name); len(runes) > maxFileNameLength {
+		ext := []rune(path.Ext(name))
+		if len(ext) > 10 {
+			ext = nil
+		}
+		name = string(runes[:maxFileNameLength-len(ext)]) + string(ext)
+	}
+	if name == "" {
+		name = "file"
+	}
+	return name
+}
+
+// 用户剩余的上传配额(字节)，不限制时返回-1
+func (h *Handler) uploadQuota(userId uint) (int64, error) {
+	limit := system.GetConfiguration().UploadUserQuota
+	if limit <= 0 {
+		return -1, nil
+	}
+	used, err := h.Media.SumSizeByUserId(userId)
+	if err != nil {
+		return 0, err
+	}
+	return limit*megabyte - used, nil
+}
+
+// 本次要保存的全部文件大小超过剩余配额时返回错误
+func checkQuota(quota, size int64) error {
+	if quota >= 0 && size > quota {
+		return errors.Errorf("upload quota of %d MB exceeded", system.GetConfiguration().UploadUserQuota)
+	}
+	return nil
+}
+
+func (h *Handler) uploadFile(media *models.Media, file multipart.File, fh *multipart.FileHeader, quota int64) error {
+	if err := checkQuota(quota, fh.Size); err != nil {
+		return err
+	}
+	store := storage.GetStorage()
+	object, err := store.Put(storage.NewKey(path.Ext(media.FileName)), file, fh.Size, media.ContentType)
+	if err != nil {
+		return err
+	}
+	media.StorageKey, media.Url, media.Size = object.Key, object.Url, object.Size
+	// 没有记录的文件不会出现在媒体库中，也无法删除，所以同时删除已保存的文件
+	if err = h.Media.Insert(media); err != nil {
+		seelog.Error("[uploadFile]insert media err", err)
+		if e := store.Delete(object.Key); e != nil {
+			seelog.Error("[uploadFile]delete file err", e)
+		}
+		return err
+	}
+	return nil
+}
+
+// 处理图片后保存原图及缩略图、WebP等衍生文件，任一文件保存失败时删除已保存的文件。
+// 衍生文件同样计入配额，所以在处理之后按全部文件的大小检查配额
+func (h *Handler) uploadImage(media *models.Media, file multipart.File, quota int64) (err error) {
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	config := system.GetConfiguration()
+	images, err := imaging.Process(data, media.ContentType, imaging.Options{
+		MaxWidth:       config.ImageMaxWidth,
+		ThumbnailWidth: config.ImageThumbnailWidth,
+		WebpEncoder:    config.ImageWebpEncoder,
+		MaxPixels:      config.ImageMaxPixels,
+	})
+	if err != nil {
+		return errors.Wrap(err, "process image")
+	}
+	var total int64
+	for _, img := range images {
+		total += int64(len(img.Data))
+	}
+	if err = checkQuota(quota, total); err != nil {
+		return err
+	}
+
+	store := storage.GetStorage()
+	var saved []string
+	defer func() {
+		if err != nil {
+			for _, key := range saved {
+				store.Delete(key)
+			}
+		}
+	}()
+	key := storage.NewKey(imaging.Ext(media.ContentType))
+	var variants []*models.MediaVariant
+	for i, img := range images {
+		var object *storage.Object
+		object, err = store.Put(storage.VariantKey(key, img.Name, imaging.Ext(img.ContentType)), bytes.NewReader(img.Data), int64(len(img.Data)), img.ContentType)
+		if err != nil {
+			return err
+		}
+		saved = append(saved, object.Key)
+		if i == 0 {
+			media.StorageKey, media.Url, media.Size = object.Key, object.Url, object.Size
+			media.Width, media.Height = img.Width, img.Height
+			continue
+		}
+		variants = append(variants, &models.MediaVariant{
+			Name:        img.Name,
+			StorageKey:  object.Key,
+			Url:         object.Url,
+			ContentType: img.ContentType,
+			Size:        object.Size,
+			Width:       img.Width,
+			Height:      img.Height,
+		})
+	}
+	// 记录保存失败时返回错误，由defer删除原图和全部衍生文件
+	if err = h.Media.Insert(media); err != nil {
+		seelog.Error("[uploadImage]insert media err", err)
+		return err
+	}
+	for _, variant := range variants {
+		variant.MediaId = media.ID
+		if err = h.Media.InsertVariant(variant); err != nil {
+			seelog.Error("[uploadImage]insert media variant err", err)
+			if e := h.Media.Delete(media.ID); e != nil {
+				seelog.Error("[uploadImage]delete media err", e)
+			}
+			return err
+		}
+	}
+	return nil
 }
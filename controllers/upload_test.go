@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"blog/models"
+	"blog/storage"
+	"blog/system"
+)
+
+// 记录写入数据库失败，用于检查上传失败时是否清理已保存的文件
+type failingMediaRepository struct {
+	models.MediaRepository
+}
+
+func (failingMediaRepository) Insert(media *models.Media) error {
+	return errors.New("insert media failed")
+}
+
+// 文件记录保存成功，衍生文件记录保存失败
+type failingVariantRepository struct {
+	models.MediaRepository
+}
+
+func (failingVariantRepository) InsertVariant(variant *models.MediaVariant) error {
+	return errors.New("insert variant failed")
+}
+
+// 上传到临时目录的本地存储，返回存储目录
+func newUploadServer(t *testing.T) (*testServer, string) {
+	s := newTestServer(t)
+	dir := t.TempDir()
+	config := filepath.Join(t.TempDir(), "conf.yaml")
+	content := "storage_local_dir: " + dir + "\nstorage_local_url: /uploads\nimage_thumbnail_width: 16\nupload_allowed_types: [text/plain, image/png]\n"
+	if err := ioutil.WriteFile(config, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := system.LoadConfiguration(config); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.InitStorage(); err != nil {
+		t.Fatal(err)
+	}
+	return s, dir
+}
+
+func (s *testServer) upload(t *testing.T, name string, data []byte) (bool, string) {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	w.Close()
+	req := httptest.NewRequest(http.MethodPost, "/admin/upload", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	rec := httptest.NewRecorder()
+	s.engine.ServeHTTP(rec, req)
+	var res struct {
+		Succeed bool   `json:"succeed"`
+		Message string `json:"message"`
+	}
+	if err = json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("%v: %s", err, rec.Body.String())
+	}
+	return res.Succeed, res.Message
+}
+
+// 存储目录中的全部文件
+func storedFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files = append(files, path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestUploadFileInsertFailure(t *testing.T) {
+	s, dir := newUploadServer(t)
+	s.repos.Media = failingMediaRepository{s.repos.Media}
+
+	succeed, message := s.upload(t, "notes.txt", []byte("plain text notes"))
+	if succeed || message != "insert media failed" {
+		t.Errorf("upload = %v %q, want the insert error", succeed, message)
+	}
+	if files := storedFiles(t, dir); len(files) != 0 {
+		t.Errorf("files left after a failed insert: %v", files)
+	}
+}
+
+// 64x64的PNG，按配置的缩略图宽度会生成一个缩略图
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for x := 0; x < 64; x++ {
+		img.Set(x, x, color.RGBA{R: 255, A: 255})
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestUploadImageInsertFailure(t *testing.T) {
+	s, dir := newUploadServer(t)
+	media := s.repos.Media
+
+	// 确认正常上传会保存原图和缩略图
+	if succeed, message := s.upload(t, "a.png", testPNG(t)); !succeed {
+		t.Fatalf("upload failed: %s", message)
+	}
+	if files := storedFiles(t, dir); len(files) != 2 {
+		t.Fatalf("stored files = %v, want the image and its thumbnail", files)
+	}
+	uploaded, _ := media.List("", nil)
+	if err := media.Delete(uploaded[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range storedFiles(t, dir) {
+		os.Remove(file)
+	}
+
+	tests := []struct {
+		repository models.MediaRepository
+		message    string
+	}{
+		{failingMediaRepository{media}, "insert media failed"},
+		{failingVariantRepository{media}, "insert variant failed"},
+	}
+	for _, test := range tests {
+		s.repos.Media = test.repository
+		succeed, message := s.upload(t, "a.png", testPNG(t))
+		if succeed || message != test.message {
+			t.Errorf("upload = %v %q, want %q", succeed, message, test.message)
+		}
+		if files := storedFiles(t, dir); len(files) != 0 {
+			t.Errorf("%s: files left: %v", test.message, files)
+		}
+		if records, _ := media.List("", nil); len(records) != 0 {
+			t.Errorf("%s: media records left: %v", test.message, records)
+		}
+	}
+}
@@ -1,7 +0,0 @@
-package controllers
-
-import "mime/multipart"
-
-type Uploader interface {
-	upload(file multipart.File, fileHeader *multipart.FileHeader) (string, error)
-}
@@ -1,62 +0,0 @@
-package controllers
-
-import (
-	"context"
-	"mime/multipart"
-	"os"
-
-	"github.com/qiniu/go-sdk/v7/auth/qbox"
-	"github.com/qiniu/go-sdk/v7/storage"
-	"blog/system"
-	"github.com/cihub/seelog"
-)
-
-// 获取文件大小的接口
-type Size interface {
-	Size() int64
-}
-
-// 获取文件信息的接口
-type Stat interface {
-	Stat() (os.FileInfo, error)
-}
-
-// 构造返回值字段
-type PutRet struct {
-	Hash string `json:"hash"`
-	Key  string `json:"key"`
-}
-
-type QiniuUploader struct {
-}
-
-func (u QiniuUploader) upload(file multipart.File, fileHeader *multipart.FileHeader) (url string, err error) {
-	var (
-		ret  PutRet
-		size int64
-	)
-	if statInterface, ok := file.(Stat); ok {
-		fileInfo, _ := statInterface.Stat()
-		size = fileInfo.Size()
-	}
-	if sizeInterface, ok := file.(Size); ok {
-		size = sizeInterface.Size()
-	}
-
-	putPolicy := storage.PutPolicy{
-		Scope: system.GetConfiguration().QiniuBucket,
-	}
-	mac := qbox.NewMac(system.GetConfiguration().QiniuAccessKey, system.GetConfiguration().QiniuSecretKey)
-	token := putPolicy.UploadToken(mac)
-	cfg := storage.Config{}
-	uploader := storage.NewFormUploader(&cfg)
-	putExtra := storage.PutExtra{}
-
-	err = uploader.PutWithoutKey(context.Background(), &ret, token, file, size, &putExtra)
-	if err != nil {
-		seelog.Error("[upload]upload file to qiniu err", err)
-		return
-	}
-	url = system.GetConfiguration().QiniuFileServer + ret.Key
-	return
-}
@@ -66,7 +66,7 @@ func LogoutGet(c *gin.Context) {
 	c.Redirect(http.StatusSeeOther, "/user/login")
 }
 
-func RegisterPost(c *gin.Context) {
+func (h *Handler) RegisterPost(c *gin.Context) {
 	var (
 		err error
 		res = gin.H{}
@@ -89,7 +89,7 @@ func RegisterPost(c *gin.Context) {
 		IsAdmin:   true,
 	}
 	user.Password = Md5(user.Email + user.Password)
-	err = user.Insert()
+	err = h.Users.Insert(user)
 	if err != nil {
 		seelog.Error("[RegisterPost]insert user err", err)
 		res["message"] = "email already exists"
@@ -98,7 +98,7 @@ func RegisterPost(c *gin.Context) {
 	res["succeed"] = true
 }
 
-func LoginPost(c *gin.Context) {
+func (h *Handler) LoginPost(c *gin.Context) {
 	var (
 		err  error
 		user *models.User
@@ -111,7 +111,7 @@ func LoginPost(c *gin.Context) {
 		})
 		return
 	}
-	user, err = models.GetUserByUsername(LoginFrom.Email)
+	user, err = h.Users.GetByUsername(LoginFrom.Email)
 	if err != nil || user.Password != Md5(LoginFrom.Email + LoginFrom.PassWord) {
 		HtmlSuccess(c, "auth/login.html", gin.H{
 			"message": "invalid username or password",
@@ -135,7 +135,7 @@ func LoginPost(c *gin.Context) {
 	}
 }
 
-func Oauth2Callback(c *gin.Context) {
+func (h *Handler) Oauth2Callback(c *gin.Context) {
 	var (
 		userInfo *GithubUserInfo
 		user     *models.User
@@ -174,14 +174,14 @@ func Oauth2Callback(c *gin.Context) {
 	sessionUser, exists := c.Get(ContextUserKey)
 	if exists { // 已登录
 		user, _ = sessionUser.(*models.User)
-		_, err1 := models.IsGithubIdExists(userInfo.Login, user.ID)
-		if err1 != nil { // 未绑定
+		bound, err1 := h.Users.GetByGithubId(userInfo.Login)
+		if err1 != nil || bound.ID == user.ID { // 未绑定
 			if user.IsAdmin {
 				user.GithubLoginId = userInfo.Login
 			}
 			user.AvatarUrl = userInfo.AvatarURL
 			user.GithubUrl = userInfo.HTMLURL
-			err = user.UpdateGithubUserInfo()
+			err = h.Users.UpdateGithubUserInfo(user)
 		} else {
 			err = errors.New("this github loginId has bound another account.")
 		}
@@ -191,7 +191,7 @@ func Oauth2Callback(c *gin.Context) {
 			AvatarUrl:     userInfo.AvatarURL,
 			GithubUrl:     userInfo.HTMLURL,
 		}
-		user, err = user.FirstOrCreate()
+		err = h.Users.FirstOrCreateByGithub(user)
 		if err == nil {
 			if user.LockState {
 				err = errors.New("Your account have been locked.")
@@ -265,17 +265,17 @@ func getGithubUserInfoByAccessToken(token string) (*GithubUserInfo, error) {
 	return &userInfo, err
 }
 
-func ProfileGet(c *gin.Context) {
+func (h *Handler) ProfileGet(c *gin.Context) {
 	sessionUser, exists := c.Get(ContextUserKey)
 	if exists {
 		HtmlSuccess(c, "admin/profile.html", gin.H{
 			"user":     sessionUser,
-			"comments": models.MustListUnreadComment(),
+			"comments": h.mustListUnreadComment(),
 		})
 	}
 }
 
-func ProfileUpdate(c *gin.Context) {
+func (h *Handler) ProfileUpdate(c *gin.Context) {
 	var (
 		err error
 		res = gin.H{}
@@ -289,7 +289,8 @@ func ProfileUpdate(c *gin.Context) {
 		res["message"] = "server interval error"
 		return
 	}
-	err = user.UpdateProfile(avatarUrl, nickName)
+	user.AvatarUrl, user.NickName = avatarUrl, nickName
+	err = h.Users.UpdateProfile(user)
 	if err != nil {
 		seelog.Error("[ProfileUpdate]update profile err", err)
 		res["message"] = err.Error()
@@ -299,7 +300,7 @@ func ProfileUpdate(c *gin.Context) {
 	res["user"] = models.User{AvatarUrl: avatarUrl, NickName: nickName}
 }
 
-func BindEmail(c *gin.Context) {
+func (h *Handler) BindEmail(c *gin.Context) {
 	var (
 		err error
 		res = gin.H{}
@@ -322,13 +323,14 @@ func BindEmail(c *gin.Context) {
 		res["message"] = "email have bound"
 		return
 	}
-	_, err = models.GetUserByUsername(email)
+	_, err = h.Users.GetByUsername(email)
 	if err == nil {
 		seelog.Error("[BindEmail]get user by username err", err)
 		res["message"] = "email have be registered"
 		return
 	}
-	err = user.UpdateEmail(email)
+	user.Email = email
+	err = h.Users.UpdateEmail(user)
 	if err != nil {
 		seelog.Error("[BindEmail]update email err", err)
 		res["message"] = err.Error()
@@ -337,7 +339,7 @@ func BindEmail(c *gin.Context) {
 	res["succeed"] = true
 }
 
-func UnbindEmail(c *gin.Context) {
+func (h *Handler) UnbindEmail(c *gin.Context) {
 	var (
 		err error
 		res = gin.H{}
@@ -353,7 +355,8 @@ func UnbindEmail(c *gin.Context) {
 		res["message"] = "email haven't bound"
 		return
 	}
-	err = user.UpdateEmail("")
+	user.Email = ""
+	err = h.Users.UpdateEmail(user)
 	if err != nil {
 		seelog.Error("[UnbindGithub]update github user info err", err)
 		res["message"] = err.Error()
@@ -362,7 +365,7 @@ func UnbindEmail(c *gin.Context) {
 	res["succeed"] = true
 }
 
-func UnbindGithub(c *gin.Context) {
+func (h *Handler) UnbindGithub(c *gin.Context) {
 	var (
 		err error
 		res = gin.H{}
@@ -379,7 +382,7 @@ func UnbindGithub(c *gin.Context) {
 		return
 	}
 	user.GithubLoginId = ""
-	err = user.UpdateGithubUserInfo()
+	err = h.Users.UpdateGithubUserInfo(user)
 	if err != nil {
 		seelog.Error("[UserLock]update github user info err", err)
 		res["message"] = err.Error()
@@ -388,17 +391,17 @@ func UnbindGithub(c *gin.Context) {
 	res["succeed"] = true
 }
 
-func UserIndex(c *gin.Context) {
-	users, _ := models.ListUsers()
+func (h *Handler) UserIndex(c *gin.Context) {
+	users, _ := h.Users.ListNonAdmin()
 	user, _ := c.Get(ContextUserKey)
 	HtmlSuccess(c, "admin/user.html", gin.H{
 		"users":    users,
 		"user":     user,
-		"comments": models.MustListUnreadComment(),
+		"comments": h.mustListUnreadComment(),
 	})
 }
 
-func UserLock(c *gin.Context) {
+func (h *Handler) UserLock(c *gin.Context) {
 	var (
 		err  error
 		id  uint64
@@ -411,14 +414,14 @@ func UserLock(c *gin.Context) {
 		res["message"] = err.Error()
 		return
 	}
-	user, err = models.GetUser(uint(id))
+	user, err = h.Users.GetById(uint(id))
 	if err != nil {
 		seelog.Error("[UserLock]get user err", err)
 		res["message"] = err.Error()
 		return
 	}
 	user.LockState = !user.LockState
-	err = user.Lock()
+	err = h.Users.Lock(user)
 	if err != nil {
 		seelog.Error("[UserLock]lock user err", err)
 		res["message"] = err.Error()
@@ -0,0 +1,300 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-yaml/yaml"
+
+	"blog/models"
+)
+
+// 导出文件中的时间格式
+const timeLayout = time.RFC3339
+
+// 文章和页面的YAML front matter，兼容Hugo/Jekyll的常用字段
+type frontMatter struct {
+	Id         uint     `yaml:"id"`
+	Title      string   `yaml:"title"`
+	Tags       []string `yaml:"tags,omitempty"`
+	Categories []string `yaml:"categories,omitempty"` // 主分类从顶级开始的各级名称
+	Date       string   `yaml:"date"`
+	Updated    string   `yaml:"updated"`
+	Published  bool     `yaml:"published"`
+	Views      int      `yaml:"views"`
+}
+
+type comment struct {
+	Id        uint   `json:"id"`
+	PostId    uint   `json:"post_id"`
+	UserId    uint   `json:"user_id"`
+	Content   string `json:"content"`
+	Read      bool   `json:"read"`
+	CreatedAt string `json:"created_at"`
+}
+
+type link struct {
+	Id        uint   `json:"id"`
+	Name      string `json:"name"`
+	Url       string `json:"url"`
+	Sort      int    `json:"sort"`
+	View      int    `json:"view"`
+	CreatedAt string `json:"created_at"`
+}
+
+// 不包含密钥和签名
+type subscriber struct {
+	Id         uint     `json:"id"`
+	Email      string   `json:"email"`
+	Verified   bool     `json:"verified"`
+	Subscribed bool     `json:"subscribed"`
+	Frequency  string   `json:"frequency"`
+	Tags       []string `json:"tags,omitempty"`
+	CreatedAt  string   `json:"created_at"`
+}
+
+// 不包含密码和密钥
+type user struct {
+	Id        uint   `json:"id"`
+	Email     string `json:"email,omitempty"`
+	Telephone string `json:"telephone,omitempty"`
+	NickName  string `json:"nick_name,omitempty"`
+	AvatarUrl string `json:"avatar_url,omitempty"`
+	GithubUrl string `json:"github_url,omitempty"`
+	IsAdmin   bool   `json:"is_admin"`
+	Locked    bool   `json:"locked"`
+	CreatedAt string `json:"created_at"`
+}
+
+// FileName 导出文件名
+func FileName(now time.Time) string {
+	return fmt.Sprintf("wblog_export_%s.zip", now.Format("20060102150405"))
+}
+
+// Write 将全部内容导出为zip：posts/和pages/下每篇一个Markdown文件，其余数据为JSON
+func Write(w io.Writer) error {
+	archive := zip.NewWriter(w)
+	steps := []func(*zip.Writer) error{
+		writePosts,
+		writePages,
+		writeComments,
+		writeLinks,
+		writeSubscribers,
+		writeUsers,
+	}
+	for _, step := range steps {
+		if err := step(archive); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+func writePosts(archive *zip.Writer) error {
+	posts, err := models.ListAllPost("", nil)
+	if err != nil {
+		return err
+	}
+	categories, err := models.ListAllCategory()
+	if err != nil {
+		return err
+	}
+	for _, post := range posts {
+		tags, err := models.ListTagByPostId(fmt.Sprint(post.ID))
+		if err != nil {
+			return err
+		}
+		matter := frontMatter{
+			Id:        post.ID,
+			Title:     post.Title,
+			Date:      post.CreatedAt.Format(timeLayout),
+			Updated:   post.UpdatedAt.Format(timeLayout),
+			Published: post.IsPublished,
+			Views:     post.View,
+		}
+		for _, tag := range tags {
+			matter.Tags = append(matter.Tags, tag.Name)
+		}
+		for _, category := range models.CategoryPath(categories, post.CategoryId) {
+			matter.Categories = append(matter.Categories, category.Name)
+		}
+		if err = writeMarkdown(archive, "posts/"+markdownName(post.ID, post.Title), matter, post.Body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writePages(archive *zip.Writer) error {
+	pages, err := models.ListAllPage()
+	if err != nil {
+		return err
+	}
+	for _, page := range pages {
+		matter := frontMatter{
+			Id:        page.ID,
+			Title:     page.Title,
+			Date:      page.CreatedAt.Format(timeLayout),
+			Updated:   page.UpdatedAt.Format(timeLayout),
+			Published: page.IsPublished,
+			Views:     page.View,
+		}
+		if err = writeMarkdown(archive, "pages/"+markdownName(page.ID, page.Title), matter, page.Body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeComments(archive *zip.Writer) error {
+	comments, err := models.ListAllComment()
+	if err != nil {
+		return err
+	}
+	items := make([]comment, 0, len(comments))
+	for _, c := range comments {
+		items = append(items, comment{
+			Id:        c.ID,
+			PostId:    c.PostID,
+			UserId:    c.UserID,
+			Content:   c.Content,
+			Read:      c.ReadState,
+			CreatedAt: c.CreatedAt.Format(timeLayout),
+		})
+	}
+	return writeJSON(archive, "comments.json", items)
+}
+
+func writeLinks(archive *zip.Writer) error {
+	links, err := models.ListLinks()
+	if err != nil {
+		return err
+	}
+	items := make([]link, 0, len(links))
+	for _, l := range links {
+		items = append(items, link{
+			Id:        l.ID,
+			Name:      l.Name,
+			Url:       l.Url,
+			Sort:      l.Sort,
+			View:      l.View,
+			CreatedAt: l.CreatedAt.Format(timeLayout),
+		})
+	}
+	return writeJSON(archive, "links.json", items)
+}
+
+func writeSubscribers(archive *zip.Writer) error {
+	subscribers, err := models.ListSubscriber(false)
+	if err != nil {
+		return err
+	}
+	items := make([]subscriber, 0, len(subscribers))
+	for _, s := range subscribers {
+		tags, err := models.ListTagBySubscriberId(s.ID)
+		if err != nil {
+			return err
+		}
+		item := subscriber{
+			Id:         s.ID,
+			Email:      s.Email,
+			Verified:   s.VerifyState,
+			Subscribed: s.SubscribeState,
+			Frequency:  s.Frequency,
+			CreatedAt:  s.CreatedAt.Format(timeLayout),
+		}
+		for _, tag := range tags {
+			item.Tags = append(item.Tags, tag.Name)
+		}
+		items = append(items, item)
+	}
+	return writeJSON(archive, "subscribers.json", items)
+}
+
+func writeUsers(archive *zip.Writer) error {
+	users, err := models.ListAllUser()
+	if err != nil {
+		return err
+	}
+	items := make([]user, 0, len(users))
+	for _, u := range users {
+		items = append(items, user{
+			Id:        u.ID,
+			Email:     u.Email,
+			Telephone: u.Telephone,
+			NickName:  u.NickName,
+			AvatarUrl: u.AvatarUrl,
+			GithubUrl: u.GithubUrl,
+			IsAdmin:   u.IsAdmin,
+			Locked:    u.LockState,
+			CreatedAt: u.CreatedAt.Format(timeLayout),
+		})
+	}
+	return writeJSON(archive, "users.json", items)
+}
+
+func writeMarkdown(archive *zip.Writer, name string, matter frontMatter, body string) error {
+	header, err := yaml.Marshal(matter)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.WriteString("---\n")
+	buf.Write(header)
+	buf.WriteString("---\n\n")
+	buf.WriteString(body)
+	if !strings.HasSuffix(body, "\n") {
+		buf.WriteString("\n")
+	}
+	return writeFile(archive, name, buf.Bytes())
+}
+
+func writeJSON(archive *zip.Writer, name string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(archive, name, data)
+}
+
+func writeFile(archive *zip.Writer, name string, data []byte) error {
+	f, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+// 以id和标题生成文件名，标题中只保留字母和数字，其余字符替换为-
+func markdownName(id uint, title string) string {
+	var slug strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			slug.WriteRune(r)
+			dash = false
+		} else if !dash && slug.Len() > 0 {
+			slug.WriteByte('-')
+			dash = true
+		}
+	}
+	name := strings.TrimSuffix(slug.String(), "-")
+	if len([]rune(name)) > 60 {
+		name = strings.TrimSuffix(string([]rune(name)[:60]), "-")
+	}
+	if name == "" {
+		return fmt.Sprintf("%d.md", id)
+	}
+	return fmt.Sprintf("%d-%s.md", id, name)
+}
@@ -0,0 +1,35 @@
+package forms
+
+import (
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// 表单字段的中文名称，用于校验失败时的提示
+var fieldLabels = map[string]string{
+	"Title":       "标题",
+	"Body":        "内容",
+	"IsPublished": "发布状态",
+}
+
+// ErrorMessage 将参数校验错误转换为表单中显示的提示，其他错误原样返回
+func ErrorMessage(err error) string {
+	errs, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return err.Error()
+	}
+	messages := make([]string, 0, len(errs))
+	for _, fieldErr := range errs {
+		label, ok := fieldLabels[fieldErr.Field()]
+		if !ok {
+			label = fieldErr.Field()
+		}
+		if fieldErr.Tag() == "required" {
+			messages = append(messages, label+"不能为空")
+		} else {
+			messages = append(messages, label+"格式不正确")
+		}
+	}
+	return strings.Join(messages, "，")
+}
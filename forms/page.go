@@ -5,19 +5,14 @@ import "github.com/go-playground/validator/v10"
 type PageFrom struct {
 	Title 	string `form:"title" json:"title" binding:"required"`
 	Body 	string `form:"body" json:"body" binding:"required"`
-	IsPublished  	string `form:"isPublished" json:"isPublished" binding:"required,CheckPublish"`
+	// 复选框未选中时不会提交该字段，视为不公开
+	IsPublished  	string `form:"isPublished" json:"isPublished" binding:"omitempty,CheckPublish"`
 }
 
 func CheckPublish(fl validator.FieldLevel) bool {
-	var res bool
 	switch fl.Field().Interface().(string) {
-	case "on":
-	case "off":
-		res = true
-		break
-	default:
-		res = false
-		break
+	case "on", "off":
+		return true
 	}
-	return res
+	return false
 }
\ No newline at end of file
@@ -8,6 +8,21 @@ import (
 type SubscribeForm struct {
 	// 邮箱
 	Email string `form:"email" json:"email" binding:"required,email"`
+	// 推送频率
+	Frequency string `form:"frequency" json:"frequency" binding:"omitempty,oneof=immediate daily weekly"`
+	// 关注的标签，为空时接收所有文章
+	Tags []uint `form:"tags" json:"tags"`
+}
+
+type PreferenceForm struct {
+	// 订阅者令牌
+	Token string `form:"token" json:"token" binding:"required"`
+	// 推送频率
+	Frequency string `form:"frequency" json:"frequency" binding:"required,oneof=immediate daily weekly"`
+	// 关注的标签，为空时接收所有文章
+	Tags []uint `form:"tags" json:"tags"`
+	// 是否继续订阅
+	SubscribeState string `form:"subscribeState" json:"subscribeState"`
 }
 
 type SubscriberForm struct {
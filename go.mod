@@ -5,7 +5,7 @@ go 1.13
 require (
 	github.com/alimoeeny/gooauth2 v0.0.0-20140214171402-62c620a8c7eb
 	github.com/cihub/seelog v0.0.0-20170130134532-f561c5e57575
-	github.com/claudiu/gocron v0.0.0-20151103142354-980c96bf412b // indirect
+	github.com/claudiu/gocron v0.0.0-20151103142354-980c96bf412b
 	github.com/dchest/captcha v0.0.0-20200903113550-03f5f0333e1f
 	github.com/denisbakhtin/sitemap v0.0.0-20151103020935-3b73dfe0369c
 	github.com/gin-contrib/sessions v0.0.3
@@ -21,4 +21,5 @@ require (
 	github.com/russross/blackfriday v2.0.0+incompatible
 	github.com/shurcooL/sanitized_anchor_name v1.0.0 // indirect
 	github.com/snluu/uuid v0.0.0-20130306162636-1dd34a9ad6c0
+	golang.org/x/crypto v0.0.0-20210711020723-a769d52b0f97
 )
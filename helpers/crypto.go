@@ -0,0 +1,309 @@
+package helpers
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
+)
+
+// 加密文件格式(版本1)：
+//
+//	magic(8) version(1) kdf(1) logN(1) r(1) p(1) salt(16) chunkSize(4)
+//
+// 之后是若干个AES-256-GCM加密的数据块，每块最多chunkSize字节明文，附带16字节认证标签。
+// 密钥由口令经scrypt派生，每个文件使用随机salt，因此nonce只需包含块序号和是否为最后一块的标记；
+// 文件头作为每个块的附加数据参与认证，块被截断、重排或篡改都会在解密时发现。
+const (
+	encryptMagic     = "WBLOGENC"
+	encryptVersion   = 1
+	kdfScrypt        = 1
+	scryptLogN       = 15
+	scryptR          = 8
+	scryptP          = 1
+	saltSize         = 16
+	encryptChunkSize = 64 * 1024
+	headerSize       = len(encryptMagic) + 5 + saltSize + 4
+	keySize          = 32
+	// 解密时接受的scrypt参数上限，避免被篡改的文件头让scrypt占用过多内存(128·r·2^logN字节)和CPU
+	maxScryptMemory = 256 << 20
+	maxScryptP      = 4
+)
+
+var (
+	ErrEmptyPassphrase = errors.New("passphrase is empty")
+	ErrDecrypt         = errors.New("decryption failed, wrong passphrase or corrupted data")
+)
+
+type encryptHeader struct {
+	raw       []byte
+	logN      uint8
+	r         uint8
+	p         uint8
+	salt      []byte
+	chunkSize uint32
+}
+
+func (h *encryptHeader) aead(passphrase string) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), h.salt, 1<<h.logN, int(h.r), int(h.p), keySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func parseEncryptHeader(raw []byte) (*encryptHeader, error) {
+	if string(raw[:len(encryptMagic)]) != encryptMagic {
+		return nil, errors.New("not an encrypted backup")
+	}
+	offset := len(encryptMagic)
+	if raw[offset] != encryptVersion {
+		return nil, errors.Errorf("unsupported encryption version %d", raw[offset])
+	}
+	if raw[offset+1] != kdfScrypt {
+		return nil, errors.Errorf("unsupported key derivation %d", raw[offset+1])
+	}
+	header := &encryptHeader{
+		raw:       raw,
+		logN:      raw[offset+2],
+		r:         raw[offset+3],
+		p:         raw[offset+4],
+		salt:      raw[offset+5 : offset+5+saltSize],
+		chunkSize: binary.BigEndian.Uint32(raw[offset+5+saltSize:]),
+	}
+	if header.logN < 10 || header.logN > 20 || header.chunkSize == 0 || header.chunkSize > 16*encryptChunkSize {
+		return nil, errors.New("invalid encryption header")
+	}
+	if header.r == 0 || header.p == 0 || header.p > maxScryptP || 128*uint64(header.r)<<header.logN > maxScryptMemory {
+		return nil, errors.New("invalid encryption header, scrypt parameters out of range")
+	}
+	return header, nil
+}
+
+// nonce由块序号和最后一块的标记组成
+func chunkNonce(size int, counter uint64, last bool) []byte {
+	nonce := make([]byte, size)
+	binary.BigEndian.PutUint64(nonce[size-9:], counter)
+	if last {
+		nonce[size-1] = 1
+	}
+	return nonce
+}
+
+type encryptWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	header  []byte
+	buf     []byte
+	counter uint64
+	closed  bool
+}
+
+// NewEncryptWriter 返回加密写入w的Writer，必须调用Close写入最后一块
+func NewEncryptWriter(w io.Writer, passphrase string) (io.WriteCloser, error) {
+	if passphrase == "" {
+		return nil, ErrEmptyPassphrase
+	}
+	raw := make([]byte, 0, headerSize)
+	raw = append(raw, encryptMagic...)
+	raw = append(raw, encryptVersion, kdfScrypt, scryptLogN, scryptR, scryptP)
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	raw = append(raw, salt...)
+	raw = append(raw, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(raw[headerSize-4:], encryptChunkSize)
+	header, err := parseEncryptHeader(raw)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := header.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(raw); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{
+		w:      w,
+		aead:   aead,
+		header: raw,
+		buf:    make([]byte, 0, encryptChunkSize),
+	}, nil
+}
+
+func (ew *encryptWriter) Write(p []byte) (int, error) {
+	if ew.closed {
+		return 0, errors.New("write to closed writer")
+	}
+	written := 0
+	for len(p) > 0 {
+		// 缓冲区满且还有数据时才写出，保证最后一块在Close时写出
+		if len(ew.buf) == encryptChunkSize {
+			if err := ew.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(ew.buf[len(ew.buf):encryptChunkSize], p)
+		ew.buf = ew.buf[:len(ew.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (ew *encryptWriter) seal(last bool) error {
+	nonce := chunkNonce(ew.aead.NonceSize(), ew.counter, last)
+	sealed := ew.aead.Seal(nil, nonce, ew.buf, ew.header)
+	ew.counter++
+	ew.buf = ew.buf[:0]
+	_, err := ew.w.Write(sealed)
+	return err
+}
+
+func (ew *encryptWriter) Close() error {
+	if ew.closed {
+		return nil
+	}
+	ew.closed = true
+	return ew.seal(true)
+}
+
+type decryptReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	header  []byte
+	chunk   []byte
+	buf     []byte
+	counter uint64
+	done    bool
+}
+
+// NewDecryptReader 返回解密r的Reader，数据被篡改或截断时Read返回ErrDecrypt。
+// 没有文件头的数据按旧版本的AES-CFB格式解密，旧格式没有认证，口令错误时只会得到错误的数据，需要调用方校验解密结果
+func NewDecryptReader(r io.Reader, passphrase string) (io.Reader, error) {
+	if passphrase == "" {
+		return nil, ErrEmptyPassphrase
+	}
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(encryptMagic))
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "read encryption header")
+	}
+	if string(magic) != encryptMagic {
+		return newLegacyDecryptReader(br, passphrase)
+	}
+	r = br
+	raw := make([]byte, headerSize)
+	if _, err = io.ReadFull(r, raw); err != nil {
+		return nil, errors.Wrap(err, "read encryption header")
+	}
+	header, err := parseEncryptHeader(raw)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := header.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	chunkSize := int(header.chunkSize) + aead.Overhead()
+	return &decryptReader{
+		r:      bufio.NewReaderSize(r, chunkSize),
+		aead:   aead,
+		header: raw,
+		chunk:  make([]byte, chunkSize),
+	}, nil
+}
+
+func (dr *decryptReader) Read(p []byte) (int, error) {
+	for len(dr.buf) == 0 {
+		if dr.done {
+			return 0, io.EOF
+		}
+		if err := dr.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, dr.buf)
+	dr.buf = dr.buf[n:]
+	return n, nil
+}
+
+// 解密下一块，读完一块后没有剩余数据即为最后一块
+func (dr *decryptReader) open() error {
+	n, err := io.ReadFull(dr.r, dr.chunk)
+	if err == io.EOF {
+		// 缺少最后一块，数据被截断
+		return ErrDecrypt
+	}
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	last := n < len(dr.chunk)
+	if !last {
+		if _, err = dr.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+	nonce := chunkNonce(dr.aead.NonceSize(), dr.counter, last)
+	plain, err := dr.aead.Open(nil, nonce, dr.chunk[:n], dr.header)
+	if err != nil {
+		return ErrDecrypt
+	}
+	dr.counter++
+	dr.buf = plain
+	dr.done = last
+	return nil
+}
+
+// 旧版本的备份格式：16字节IV之后是AES-CFB加密的数据，密钥直接使用口令，长度必须为16、24或32字节
+func newLegacyDecryptReader(r io.Reader, passphrase string) (io.Reader, error) {
+	block, err := aes.NewCipher([]byte(passphrase))
+	if err != nil {
+		return nil, errors.Wrap(err, "legacy backup key")
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err = io.ReadFull(r, iv); err != nil {
+		return nil, errors.Wrap(err, "read legacy iv")
+	}
+	return &cipher.StreamReader{S: cipher.NewCFBDecrypter(block, iv), R: r}, nil
+}
+
+// Encrypt 加密整段数据
+func Encrypt(plaintext []byte, passphrase string) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := NewEncryptWriter(&buf, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(plaintext); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decrypt 解密整段数据并校验完整性
+func Decrypt(cipherText []byte, passphrase string) ([]byte, error) {
+	r, err := NewDecryptReader(bytes.NewReader(cipherText), passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
@@ -0,0 +1,208 @@
+package helpers
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+)
+
+const testPassphrase = "correct horse battery staple"
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	data := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func encrypt(t *testing.T, plaintext []byte) []byte {
+	t.Helper()
+	encrypted, err := Encrypt(plaintext, testPassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encrypted
+}
+
+// 加密后的数据块，每块为chunkSize字节明文加16字节认证标签
+func sealedChunks(encrypted []byte) [][]byte {
+	var chunks [][]byte
+	body := encrypted[headerSize:]
+	for len(body) > 0 {
+		n := encryptChunkSize + 16
+		if n > len(body) {
+			n = len(body)
+		}
+		chunks = append(chunks, body[:n])
+		body = body[n:]
+	}
+	return chunks
+}
+
+func join(header []byte, chunks ...[]byte) []byte {
+	data := append([]byte(nil), header...)
+	for _, chunk := range chunks {
+		data = append(data, chunk...)
+	}
+	return data
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 1, encryptChunkSize - 1, encryptChunkSize, encryptChunkSize + 1, 3 * encryptChunkSize} {
+		plaintext := randomBytes(t, size)
+		encrypted := encrypt(t, plaintext)
+		wantChunks := size/encryptChunkSize + 1
+		if size > 0 && size%encryptChunkSize == 0 {
+			wantChunks--
+		}
+		if chunks := sealedChunks(encrypted); len(chunks) != wantChunks {
+			t.Errorf("size %d: %d chunks, want %d", size, len(chunks), wantChunks)
+		}
+		decrypted, err := Decrypt(encrypted, testPassphrase)
+		if err != nil {
+			t.Errorf("size %d: %v", size, err)
+			continue
+		}
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("size %d: decrypted data differs", size)
+		}
+	}
+}
+
+// 分多次写入时与一次写入的结果可以同样解密
+func TestEncryptWriterSmallWrites(t *testing.T) {
+	plaintext := randomBytes(t, encryptChunkSize+100)
+	var buf bytes.Buffer
+	w, err := NewEncryptWriter(&buf, testPassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(plaintext); i += 1000 {
+		end := i + 1000
+		if end > len(plaintext) {
+			end = len(plaintext)
+		}
+		if _, err = w.Write(plaintext[i:end]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write([]byte("x")); err == nil {
+		t.Error("writing after close succeeded")
+	}
+	decrypted, err := Decrypt(buf.Bytes(), testPassphrase)
+	if err != nil || !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("decrypt = %d bytes, %v", len(decrypted), err)
+	}
+}
+
+func TestDecryptTampered(t *testing.T) {
+	encrypted := encrypt(t, randomBytes(t, 2*encryptChunkSize+1))
+	header := encrypted[:headerSize]
+	chunks := sealedChunks(encrypted)
+	if len(chunks) != 3 {
+		t.Fatalf("%d chunks, want 3", len(chunks))
+	}
+	flipped := append([]byte(nil), encrypted...)
+	flipped[headerSize+10] ^= 1
+	salted := append([]byte(nil), encrypted...)
+	salted[len(encryptMagic)+5] ^= 1
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"truncated", encrypted[:len(encrypted)-1]},
+		{"last chunk dropped", join(header, chunks[0], chunks[1])},
+		{"only header", join(header)},
+		{"reordered", join(header, chunks[1], chunks[0], chunks[2])},
+		{"chunk duplicated", join(header, chunks[0], chunks[0], chunks[1], chunks[2])},
+		{"bit flipped", flipped},
+		{"salt changed", salted},
+	}
+	for _, test := range tests {
+		if _, err := Decrypt(test.data, testPassphrase); err != ErrDecrypt {
+			t.Errorf("%s: err = %v, want %v", test.name, err, ErrDecrypt)
+		}
+	}
+}
+
+func TestDecryptWrongPassphrase(t *testing.T) {
+	encrypted := encrypt(t, []byte("secret data"))
+	if _, err := Decrypt(encrypted, "wrong passphrase"); err != ErrDecrypt {
+		t.Errorf("err = %v, want %v", err, ErrDecrypt)
+	}
+	if _, err := Decrypt(encrypted, ""); err != ErrEmptyPassphrase {
+		t.Errorf("empty passphrase err = %v, want %v", err, ErrEmptyPassphrase)
+	}
+	if _, err := Encrypt([]byte("data"), ""); err != ErrEmptyPassphrase {
+		t.Errorf("encrypt with empty passphrase err = %v, want %v", err, ErrEmptyPassphrase)
+	}
+}
+
+// 文件头中超出范围的参数在调用scrypt之前被拒绝
+func TestDecryptHeaderOutOfRange(t *testing.T) {
+	encrypted := encrypt(t, []byte("data"))
+	offset := len(encryptMagic)
+	tests := []struct {
+		name    string
+		modify  func(header []byte)
+		message string
+	}{
+		{"version", func(h []byte) { h[offset] = 2 }, "unsupported encryption version"},
+		{"kdf", func(h []byte) { h[offset+1] = 2 }, "unsupported key derivation"},
+		{"logN too small", func(h []byte) { h[offset+2] = 9 }, "invalid encryption header"},
+		{"logN too large", func(h []byte) { h[offset+2] = 21 }, "invalid encryption header"},
+		{"r zero", func(h []byte) { h[offset+3] = 0 }, "out of range"},
+		{"memory too large", func(h []byte) { h[offset+2], h[offset+3] = 20, 255 }, "out of range"},
+		{"p zero", func(h []byte) { h[offset+4] = 0 }, "out of range"},
+		{"p too large", func(h []byte) { h[offset+4] = maxScryptP + 1 }, "out of range"},
+		{"chunk size zero", func(h []byte) { binary.BigEndian.PutUint32(h[headerSize-4:], 0) }, "invalid encryption header"},
+		{"chunk size too large", func(h []byte) { binary.BigEndian.PutUint32(h[headerSize-4:], 16*encryptChunkSize+1) }, "invalid encryption header"},
+	}
+	for _, test := range tests {
+		data := append([]byte(nil), encrypted...)
+		test.modify(data[:headerSize])
+		_, err := Decrypt(data, testPassphrase)
+		if err == nil || !strings.Contains(err.Error(), test.message) {
+			t.Errorf("%s: err = %v, want %q", test.name, err, test.message)
+		}
+	}
+	if _, err := Decrypt(encrypted[:headerSize-1], testPassphrase); err == nil {
+		t.Error("decrypting a short header succeeded")
+	}
+}
+
+// 旧版本备份：IV之后是以口令为密钥的AES-CFB数据
+func TestDecryptLegacy(t *testing.T) {
+	passphrase := "0123456789abcdef0123456789abcdef"
+	plaintext := []byte("legacy backup data")
+	block, err := aes.NewCipher([]byte(passphrase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := randomBytes(t, aes.BlockSize)
+	encrypted := make([]byte, len(plaintext))
+	cipher.NewCFBEncrypter(block, iv).XORKeyStream(encrypted, plaintext)
+	legacy := append(iv, encrypted...)
+
+	decrypted, err := Decrypt(legacy, passphrase)
+	if err != nil || !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("decrypt = %q, %v", decrypted, err)
+	}
+	if _, err = Decrypt(legacy, "not a valid aes key"); err == nil {
+		t.Error("legacy decrypt with an invalid key length succeeded")
+	}
+	if _, err = Decrypt(iv[:8], passphrase); err == nil {
+		t.Error("legacy decrypt without a full iv succeeded")
+	}
+}
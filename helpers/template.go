@@ -1,6 +1,7 @@
 package helpers
 
 import (
+	"fmt"
 	"time"
 )
 
@@ -39,3 +40,17 @@ func Add(a1, a2 int) int {
 func Minus(a1, a2 int) int {
 	return a1 - a2
 }
+
+// 格式化文件大小
+func FileSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -1,18 +1,15 @@
 package helpers
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/md5"
-	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
-	"io"
-	"net/smtp"
 	"os"
 	"strings"
 	"time"
 
-	"github.com/pkg/errors"
 	"github.com/snluu/uuid"
 	"path/filepath"
 	"github.com/cihub/seelog"
@@ -21,6 +18,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gin-contrib/sessions"
 	"net/http"
+	"blog/mailer"
 	"blog/system"
 )
 
@@ -38,6 +36,18 @@ func Md5(source string) string {
 	return hex.EncodeToString(md5h.Sum(nil))
 }
 
+// 使用session_secret计算HMAC-SHA256签名
+func HmacSign(message string) string {
+	mac := hmac.New(sha256.New, []byte(system.GetConfiguration().SessionSecret))
+	mac.Write([]byte(message))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// 校验HMAC签名
+func HmacVerify(message, signature string) bool {
+	return hmac.Equal([]byte(HmacSign(message)), []byte(signature))
+}
+
 func Truncate(s string, n int) string {
 	runes := []rune(s)
 	if len(runes) > n {
@@ -56,17 +66,25 @@ func GetCurrentTime() time.Time {
 }
 
 func SendToMail(user, password, host, to, subject, body, mailType string) error {
-	hp := strings.Split(host, ":")
-	auth := smtp.PlainAuth("", user, password, hp[0])
-	var contentType string
+	return SendToMailWithHeaders(user, password, host, to, subject, body, mailType, nil)
+}
+
+// 通过指定的smtp服务器发送邮件，headers为附加的邮件头，如List-Unsubscribe
+func SendToMailWithHeaders(user, password, host, to, subject, body, mailType string, headers map[string]string) error {
+	transport := &mailer.SmtpTransport{Username: user, Password: password, Host: host}
+	return transport.Send(newMessage(user, to, subject, body, mailType, headers))
+}
+
+func newMessage(from, to, subject, body, mailType string, headers map[string]string) *mailer.Message {
+	contentType := "text/plain"
 	if mailType == "html" {
-		contentType = "Content-Type: text/" + mailType + "; charset=UTF-8"
-	} else {
-		contentType = "Content-Type: text/plain" + "; charset=UTF-8"
+		contentType = "text/html"
+	}
+	msg := mailer.NewMessage(from, to, subject, body, contentType)
+	for key, value := range headers {
+		msg.Headers[key] = value
 	}
-	msg := []byte("To: " + to + "\r\nFrom: " + user + "\r\nSubject: " + subject + "\r\n" + contentType + "\r\n\r\n" + body)
-	sendTo := strings.Split(to, ";")
-	return smtp.SendMail(host, auth, user, sendTo, msg)
+	return msg
 }
 
 func PathExists(path string) (bool, error) {
@@ -80,70 +98,6 @@ func PathExists(path string) (bool, error) {
 	return false, err
 }
 
-func Decrypt(cipherText []byte, keyString string) ([]byte, error) {
-	// Key
-	key := []byte(keyString)
-
-	// Create the AES cipher
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, err
-	}
-
-	// Before even testing the decryption,
-	// if the text is too small, then it is incorrect
-	if len(cipherText) < aes.BlockSize {
-		err = errors.New("Text is too short")
-		return nil, nil
-	}
-
-	// Get the 16 byte IV
-	iv := cipherText[:aes.BlockSize]
-
-	// Remove the IV from the cipherText
-	cipherText = cipherText[aes.BlockSize:]
-
-	// Return a decrypted stream
-	stream := cipher.NewCFBDecrypter(block, iv)
-
-	// Decrypt bytes from cipherText
-	stream.XORKeyStream(cipherText, cipherText)
-
-	return cipherText, nil
-}
-
-func Encrypt(plaintext []byte, keyString string) ([]byte, error) {
-
-	// Key
-	key := []byte(keyString)
-
-	// Create the AES cipher
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, err
-	}
-
-	// Empty array of 16 + plaintext length
-	// Include the IV at the beginning
-	cipherText := make([]byte, aes.BlockSize+len(plaintext))
-
-	// Slice of first 16 bytes
-	iv := cipherText[:aes.BlockSize]
-
-	// Write 16 rand bytes to fill iv
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
-		return nil, err
-	}
-
-	// Return an encrypted stream
-	stream := cipher.NewCFBEncrypter(block, iv)
-
-	// Encrypt bytes from plaintext to cipherText
-	stream.XORKeyStream(cipherText[aes.BlockSize:], plaintext)
-
-	return cipherText, nil
-}
-
 func GetCurrentDirectory() string {
 	dir, err := filepath.Abs(filepath.Dir(os.Args[0]))
 	if err != nil {
@@ -174,9 +128,13 @@ func WriteJSON(ctx *gin.Context, h gin.H) {
 	ctx.JSON(http.StatusOK, h)
 }
 
+// 通过配置的mail_transport发送邮件
 func SendEmail(to, subject, body string) error {
-	c := system.GetConfiguration()
-	return SendToMail(c.SmtpUsername, c.SmtpPassword, c.SmtpHost, to, subject, body, "html")
+	return SendEmailWithHeaders(to, subject, body, nil)
+}
+
+func SendEmailWithHeaders(to, subject, body string, headers map[string]string) error {
+	return mailer.Send(newMessage(system.GetConfiguration().SmtpUsername, to, subject, body, "html", headers))
 }
 
 func NotifyEmail(subject, body string) error {
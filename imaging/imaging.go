@@ -0,0 +1,217 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultMaxWidth       = 1920
+	DefaultThumbnailWidth = 320
+	DefaultMaxPixels      = 40000000 // 约4000万像素，解码后约占160MB内存
+	jpegQuality           = 90
+)
+
+// 图片声明的像素数超过Options.MaxPixels
+var ErrTooManyPixels = errors.New("image has too many pixels")
+
+// 处理后的图片，原图的Name为空
+type Image struct {
+	Name        string
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+}
+
+type Options struct {
+	MaxWidth       int    // 超过该宽度的图片等比缩小
+	ThumbnailWidth int    // 缩略图宽度
+	WebpEncoder    string // cwebp可执行文件路径，为空时不生成WebP
+	MaxPixels      int    // 宽×高的上限，解码前按文件头中的尺寸检查，避免小文件声明巨大尺寸耗尽内存
+}
+
+var extensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// 图片类型对应的扩展名，不支持的类型返回空
+func Ext(contentType string) string {
+	return extensions[contentType]
+}
+
+// 根据文件内容判断类型，不含charset等参数，读取后将r重置到开头
+func Sniff(r io.ReadSeeker) (string, error) {
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(buf[:n]))
+	return mediaType, err
+}
+
+// 处理上传的图片：去除EXIF等元数据、按方向信息旋转、缩小过宽的图片，并生成缩略图和WebP版本
+// 返回的第一张为处理后的原图
+func Process(data []byte, contentType string, options Options) ([]*Image, error) {
+	if options.MaxWidth <= 0 {
+		options.MaxWidth = DefaultMaxWidth
+	}
+	if options.ThumbnailWidth <= 0 {
+		options.ThumbnailWidth = DefaultThumbnailWidth
+	}
+	if options.MaxPixels <= 0 {
+		options.MaxPixels = DefaultMaxPixels
+	}
+	switch contentType {
+	case "image/jpeg", "image/png":
+	case "image/gif":
+		// 保留动画，GIF不包含EXIF
+		config, err := gif.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return []*Image{{Data: data, ContentType: contentType, Width: config.Width, Height: config.Height}}, nil
+	case "image/webp":
+		// 标准库无法解码WebP，只去除元数据
+		stripped, err := stripWebpMetadata(data)
+		if err != nil {
+			return nil, err
+		}
+		return []*Image{{Data: stripped, ContentType: contentType}}, nil
+	default:
+		return nil, errors.Errorf("unsupported image type %s", contentType)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if int64(config.Width)*int64(config.Height) > int64(options.MaxPixels) {
+		return nil, errors.Wrapf(ErrTooManyPixels, "%dx%d", config.Width, config.Height)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if contentType == "image/jpeg" {
+		src = orient(src, jpegOrientation(data))
+	}
+	if src.Bounds().Dx() > options.MaxWidth {
+		src = resize(src, options.MaxWidth)
+	}
+	images := make([]*Image, 0, 4)
+	original, err := encode(src, "", contentType)
+	if err != nil {
+		return nil, err
+	}
+	images = append(images, original)
+	var thumbnail image.Image
+	if src.Bounds().Dx() > options.ThumbnailWidth {
+		thumbnail = resize(src, options.ThumbnailWidth)
+		thumb, err := encode(thumbnail, "thumb", contentType)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, thumb)
+	}
+
+	if options.WebpEncoder != "" {
+		webps := []*Image{original}
+		if len(images) > 1 {
+			webps = append(webps, images[1])
+		}
+		for _, img := range webps {
+			webp, err := encodeWebp(options.WebpEncoder, img)
+			if err != nil {
+				return nil, err
+			}
+			images = append(images, webp)
+		}
+	}
+	return images, nil
+}
+
+func encode(img image.Image, name, contentType string) (*Image, error) {
+	var buf bytes.Buffer
+	var err error
+	if contentType == "image/png" {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Image{
+		Name:        name,
+		Data:        buf.Bytes(),
+		ContentType: contentType,
+		Width:       img.Bounds().Dx(),
+		Height:      img.Bounds().Dy(),
+	}, nil
+}
+
+// 按宽度等比缩小，每个目标像素取对应源区域的平均值
+func resize(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	sw, sh := bounds.Dx(), bounds.Dy()
+	if width >= sw {
+		return img
+	}
+	height := sh * width / sw
+	if height < 1 {
+		height = 1
+	}
+	src := image.NewNRGBA(image.Rect(0, 0, sw, sh))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*sh/height, (y+1)*sh/height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0, x1 := x*sw/width, (x+1)*sw/width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					pa := uint64(src.Pix[i+3])
+					r += uint64(src.Pix[i]) * pa
+					g += uint64(src.Pix[i+1]) * pa
+					b += uint64(src.Pix[i+2]) * pa
+					a += pa
+					n++
+					i += 4
+				}
+			}
+			i := dst.PixOffset(x, y)
+			if a > 0 {
+				dst.Pix[i] = uint8(r / a)
+				dst.Pix[i+1] = uint8(g / a)
+				dst.Pix[i+2] = uint8(b / a)
+			}
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
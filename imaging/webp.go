@@ -0,0 +1,82 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	webpQuality  = "80"
+	vp8xExifFlag = 0x08
+	vp8xXmpFlag  = 0x04
+)
+
+// 去除WebP中的EXIF和XMP块
+func stripWebpMetadata(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errors.New("invalid webp file")
+	}
+	var buf bytes.Buffer
+	buf.Write(data[:12])
+	for i := 12; i < len(data); {
+		if i+8 > len(data) {
+			return nil, errors.New("invalid webp chunk")
+		}
+		fourcc := string(data[i : i+4])
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + size + size%2
+		if size < 0 || end > len(data) {
+			return nil, errors.New("invalid webp chunk")
+		}
+		switch fourcc {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[i:end]...)
+			if size > 0 {
+				chunk[8] &^= vp8xExifFlag | vp8xXmpFlag
+			}
+			buf.Write(chunk)
+		default:
+			buf.Write(data[i:end])
+		}
+		i = end
+	}
+	stripped := buf.Bytes()
+	binary.LittleEndian.PutUint32(stripped[4:], uint32(len(stripped)-8))
+	return stripped, nil
+}
+
+// 调用cwebp将JPEG/PNG图片转换为WebP
+func encodeWebp(encoder string, img *Image) (*Image, error) {
+	dir, err := ioutil.TempDir("", "webp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, "input"+Ext(img.ContentType))
+	output := filepath.Join(dir, "output.webp")
+	if err = ioutil.WriteFile(input, img.Data, 0600); err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(encoder, "-quiet", "-metadata", "none", "-q", webpQuality, input, "-o", output)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, errors.Wrapf(err, "cwebp: %s", out)
+	}
+	data, err := ioutil.ReadFile(output)
+	if err != nil {
+		return nil, err
+	}
+	return &Image{
+		Name:        img.Name,
+		Data:        data,
+		ContentType: "image/webp",
+		Width:       img.Width,
+		Height:      img.Height,
+	}, nil
+}
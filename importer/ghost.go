@@ -0,0 +1,141 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"blog/helpers"
+)
+
+// Ghost导出文件，新版本在db数组中，旧版本直接是data
+type ghostExport struct {
+	Db   []*ghostDb `json:"db"`
+	Data *ghostData `json:"data"`
+}
+
+type ghostDb struct {
+	Data *ghostData `json:"data"`
+}
+
+type ghostData struct {
+	Posts     []*ghostPost `json:"posts"`
+	Tags      []*ghostTag  `json:"tags"`
+	PostsTags []*struct {
+		PostId ghostId `json:"post_id"`
+		TagId  ghostId `json:"tag_id"`
+	} `json:"posts_tags"`
+}
+
+type ghostPost struct {
+	Id          ghostId   `json:"id"`
+	Title       string    `json:"title"`
+	Slug        string    `json:"slug"`
+	Markdown    string    `json:"markdown"` // 1.0之前的版本
+	Html        string    `json:"html"`
+	Status      string    `json:"status"`
+	Type        string    `json:"type"` // 2.0之后的版本
+	Page        ghostBool `json:"page"` // 2.0之前的版本
+	CreatedAt   ghostTime `json:"created_at"`
+	PublishedAt ghostTime `json:"published_at"`
+	UpdatedAt   ghostTime `json:"updated_at"`
+}
+
+type ghostTag struct {
+	Id   ghostId `json:"id"`
+	Name string  `json:"name"`
+}
+
+// 旧版本的id是数字，新版本是字符串
+type ghostId string
+
+func (id *ghostId) UnmarshalJSON(data []byte) error {
+	*id = ghostId(strings.Trim(string(data), `"`))
+	return nil
+}
+
+// 旧版本的page是0/1
+type ghostBool bool
+
+func (b *ghostBool) UnmarshalJSON(data []byte) error {
+	value := string(data)
+	*b = ghostBool(value == "true" || value == "1")
+	return nil
+}
+
+// 时间为ISO 8601字符串或毫秒时间戳
+type ghostTime time.Time
+
+func (t *ghostTime) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	var millis int64
+	if err := json.Unmarshal(data, &millis); err == nil {
+		*t = ghostTime(time.Unix(0, millis*int64(time.Millisecond)).In(helpers.GetCurrentTime().Location()))
+		return nil
+	}
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	*t = ghostTime(parseTime(value))
+	return nil
+}
+
+// LoadGhost 读取Ghost导出的JSON文件，旧版本优先使用Markdown正文，新版本使用HTML正文
+func LoadGhost(path string) ([]*Document, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var export ghostExport
+	if err = json.Unmarshal(content, &export); err != nil {
+		return nil, err
+	}
+	data := export.Data
+	if len(export.Db) > 0 {
+		data = export.Db[0].Data
+	}
+	if data == nil {
+		return nil, errors.New("not a ghost export")
+	}
+
+	tags := make(map[ghostId]string)
+	for _, tag := range data.Tags {
+		tags[tag.Id] = tag.Name
+	}
+	postTags := make(map[ghostId][]string)
+	for _, pt := range data.PostsTags {
+		if name, ok := tags[pt.TagId]; ok {
+			postTags[pt.PostId] = append(postTags[pt.PostId], name)
+		}
+	}
+
+	var docs []*Document
+	for _, post := range data.Posts {
+		body := post.Markdown
+		if body == "" {
+			body = post.Html
+		}
+		createdAt := time.Time(post.PublishedAt)
+		if createdAt.IsZero() {
+			createdAt = time.Time(post.CreatedAt)
+		}
+		docs = append(docs, &Document{
+			Source:    "ghost:" + post.Slug,
+			IsPage:    post.Type == "page" || bool(post.Page),
+			Title:     strings.TrimSpace(post.Title),
+			Body:      strings.TrimSpace(body),
+			Tags:      postTags[post.Id],
+			CreatedAt: createdAt,
+			UpdatedAt: time.Time(post.UpdatedAt),
+			Published: post.Status == "published",
+		})
+	}
+	return docs, nil
+}
@@ -0,0 +1,321 @@
+package importer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+
+	"blog/helpers"
+	"blog/models"
+)
+
+// 支持的导入格式
+const (
+	FormatMarkdown  = "markdown"  // Hugo/Jekyll等带front matter的Markdown目录
+	FormatWordpress = "wordpress" // WordPress导出的WXR文件
+	FormatGhost     = "ghost"     // Ghost导出的JSON文件
+)
+
+// 从其他平台读取的一篇文章或页面
+type Document struct {
+	Source    string // 来源，用于报告
+	IsPage    bool
+	Title     string
+	Body      string
+	Tags      []string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Published bool
+	View      int
+	Comments  []*Comment
+}
+
+// 文章的评论，作者按邮箱对应到用户，没有邮箱时按昵称
+type Comment struct {
+	Author    string
+	Email     string
+	Content   string
+	CreatedAt time.Time
+}
+
+// 导入结果，dry run时为将要创建的内容
+type Report struct {
+	DryRun   bool
+	Posts    int
+	Pages    int
+	Tags     int
+	Comments int
+	Users    int
+	Skipped  []string
+}
+
+func (report *Report) String() string {
+	var b strings.Builder
+	if report.DryRun {
+		b.WriteString("dry run, nothing was written\n")
+	}
+	fmt.Fprintf(&b, "posts: %d\npages: %d\ntags: %d\ncomments: %d\nusers: %d\nskipped: %d\n",
+		report.Posts, report.Pages, report.Tags, report.Comments, report.Users, len(report.Skipped))
+	for _, skipped := range report.Skipped {
+		b.WriteString("  " + skipped + "\n")
+	}
+	return b.String()
+}
+
+// DetectFormat 根据路径推断格式：目录为Markdown，.xml为WordPress，.json为Ghost
+func DetectFormat(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return FormatMarkdown, nil
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".xml":
+		return FormatWordpress, nil
+	case ".json":
+		return FormatGhost, nil
+	}
+	return "", errors.Errorf("cannot detect format of %s", path)
+}
+
+// Load 读取指定格式的导出内容
+func Load(format, path string) ([]*Document, error) {
+	switch format {
+	case FormatMarkdown:
+		return LoadMarkdown(path)
+	case FormatWordpress:
+		return LoadWordpress(path)
+	case FormatGhost:
+		return LoadGhost(path)
+	}
+	return nil, errors.Errorf("unknown format %s", format)
+}
+
+// Import 在一个事务中创建文章、页面、标签和评论，保留原始时间；
+// 标题和创建时间都相同的内容视为已导入而跳过。dryRun时回滚事务，只返回报告
+func Import(docs []*Document, dryRun bool) (report *Report, err error) {
+	report = &Report{DryRun: dryRun}
+	tx := models.DB.Begin()
+	if err = tx.Error; err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil || dryRun {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit().Error
+	}()
+	state := &importState{
+		tx:     tx,
+		report: report,
+		tags:   make(map[string]uint),
+		users:  make(map[string]uint),
+	}
+	for _, doc := range docs {
+		if err = state.importDocument(doc); err != nil {
+			return nil, errors.Wrap(err, doc.Source)
+		}
+	}
+	return report, nil
+}
+
+type importState struct {
+	tx     *gorm.DB
+	report *Report
+	tags   map[string]uint // 标签名 -> id
+	users  map[string]uint // 邮箱或昵称 -> id
+}
+
+func (state *importState) importDocument(doc *Document) error {
+	if doc.Title == "" {
+		state.report.Skipped = append(state.report.Skipped, doc.Source+": empty title")
+		return nil
+	}
+	if doc.CreatedAt.IsZero() {
+		doc.CreatedAt = helpers.GetCurrentTime()
+	}
+	if doc.UpdatedAt.IsZero() || doc.UpdatedAt.Before(doc.CreatedAt) {
+		doc.UpdatedAt = doc.CreatedAt
+	}
+	if doc.IsPage {
+		return state.importPage(doc)
+	}
+	return state.importPost(doc)
+}
+
+func (state *importState) importPage(doc *Document) error {
+	var count int
+	err := state.tx.Model(&models.Page{}).Where("title = ? and created_at = ?", doc.Title, doc.CreatedAt).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		state.report.Skipped = append(state.report.Skipped, doc.Source+": page already exists")
+		return nil
+	}
+	page := &models.Page{
+		Title:       doc.Title,
+		Body:        doc.Body,
+		View:        doc.View,
+		IsPublished: doc.Published,
+	}
+	page.CreatedAt = doc.CreatedAt
+	page.UpdatedAt = doc.UpdatedAt
+	if err = state.tx.Create(page).Error; err != nil {
+		return err
+	}
+	state.report.Pages++
+	return nil
+}
+
+func (state *importState) importPost(doc *Document) error {
+	var count int
+	err := state.tx.Model(&models.Post{}).Where("title = ? and created_at = ?", doc.Title, doc.CreatedAt).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		state.report.Skipped = append(state.report.Skipped, doc.Source+": post already exists")
+		return nil
+	}
+	post := &models.Post{
+		Title:       doc.Title,
+		Body:        doc.Body,
+		View:        doc.View,
+		IsPublished: doc.Published,
+	}
+	post.CreatedAt = doc.CreatedAt
+	post.UpdatedAt = doc.UpdatedAt
+	// 导入的文章以原创建时间作为发布时间，不会出现在之后的摘要中
+	if post.IsPublished {
+		post.PublishedAt = &post.CreatedAt
+	}
+	if err = state.tx.Create(post).Error; err != nil {
+		return err
+	}
+	state.report.Posts++
+
+	added := make(map[uint]bool)
+	for _, name := range doc.Tags {
+		tagId, err := state.tagId(name)
+		if err != nil {
+			return err
+		}
+		if tagId == 0 || added[tagId] {
+			continue
+		}
+		added[tagId] = true
+		if err = state.tx.Create(&models.PostTag{PostId: post.ID, TagId: tagId}).Error; err != nil {
+			return err
+		}
+	}
+	for _, c := range doc.Comments {
+		if strings.TrimSpace(c.Content) == "" {
+			continue
+		}
+		userId, err := state.userId(c)
+		if err != nil {
+			return err
+		}
+		comment := &models.Comment{
+			UserID:    userId,
+			Content:   c.Content,
+			PostID:    post.ID,
+			ReadState: true,
+		}
+		comment.CreatedAt = c.CreatedAt
+		if comment.CreatedAt.IsZero() {
+			comment.CreatedAt = doc.CreatedAt
+		}
+		comment.UpdatedAt = comment.CreatedAt
+		if err = state.tx.Create(comment).Error; err != nil {
+			return err
+		}
+		state.report.Comments++
+	}
+	return nil
+}
+
+// 按名称查找标签，不存在时创建
+func (state *importState) tagId(name string) (uint, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return 0, nil
+	}
+	if id, ok := state.tags[name]; ok {
+		return id, nil
+	}
+	var tag models.Tag
+	err := state.tx.First(&tag, "name = ?", name).Error
+	if gorm.IsRecordNotFoundError(err) {
+		tag.Name = name
+		err = state.tx.Create(&tag).Error
+		state.report.Tags++
+	}
+	if err != nil {
+		return 0, err
+	}
+	state.tags[name] = tag.ID
+	return tag.ID, nil
+}
+
+// 评论作者对应的用户，按邮箱查找，没有邮箱时同一次导入中按昵称复用
+func (state *importState) userId(c *Comment) (uint, error) {
+	email := strings.ToLower(strings.TrimSpace(c.Email))
+	key := "email:" + email
+	if email == "" {
+		key = "name:" + c.Author
+	}
+	if id, ok := state.users[key]; ok {
+		return id, nil
+	}
+	var user models.User
+	err := gorm.ErrRecordNotFound
+	if email != "" {
+		err = state.tx.First(&user, "email = ?", email).Error
+	}
+	if gorm.IsRecordNotFoundError(err) {
+		user = models.User{
+			Email:    email,
+			NickName: c.Author,
+		}
+		err = state.tx.Create(&user).Error
+		state.report.Users++
+	}
+	if err != nil {
+		return 0, err
+	}
+	state.users[key] = user.ID
+	return user.ID, nil
+}
+
+// 依次尝试常见的时间格式，没有时区的按本地时区解析
+func parseTime(value string) time.Time {
+	value = strings.TrimSpace(value)
+	layouts := []string{
+		time.RFC3339Nano,
+		"2006-01-02T15:04:05",
+		"2006-01-02 15:04:05 -0700",
+		"2006-01-02 15:04:05 -07:00",
+		"2006-01-02 15:04:05",
+		"2006-01-02 15:04",
+		"2006-01-02",
+		time.RFC1123Z,
+		time.RFC1123,
+	}
+	loc := helpers.GetCurrentTime().Location()
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,235 @@
+package importer
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-yaml/yaml"
+)
+
+// Jekyll文章的文件名格式，如2019-01-02-hello-world.md
+var jekyllFileRegexp = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})-(.+)$`)
+
+// LoadMarkdown 读取目录下带front matter的Markdown文件，支持YAML(---)和TOML(+++)格式；
+// type/layout为page或位于pages、_pages目录下的文件作为页面，Hugo的_index.md跳过
+func LoadMarkdown(dir string) ([]*Document, error) {
+	var docs []*Document
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := info.Name()
+		if info.IsDir() {
+			if path != dir && strings.HasPrefix(name, ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".md", ".markdown", ".mdown":
+		default:
+			return nil
+		}
+		if strings.HasPrefix(name, "_index.") {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, path)
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		doc, err := parseMarkdown(rel, string(data))
+		if err != nil {
+			return fmt.Errorf("%s: %v", rel, err)
+		}
+		if doc.CreatedAt.IsZero() {
+			doc.CreatedAt = info.ModTime()
+		}
+		docs = append(docs, doc)
+		return nil
+	})
+	return docs, err
+}
+
+func parseMarkdown(rel, content string) (*Document, error) {
+	content = strings.TrimPrefix(strings.Replace(content, "\r\n", "\n", -1), "\ufeff")
+	matter := map[string]interface{}{}
+	body := content
+	for _, delimiter := range []string{"---", "+++"} {
+		if !strings.HasPrefix(content, delimiter+"\n") {
+			continue
+		}
+		rest := content[len(delimiter)+1:]
+		end := strings.Index(rest, "\n"+delimiter)
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated front matter")
+		}
+		header := rest[:end+1]
+		body = rest[end+1+len(delimiter):]
+		if index := strings.Index(body, "\n"); index >= 0 {
+			body = body[index+1:]
+		} else {
+			body = ""
+		}
+		var err error
+		if delimiter == "---" {
+			err = yaml.Unmarshal([]byte(header), &matter)
+		} else {
+			matter, err = parseToml(header)
+		}
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+
+	base := strings.TrimSuffix(filepath.Base(rel), filepath.Ext(rel))
+	doc := &Document{
+		Source:    rel,
+		Title:     stringValue(matter["title"]),
+		Body:      strings.TrimLeft(body, "\n"),
+		CreatedAt: timeValue(matter["date"]),
+		Published: true,
+		View:      intValue(matter["views"]),
+	}
+	if match := jekyllFileRegexp.FindStringSubmatch(base); match != nil {
+		if doc.CreatedAt.IsZero() {
+			doc.CreatedAt = parseTime(match[1])
+		}
+		base = match[2]
+	}
+	if doc.Title == "" {
+		doc.Title = strings.Replace(base, "-", " ", -1)
+	}
+	for _, key := range []string{"lastmod", "updated", "last_modified_at"} {
+		if t := timeValue(matter[key]); !t.IsZero() {
+			doc.UpdatedAt = t
+			break
+		}
+	}
+	if draft, ok := matter["draft"].(bool); ok && draft {
+		doc.Published = false
+	}
+	if published, ok := matter["published"].(bool); ok {
+		doc.Published = published
+	}
+	for _, segment := range strings.Split(filepath.ToSlash(filepath.Dir(rel)), "/") {
+		switch segment {
+		case "pages", "_pages":
+			doc.IsPage = true
+		case "_drafts":
+			doc.Published = false
+		}
+	}
+	if stringValue(matter["type"]) == "page" || stringValue(matter["layout"]) == "page" {
+		doc.IsPage = true
+	}
+	doc.Tags = append(listValue(matter["tags"]), listValue(matter["categories"])...)
+	return doc, nil
+}
+
+// 解析Hugo常用的TOML front matter：字符串、布尔、数字、日期和字符串数组，忽略表
+func parseToml(header string) (map[string]interface{}, error) {
+	matter := map[string]interface{}{}
+	scanner := bufio.NewScanner(strings.NewReader(header))
+	var key, pending string
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if pending != "" {
+			pending += " " + line
+			if strings.HasSuffix(line, "]") {
+				matter[key] = tomlValue(pending)
+				pending = ""
+			}
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "[") {
+			continue
+		}
+		index := strings.Index(line, "=")
+		if index < 0 {
+			return nil, fmt.Errorf("invalid toml line %q", line)
+		}
+		key = strings.Trim(strings.TrimSpace(line[:index]), `"`)
+		value := strings.TrimSpace(line[index+1:])
+		if strings.HasPrefix(value, "[") && !strings.HasSuffix(value, "]") {
+			pending = value
+			continue
+		}
+		matter[key] = tomlValue(value)
+	}
+	return matter, scanner.Err()
+}
+
+func tomlValue(value string) interface{} {
+	switch {
+	case strings.HasPrefix(value, "["):
+		var items []interface{}
+		for _, item := range strings.Split(strings.Trim(value, "[]"), ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, tomlValue(item))
+			}
+		}
+		return items
+	case strings.HasPrefix(value, `"`):
+		if s, err := strconv.Unquote(value); err == nil {
+			return s
+		}
+		return strings.Trim(value, `"`)
+	case strings.HasPrefix(value, "'"):
+		return strings.Trim(value, "'")
+	case value == "true" || value == "false":
+		return value == "true"
+	}
+	if n, err := strconv.Atoi(value); err == nil {
+		return n
+	}
+	return value
+}
+
+func stringValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return strings.TrimSpace(fmt.Sprint(v))
+}
+
+func intValue(v interface{}) int {
+	n, _ := v.(int)
+	return n
+}
+
+func timeValue(v interface{}) time.Time {
+	switch t := v.(type) {
+	case time.Time:
+		return t
+	case string:
+		return parseTime(t)
+	}
+	return time.Time{}
+}
+
+// 列表或以逗号、空格分隔的字符串(Jekyll)
+func listValue(v interface{}) []string {
+	var values []string
+	switch list := v.(type) {
+	case []interface{}:
+		for _, item := range list {
+			if s := stringValue(item); s != "" {
+				values = append(values, s)
+			}
+		}
+	case string:
+		values = strings.FieldsFunc(list, func(r rune) bool {
+			return r == ',' || r == ' '
+		})
+	}
+	return values
+}
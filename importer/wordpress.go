@@ -0,0 +1,109 @@
+package importer
+
+import (
+	"encoding/xml"
+	"os"
+	"strings"
+	"time"
+
+	"blog/helpers"
+)
+
+// WXR文件，wp:前缀的命名空间随版本变化，只按本地名匹配，content:encoded需要区分excerpt:encoded
+type wxrRss struct {
+	Items []*wxrItem `xml:"channel>item"`
+}
+
+type wxrItem struct {
+	Title       string         `xml:"title"`
+	Content     string         `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	PostName    string         `xml:"post_name"`
+	PostType    string         `xml:"post_type"`
+	Status      string         `xml:"status"`
+	PostDate    string         `xml:"post_date"`
+	PostDateGmt string         `xml:"post_date_gmt"`
+	ModifiedGmt string         `xml:"post_modified_gmt"`
+	Categories  []*wxrCategory `xml:"category"`
+	Comments    []*wxrComment  `xml:"comment"`
+}
+
+type wxrCategory struct {
+	Domain string `xml:"domain,attr"`
+	Name   string `xml:",chardata"`
+}
+
+type wxrComment struct {
+	Author      string `xml:"comment_author"`
+	AuthorEmail string `xml:"comment_author_email"`
+	DateGmt     string `xml:"comment_date_gmt"`
+	Date        string `xml:"comment_date"`
+	Content     string `xml:"comment_content"`
+	Approved    string `xml:"comment_approved"`
+	Type        string `xml:"comment_type"`
+}
+
+// LoadWordpress 读取WordPress导出的WXR文件，导入文章和页面及其已审核的评论，
+// 草稿和私密内容导入为未发布，回收站、修订版本和附件跳过
+func LoadWordpress(path string) ([]*Document, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var rss wxrRss
+	decoder := xml.NewDecoder(file)
+	decoder.Strict = false
+	if err = decoder.Decode(&rss); err != nil {
+		return nil, err
+	}
+	var docs []*Document
+	for _, item := range rss.Items {
+		if item.PostType != "post" && item.PostType != "page" {
+			continue
+		}
+		switch item.Status {
+		case "trash", "auto-draft", "inherit":
+			continue
+		}
+		doc := &Document{
+			Source:    "wordpress:" + item.PostType + ":" + item.PostName,
+			IsPage:    item.PostType == "page",
+			Title:     strings.TrimSpace(item.Title),
+			Body:      strings.TrimSpace(item.Content),
+			CreatedAt: wxrTime(item.PostDateGmt, item.PostDate),
+			UpdatedAt: wxrTime(item.ModifiedGmt, ""),
+			Published: item.Status == "publish",
+		}
+		for _, category := range item.Categories {
+			if category.Domain == "post_tag" || category.Domain == "category" {
+				doc.Tags = append(doc.Tags, strings.TrimSpace(category.Name))
+			}
+		}
+		for _, comment := range item.Comments {
+			if comment.Approved != "1" || (comment.Type != "" && comment.Type != "comment") {
+				continue
+			}
+			doc.Comments = append(doc.Comments, &Comment{
+				Author:    comment.Author,
+				Email:     comment.AuthorEmail,
+				Content:   comment.Content,
+				CreatedAt: wxrTime(comment.DateGmt, comment.Date),
+			})
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// 优先使用GMT时间，草稿的GMT时间为0000-00-00 00:00:00，此时使用站点本地时间
+func wxrTime(gmt, local string) time.Time {
+	if gmt != "" && !strings.HasPrefix(gmt, "0000") {
+		if t, err := time.Parse("2006-01-02 15:04:05", gmt); err == nil {
+			return t.In(helpers.GetCurrentTime().Location())
+		}
+	}
+	if local != "" && !strings.HasPrefix(local, "0000") {
+		return parseTime(local)
+	}
+	return time.Time{}
+}
@@ -0,0 +1,196 @@
+package mailer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// 退信类型
+const (
+	BounceHard      = "hard"      // 永久失败，如邮箱不存在
+	BounceSoft      = "soft"      // 临时失败，如邮箱已满
+	BounceComplaint = "complaint" // 收件人投诉为垃圾邮件
+)
+
+// 一个收件人的退信信息
+type Bounce struct {
+	Email     string // 收件人
+	Type      string // 退信类型
+	Action    string // DSN中的Action字段
+	Status    string // DSN中的Status字段，如5.1.1
+	MessageId string // 退信邮件的Message-ID，用于识别重复收到的同一封退信
+}
+
+// 解析退信邮件，支持RFC 3464的投递状态通知(DSN)和RFC 5965的投诉反馈(ARF)
+func ParseBounce(r io.Reader) ([]*Bounce, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	bounces, err := parsePart(textproto.MIMEHeader(msg.Header), msg.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(bounces) == 0 {
+		return nil, errors.New("not a delivery status notification")
+	}
+	messageId := strings.TrimSpace(msg.Header.Get("Message-Id"))
+	for _, bounce := range bounces {
+		bounce.MessageId = messageId
+	}
+	return bounces, nil
+}
+
+func parsePart(header textproto.MIMEHeader, body io.Reader) ([]*Bounce, error) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return nil, nil
+	}
+	body = decodeTransferEncoding(header.Get("Content-Transfer-Encoding"), body)
+	switch {
+	case mediaType == "message/delivery-status":
+		return parseDeliveryStatus(body)
+	case strings.HasPrefix(mediaType, "multipart/"):
+		var (
+			bounces  []*Bounce
+			original string
+			feedback []*Bounce
+		)
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+			switch partType {
+			case "message/feedback-report":
+				feedback, err = parseFeedbackReport(part)
+			case "message/rfc822", "text/rfc822-headers":
+				original = originalRecipient(part)
+			default:
+				var found []*Bounce
+				found, err = parsePart(part.Header, part)
+				bounces = append(bounces, found...)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		// 投诉报告中没有Original-Rcpt-To时，使用原始邮件的收件人
+		for _, bounce := range feedback {
+			if bounce.Email == "" {
+				bounce.Email = original
+			}
+			if bounce.Email != "" {
+				bounces = append(bounces, bounce)
+			}
+		}
+		return bounces, nil
+	}
+	return nil, nil
+}
+
+// 投递状态由空行分隔的多组字段组成，第一组是整封邮件的信息，其余每组对应一个收件人
+func parseDeliveryStatus(body io.Reader) ([]*Bounce, error) {
+	var bounces []*Bounce
+	reader := textproto.NewReader(bufio.NewReader(body))
+	for {
+		fields, err := reader.ReadMIMEHeader()
+		if recipient := addressField(fields.Get("Final-Recipient")); recipient != "" {
+			action := strings.ToLower(strings.TrimSpace(fields.Get("Action")))
+			status := strings.TrimSpace(fields.Get("Status"))
+			if status != "" {
+				status = strings.Fields(status)[0]
+			}
+			var bounceType string
+			switch {
+			case action == "failed" && strings.HasPrefix(status, "5"):
+				bounceType = BounceHard
+			case action == "failed" || action == "delayed":
+				bounceType = BounceSoft
+			}
+			if bounceType != "" {
+				bounces = append(bounces, &Bounce{
+					Email:  recipient,
+					Type:   bounceType,
+					Action: action,
+					Status: status,
+				})
+			}
+		}
+		if err == io.EOF {
+			return bounces, nil
+		}
+		if err != nil {
+			return bounces, err
+		}
+	}
+}
+
+func parseFeedbackReport(body io.Reader) ([]*Bounce, error) {
+	fields, err := textproto.NewReader(bufio.NewReader(body)).ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if fields.Get("Feedback-Type") == "" {
+		return nil, nil
+	}
+	return []*Bounce{{
+		Email:  addressField(fields.Get("Original-Rcpt-To")),
+		Type:   BounceComplaint,
+		Action: strings.ToLower(fields.Get("Feedback-Type")),
+	}}, nil
+}
+
+func originalRecipient(body io.Reader) string {
+	header, err := textproto.NewReader(bufio.NewReader(body)).ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return ""
+	}
+	addrs, err := mail.Header(header).AddressList("To")
+	if err != nil || len(addrs) == 0 {
+		return ""
+	}
+	return addrs[0].Address
+}
+
+// 解析"rfc822; user@example.com"格式的地址字段
+func addressField(value string) string {
+	if index := strings.Index(value, ";"); index >= 0 {
+		value = value[index+1:]
+	}
+	return strings.Trim(strings.TrimSpace(value), "<>")
+}
+
+func decodeTransferEncoding(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		data, err := ioutil.ReadAll(body)
+		if err != nil {
+			return body
+		}
+		decoded, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(data)), ""))
+		if err != nil {
+			return bytes.NewReader(data)
+		}
+		return bytes.NewReader(decoded)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	}
+	return body
+}
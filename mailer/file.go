@@ -0,0 +1,110 @@
+package mailer
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const DefaultMailDir = "mails"
+
+// 将邮件以.eml文件写入本地目录，文件名即邮件ID
+type FileTransport struct {
+	Dir string
+}
+
+func (t *FileTransport) dir() string {
+	if t.Dir == "" {
+		return DefaultMailDir
+	}
+	return t.Dir
+}
+
+func (t *FileTransport) Send(msg *Message) error {
+	if err := os.MkdirAll(t.dir(), os.ModePerm); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(t.dir(), msg.ID+".eml"), msg.Bytes(), 0644)
+}
+
+// 按发送时间倒序列出邮件
+func (t *FileTransport) List() ([]*Message, error) {
+	files, err := ioutil.ReadDir(t.dir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().After(files[j].ModTime())
+	})
+	messages := make([]*Message, 0, len(files))
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".eml" {
+			continue
+		}
+		msg, err := t.Get(strings.TrimSuffix(file.Name(), ".eml"))
+		if err != nil {
+			continue
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+func (t *FileTransport) Get(id string) (*Message, error) {
+	if id == "" || id != filepath.Base(id) {
+		return nil, errors.New("invalid message id")
+	}
+	data, err := ioutil.ReadFile(filepath.Join(t.dir(), id+".eml"))
+	if err != nil {
+		return nil, err
+	}
+	return parseMessage(id, data)
+}
+
+func parseMessage(id string, data []byte) (*Message, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(m.Body)
+	if err != nil {
+		return nil, err
+	}
+	decoder := new(mime.WordDecoder)
+	subject, err := decoder.DecodeHeader(m.Header.Get("Subject"))
+	if err != nil {
+		subject = m.Header.Get("Subject")
+	}
+	msg := &Message{
+		ID:          id,
+		From:        m.Header.Get("From"),
+		Subject:     subject,
+		Body:        string(body),
+		ContentType: m.Header.Get("Content-Type"),
+		Headers:     make(map[string]string),
+	}
+	msg.Date, _ = m.Header.Date()
+	if addrs, err := m.Header.AddressList("To"); err == nil {
+		for _, addr := range addrs {
+			msg.To = append(msg.To, addr.Address)
+		}
+	}
+	for key := range m.Header {
+		switch key {
+		case "Message-Id", "Date", "From", "To", "Subject", "Mime-Version", "Content-Type":
+		default:
+			msg.Headers[key] = m.Header.Get(key)
+		}
+	}
+	return msg, nil
+}
@@ -0,0 +1,124 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"blog/system"
+)
+
+const (
+	TransportSmtp   = "smtp"   // 通过smtp服务器发送
+	TransportFile   = "file"   // 写入本地目录的.eml文件，用于开发环境
+	TransportMemory = "memory" // 保存在内存中，用于开发环境
+)
+
+// 邮件
+type Message struct {
+	ID          string            // 唯一标识
+	From        string            // 发件人
+	To          []string          // 收件人
+	Subject     string            // 主题
+	Body        string            // 正文
+	ContentType string            // 正文类型，如text/html
+	Headers     map[string]string // 附加邮件头，如List-Unsubscribe
+	Date        time.Time         // 发送时间
+}
+
+// 邮件发送方式
+type Transport interface {
+	Send(msg *Message) error
+}
+
+// 可以列出已发送邮件的发送方式，用于后台预览
+type Outbox interface {
+	List() ([]*Message, error)
+	Get(id string) (*Message, error)
+}
+
+var (
+	transport Transport
+	sequence  uint64
+)
+
+// 根据配置初始化邮件发送方式
+func InitTransport() error {
+	c := system.GetConfiguration()
+	switch c.MailTransport {
+	case "", TransportSmtp:
+		transport = &SmtpTransport{Username: c.SmtpUsername, Password: c.SmtpPassword, Host: c.SmtpHost}
+	case TransportFile:
+		transport = &FileTransport{Dir: c.MailDir}
+	case TransportMemory:
+		transport = NewMemoryTransport(DefaultMemoryLimit)
+	default:
+		return fmt.Errorf("unknown mail transport %s", c.MailTransport)
+	}
+	return nil
+}
+
+func GetTransport() Transport {
+	return transport
+}
+
+// 通过当前配置的方式发送邮件
+func Send(msg *Message) error {
+	if transport == nil {
+		return errors.New("mail transport is not initialized")
+	}
+	return transport.Send(msg)
+}
+
+// 构造邮件，to为以";"分隔的收件人
+func NewMessage(from, to, subject, body, contentType string) *Message {
+	recipients := make([]string, 0)
+	for _, addr := range strings.Split(to, ";") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			recipients = append(recipients, addr)
+		}
+	}
+	now := time.Now()
+	return &Message{
+		ID:          fmt.Sprintf("%s-%d", now.Format("20060102150405"), atomic.AddUint64(&sequence, 1)),
+		From:        from,
+		To:          recipients,
+		Subject:     subject,
+		Body:        body,
+		ContentType: contentType,
+		Headers:     make(map[string]string),
+		Date:        now,
+	}
+}
+
+// 按RFC 5322格式输出邮件
+func (msg *Message) Bytes() []byte {
+	var buf bytes.Buffer
+	writeHeader := func(key, value string) {
+		buf.WriteString(key + ": " + value + "\r\n")
+	}
+	writeHeader("Message-ID", fmt.Sprintf("<%s@blog>", msg.ID))
+	writeHeader("Date", msg.Date.Format(time.RFC1123Z))
+	writeHeader("From", msg.From)
+	writeHeader("To", strings.Join(msg.To, ", "))
+	writeHeader("Subject", mime.BEncoding.Encode("UTF-8", msg.Subject))
+	keys := make([]string, 0, len(msg.Headers))
+	for key := range msg.Headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		writeHeader(key, msg.Headers[key])
+	}
+	writeHeader("MIME-Version", "1.0")
+	writeHeader("Content-Type", msg.ContentType+"; charset=UTF-8")
+	buf.WriteString("\r\n")
+	buf.WriteString(msg.Body)
+	return buf.Bytes()
+}
@@ -0,0 +1,59 @@
+package mailer
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const DefaultMemoryLimit = 100
+
+// 将邮件保存在内存中，最多保留limit封
+type MemoryTransport struct {
+	mu       sync.RWMutex
+	limit    int
+	messages []*Message
+}
+
+func NewMemoryTransport(limit int) *MemoryTransport {
+	return &MemoryTransport{limit: limit}
+}
+
+func (t *MemoryTransport) Send(msg *Message) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.messages = append(t.messages, msg)
+	if t.limit > 0 && len(t.messages) > t.limit {
+		t.messages = t.messages[len(t.messages)-t.limit:]
+	}
+	return nil
+}
+
+// 按发送时间倒序列出邮件
+func (t *MemoryTransport) List() ([]*Message, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	messages := make([]*Message, 0, len(t.messages))
+	for i := len(t.messages) - 1; i >= 0; i-- {
+		messages = append(messages, t.messages[i])
+	}
+	return messages, nil
+}
+
+func (t *MemoryTransport) Get(id string) (*Message, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, msg := range t.messages {
+		if msg.ID == id {
+			return msg, nil
+		}
+	}
+	return nil, errors.New("message not found")
+}
+
+// 清空已保存的邮件
+func (t *MemoryTransport) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.messages = nil
+}
@@ -0,0 +1,18 @@
+package mailer
+
+import (
+	"net/smtp"
+	"strings"
+)
+
+type SmtpTransport struct {
+	Username string
+	Password string
+	Host     string // host:port
+}
+
+func (t *SmtpTransport) Send(msg *Message) error {
+	hp := strings.Split(t.Host, ":")
+	auth := smtp.PlainAuth("", t.Username, t.Password, hp[0])
+	return smtp.SendMail(t.Host, auth, t.Username, msg.To, msg.Bytes())
+}
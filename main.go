@@ -1,15 +1,25 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"blog/backup"
 	"github.com/cihub/seelog"
 	"github.com/claudiu/gocron"
 	"blog/controllers"
+	"blog/export"
+	"blog/importer"
 	"blog/models"
+	"blog/related"
+	"blog/storage"
 	"blog/system"
 	"blog/routers"
 	"github.com/gin-gonic/gin"
 	"blog/helpers"
+	"blog/mailer"
 )
 
 func main() {
@@ -31,6 +41,16 @@ func main() {
 		return
 	}
 
+	if err := mailer.InitTransport(); err != nil {
+		seelog.Critical("[main]err init mail transport", err)
+		return
+	}
+
+	if err := storage.InitStorage(); err != nil {
+		seelog.Critical("[main]err init storage", err)
+		return
+	}
+
 	db, err := models.InitDB()
 	if err != nil {
 		seelog.Critical("[main]err open databases", err)
@@ -38,14 +58,143 @@ func main() {
 	}
 	defer db.Close()
 
+	// 子命令，如blog -C conf.yaml migrate status、blog export out.zip、blog import -dry-run wordpress.xml
+	switch flag.Arg(0) {
+	case "":
+		if err := models.MigrateOnStartup(); err != nil {
+			seelog.Critical("[main]err migrate database", err)
+			return
+		}
+	case "migrate":
+		if err := migrate(flag.Arg(1), flag.Arg(2)); err != nil {
+			seelog.Critical("[main]err migrate", err)
+		}
+		return
+	case "export":
+		if err := exportContent(flag.Arg(1)); err != nil {
+			seelog.Critical("[main]err export", err)
+		}
+		return
+	case "import":
+		if err := importContent(flag.Args()[1:]); err != nil {
+			seelog.Critical("[main]err import", err)
+		}
+		return
+	default:
+		seelog.Criticalf("[main]unknown command %s", flag.Arg(0))
+		return
+	}
+
 	// todo 生产环境要设置为ReleaseMode
 	gin.SetMode(gin.DebugMode)
 
 	//Periodic tasks
-	gocron.Every(1).Day().Do(controllers.CreateXMLSitemap)
-	gocron.Every(7).Days().Do(controllers.Backup)
+	h := controllers.NewHandler(models.NewGormRepositories())
+	gocron.Every(1).Day().Do(h.CreateXMLSitemap)
+	gocron.Every(1).Day().At("08:00").Do(h.SendDigest)
+	if err := controllers.InitBounceMaildir(); err != nil {
+		seelog.Critical("[main]err init bounce maildir", err)
+		return
+	}
+	gocron.Every(1).Hour().Do(h.ProcessBounces)
+	if err := backup.CheckDestinations(); err != nil {
+		seelog.Critical("[main]err backup destinations", err)
+		return
+	}
+	if err := backup.Schedule(); err != nil {
+		seelog.Critical("[main]err schedule backup", err)
+		return
+	}
 	gocron.Start()
+	related.Start()
 
-	router := routers.InitRouter()
+	router := routers.InitRouter(h)
 	router.Run(system.GetConfiguration().Addr)
 }
+
+// 执行数据库迁移：up [n]执行未执行的迁移，down [n]回滚最近的迁移(默认1个)，status查看状态
+func migrate(command, n string) error {
+	steps := 0
+	if n != "" {
+		var err error
+		if steps, err = strconv.Atoi(n); err != nil || steps <= 0 {
+			return fmt.Errorf("invalid steps %s", n)
+		}
+	}
+	switch command {
+	case "up":
+		count, err := models.MigrateUp(steps)
+		fmt.Printf("applied %d migrations\n", count)
+		return err
+	case "down":
+		if steps == 0 {
+			steps = 1
+		}
+		count, err := models.MigrateDown(steps)
+		fmt.Printf("reverted %d migrations\n", count)
+		return err
+	case "status", "":
+		statuses, err := models.ListMigrationStatus()
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%-6d %-32s %s\n", status.Version, status.Name, applied)
+		}
+		return nil
+	}
+	return errors.New("usage: migrate up|down|status [n]")
+}
+
+func exportContent(fileName string) error {
+	if fileName == "" {
+		fileName = export.FileName(helpers.GetCurrentTime())
+	}
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	if err = export.Write(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	seelog.Infof("[main]exported to %s", fileName)
+	return nil
+}
+
+// 从其他平台导入内容，格式默认根据路径推断
+func importContent(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := flags.String("format", "", "markdown, wordpress or ghost")
+	dryRun := flags.Bool("dry-run", false, "report what would be created without writing")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	path := flags.Arg(0)
+	if path == "" {
+		return errors.New("usage: import [-format markdown|wordpress|ghost] [-dry-run] path")
+	}
+	var err error
+	if *format == "" {
+		if *format, err = importer.DetectFormat(path); err != nil {
+			return err
+		}
+	}
+	docs, err := importer.Load(*format, path)
+	if err != nil {
+		return err
+	}
+	report, err := importer.Import(docs, *dryRun)
+	if err != nil {
+		return err
+	}
+	fmt.Print(report)
+	return nil
+}
@@ -0,0 +1,45 @@
+package models
+
+// 备份状态
+const (
+	BackupStatusSuccess = "success"
+	BackupStatusFailed  = "failed"
+)
+
+// table backups, 每个备份文件在每个目的地的保存记录
+type Backup struct {
+	BaseModel
+	FileName    string // 备份文件名
+	Destination string // 保存的目的地
+	Size        int64  // 文件大小
+	Status      string // 备份状态
+	Message     string `gorm:"type:text"` // 失败原因
+}
+
+// Backup
+func (backup *Backup) Insert() error {
+	return DB.Create(backup).Error
+}
+
+func (backup *Backup) Delete() error {
+	return DB.Delete(backup).Error
+}
+
+func ListBackup() ([]*Backup, error) {
+	var backups []*Backup
+	err := DB.Order("id desc").Find(&backups).Error
+	return backups, err
+}
+
+// 目的地中指定状态的备份，按时间倒序
+func ListBackupByDestination(destination, status string) ([]*Backup, error) {
+	var backups []*Backup
+	err := DB.Where("destination = ? and status = ?", destination, status).Order("created_at desc").Find(&backups).Error
+	return backups, err
+}
+
+func GetBackupById(id uint) (*Backup, error) {
+	var backup Backup
+	err := DB.First(&backup, id).Error
+	return &backup, err
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"regexp"
 	"time"
 
 	"github.com/jinzhu/gorm"
@@ -16,6 +17,13 @@ type BaseModel struct {
 	UpdatedAt time.Time
 }
 
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// 分类、系列等地址中的别名只能包含小写字母、数字和连字符
+func ValidSlug(slug string) bool {
+	return slugPattern.MatchString(slug)
+}
+
 type SmmsFile struct {
 	BaseModel
 	FileName  string `json:"filename"`
@@ -34,18 +42,50 @@ func (sf SmmsFile) Insert() (err error) {
 	return
 }
 
+func (sf *SmmsFile) Remove() error {
+	return DB.Delete(sf).Error
+}
+
+func GetSmmsFileByPath(path string) (*SmmsFile, error) {
+	var smmsFile SmmsFile
+	err := DB.First(&smmsFile, "path = ?", path).Error
+	return &smmsFile, err
+}
+
 var DB *gorm.DB
 
 func InitDB() (*gorm.DB, error) {
 
-	db, err := gorm.Open("sqlite3", system.GetConfiguration().DSN)
-	//db, err := gorm.Open("mysql", "root:mysql@/wblog?charset=utf8&parseTime=True&loc=Asia/Shanghai")
+	driver := Driver()
+	if err := checkDriver(driver); err != nil {
+		return nil, err
+	}
+	db, err := gorm.Open(driver, system.GetConfiguration().DSN)
 	if err == nil {
 		DB = db
 		//db.LogMode(true)
-		db.AutoMigrate(&Page{}, &Post{}, &Tag{}, &PostTag{}, &User{}, &Comment{}, &Subscriber{}, &Link{}, &SmmsFile{})
-		db.Model(&PostTag{}).AddUniqueIndex("uk_post_tag", "post_id", "tag_id")
 		return db, err
 	}
 	return nil, err
-}
\ No newline at end of file
+}
+
+// 在事务中执行fn，fn返回错误或panic时回滚
+func Transaction(fn func(tx *gorm.DB) error) (err error) {
+	tx := DB.Begin()
+	if err = tx.Error; err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	if err = fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit().Error
+}
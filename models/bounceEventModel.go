@@ -0,0 +1,40 @@
+package models
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+)
+
+// table bounce_events 已记录的退信，同一封退信重复收到或处理失败重试时不再重复计数
+type BounceEvent struct {
+	BaseModel
+	EventId      string `gorm:"size:64"` // 退信的标识，见controllers中的bounceEventId
+	SubscriberId uint   // subscriber id
+}
+
+// 该订阅者的这次退信已经记录过
+var ErrBounceRecorded = errors.New("bounce already recorded")
+
+// 记录退信并保存退信次数和订阅状态，eventId已记录过时返回ErrBounceRecorded，不修改订阅者
+func (s *Subscriber) UpdateBounce(eventId string) error {
+	return Transaction(func(tx *gorm.DB) error {
+		var count int
+		err := tx.Model(&BounceEvent{}).Where("event_id = ? and subscriber_id = ?", eventId, s.ID).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrBounceRecorded
+		}
+		// 唯一索引保证并发处理同一封退信时只有一个事务能提交
+		if err = tx.Create(&BounceEvent{EventId: eventId, SubscriberId: s.ID}).Error; err != nil {
+			return err
+		}
+		return tx.Model(s).Update(map[string]interface{}{
+			"soft_bounce_count": s.SoftBounceCount,
+			"hard_bounce_count": s.HardBounceCount,
+			"last_bounce_at":    s.LastBounceAt,
+			"subscribe_state":   s.SubscribeState,
+		}).Error
+	})
+}
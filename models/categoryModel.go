@@ -0,0 +1,247 @@
+package models
+
+import (
+	"sort"
+
+	"github.com/cihub/seelog"
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+)
+
+// table categories, 多级分类，每篇文章最多属于一个主分类
+type Category struct {
+	BaseModel
+	Name        string      // 名称
+	Slug        string      // 地址中使用的别名，全站唯一
+	ParentId    uint        // 上级分类，0为顶级分类
+	Sort        int         `gorm:"default:'0'"` // 同级分类的排序
+	Description string      `gorm:"type:text"`   // 分类介绍，显示在分类页
+	Count       int         `gorm:"-"`           // 直接属于该分类的已发布文章数
+	Total       int         `gorm:"-"`           // 包括子分类的已发布文章数
+	Depth       int         `gorm:"-"`           // 层级，顶级分类为0
+	Path        string      `gorm:"-"`           // 分类页地址，由各级别名组成，如/category/backend/go
+	Children    []*Category `gorm:"-"`           // 子分类
+}
+
+var (
+	// 保存文章或分类时引用了不存在的分类
+	ErrCategoryNotFound = errors.New("category not found")
+	// 上级分类是自身或自身的子分类
+	ErrCategoryCycle = errors.New("category cannot be moved under itself")
+	// 还有子分类时不能删除
+	ErrCategoryHasChildren = errors.New("category has children")
+	// 别名已被其他分类使用
+	ErrCategorySlugExists = errors.New("category slug already exists")
+)
+
+// Category
+func (category *Category) Insert() error {
+	return Transaction(func(tx *gorm.DB) error {
+		if err := checkCategory(tx, category); err != nil {
+			return err
+		}
+		return tx.Create(category).Error
+	})
+}
+
+// 更新名称、别名、排序和上级分类，不能移动到自身或子分类之下
+func (category *Category) Update() error {
+	return Transaction(func(tx *gorm.DB) error {
+		// 先确认分类存在，内容未变时MySQL的RowsAffected为0
+		if err := tx.Select("id").First(&Category{}, category.ID).Error; err != nil {
+			return err
+		}
+		if err := checkCategory(tx, category); err != nil {
+			return err
+		}
+		return tx.Model(category).Updates(map[string]interface{}{
+			"name":        category.Name,
+			"slug":        category.Slug,
+			"parent_id":   category.ParentId,
+			"sort":        category.Sort,
+			"description": category.Description,
+		}).Error
+	})
+}
+
+// 别名不能与其他分类重复；上级分类必须存在，并且不能是分类自身或其子分类
+func checkCategory(tx *gorm.DB, category *Category) error {
+	var count int
+	if err := tx.Model(&Category{}).Where("slug = ? and id <> ?", category.Slug, category.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrCategorySlugExists
+	}
+	if category.ParentId == 0 {
+		return nil
+	}
+	var categories []*Category
+	if err := tx.Select("id, parent_id").Find(&categories).Error; err != nil {
+		return err
+	}
+	parents := make(map[uint]uint, len(categories))
+	for _, c := range categories {
+		parents[c.ID] = c.ParentId
+	}
+	if _, ok := parents[category.ParentId]; !ok {
+		return ErrCategoryNotFound
+	}
+	// 已有数据中的环也会在len(parents)步内结束
+	for id, steps := category.ParentId, 0; id != 0 && steps <= len(parents); id, steps = parents[id], steps+1 {
+		if category.ID != 0 && id == category.ID {
+			return ErrCategoryCycle
+		}
+	}
+	return nil
+}
+
+// 删除没有子分类的分类，其文章改为属于上级分类
+func DeleteCategory(id uint) error {
+	return Transaction(func(tx *gorm.DB) error {
+		var category Category
+		if err := tx.First(&category, id).Error; err != nil {
+			return err
+		}
+		var count int
+		if err := tx.Model(&Category{}).Where("parent_id = ?", id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrCategoryHasChildren
+		}
+		if err := tx.Model(&Post{}).Where("category_id = ?", id).UpdateColumn("category_id", category.ParentId).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Category{}, "id = ?", id).Error
+	})
+}
+
+func GetCategoryById(id uint) (*Category, error) {
+	var category Category
+	err := DB.First(&category, id).Error
+	return &category, err
+}
+
+// 全部分类及直接属于各分类的已发布文章数，按树的先序排列，Path、Depth和Total已计算
+func ListAllCategory() ([]*Category, error) {
+	var categories []*Category
+	if err := DB.Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	rows, err := DB.Raw("select category_id, count(*) from posts where is_published = ? and category_id > 0 group by category_id", true).Rows()
+	if err != nil {
+		seelog.Error("[ListAllCategory]db raw err", err)
+		return nil, err
+	}
+	defer rows.Close()
+	counts := make(map[uint]int)
+	for rows.Next() {
+		var categoryId uint
+		var count int
+		rows.Scan(&categoryId, &count)
+		counts[categoryId] = count
+	}
+	for _, category := range categories {
+		category.Count = counts[category.ID]
+	}
+	return FlattenCategories(CategoryTree(categories)), nil
+}
+
+func CountCategory() int {
+	var count int
+	DB.Model(&Category{}).Count(&count)
+	return count
+}
+
+// CategoryTree 由分类列表构建分类树，返回按Sort、ID排序的顶级分类，同时计算Children、Path、Depth和Total。
+// 上级分类不存在的分类作为顶级分类；可以对同一列表重复调用
+func CategoryTree(categories []*Category) []*Category {
+	sorted := make([]*Category, len(categories))
+	copy(sorted, categories)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Sort != sorted[j].Sort {
+			return sorted[i].Sort < sorted[j].Sort
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+	byId := make(map[uint]*Category, len(sorted))
+	for _, category := range sorted {
+		category.Children = nil
+		byId[category.ID] = category
+	}
+	var roots []*Category
+	for _, category := range sorted {
+		if parent, ok := byId[category.ParentId]; ok && parent != category {
+			parent.Children = append(parent.Children, category)
+		} else {
+			roots = append(roots, category)
+		}
+	}
+	var walk func(categories []*Category, depth int, path string) int
+	walk = func(categories []*Category, depth int, path string) int {
+		sum := 0
+		for _, category := range categories {
+			category.Depth = depth
+			category.Path = path + "/" + category.Slug
+			category.Total = category.Count + walk(category.Children, depth+1, category.Path)
+			sum += category.Total
+		}
+		return sum
+	}
+	walk(roots, 0, "/category")
+	return roots
+}
+
+// FlattenCategories 按先序展开分类树，用于缩进显示
+func FlattenCategories(roots []*Category) []*Category {
+	var categories []*Category
+	for _, category := range roots {
+		categories = append(categories, category)
+		categories = append(categories, FlattenCategories(category.Children)...)
+	}
+	return categories
+}
+
+// CategoryPath 从顶级分类到id的各级分类，用于面包屑导航；找不到时返回nil
+func CategoryPath(categories []*Category, id uint) []*Category {
+	byId := make(map[uint]*Category, len(categories))
+	for _, category := range categories {
+		byId[category.ID] = category
+	}
+	var path []*Category
+	for category, ok := byId[id]; ok && len(path) <= len(categories); category, ok = byId[category.ParentId] {
+		path = append([]*Category{category}, path...)
+	}
+	return path
+}
+
+// CategoryDescendantIds 分类id及其全部子分类的id
+func CategoryDescendantIds(categories []*Category, id uint) []uint {
+	children := make(map[uint][]uint)
+	for _, category := range categories {
+		if category.ID != category.ParentId {
+			children[category.ParentId] = append(children[category.ParentId], category.ID)
+		}
+	}
+	ids := []uint{id}
+	seen := map[uint]bool{id: true}
+	for i := 0; i < len(ids); i++ {
+		for _, childId := range children[ids[i]] {
+			if !seen[childId] {
+				seen[childId] = true
+				ids = append(ids, childId)
+			}
+		}
+	}
+	return ids
+}
+
+// 已发布的属于categoryIds中任一分类的文章，pagination为nil时返回全部
+func ListPostByCategory(categoryIds []uint, pagination *Pagination) ([]*Post, error) {
+	if len(categoryIds) == 0 {
+		return []*Post{}, nil
+	}
+	db := DB.Model(&Post{}).Where("posts.category_id in (?) and posts.is_published = ?", categoryIds, true)
+	return findPosts(db, pagination)
+}
@@ -9,7 +9,7 @@ import (
 type Comment struct {
 	BaseModel
 	UserID    uint                      // 用户id
-	Content   string                    // 内容
+	Content   string `gorm:"type:text"`   // 内容
 	PostID    uint                      // 文章id
 	ReadState bool `gorm:"default:'0'"` // 阅读状态
 	//Replies []*Comment // 评论
@@ -53,7 +53,7 @@ func ListCommentByPostID(postId string) ([]*Comment, error) {
 		return nil, err
 	}
 	var comments []*Comment
-	rows, err := DB.Raw("select c.*, u.github_login_id, u.nick_name, u.avatar_url, u.github_url from comments c inner join users u on c.user_id = u.id where c.post_id = ? order by created_at desc", uint(pid)).Rows()
+	rows, err := DB.Raw("select c.*, u.github_login_id, u.nick_name, u.avatar_url, u.github_url from comments c inner join users u on c.user_id = u.id where c.post_id = ? order by c.created_at desc", uint(pid)).Rows()
 	if err != nil {
 		seelog.Error("[ListCommentByPostID]get data err", err)
 		return nil, err
@@ -68,8 +68,39 @@ func ListCommentByPostID(postId string) ([]*Comment, error) {
 	return comments, err
 }
 
+// 一次查询一页文章的评论数，没有评论的文章不在结果中
+func CountCommentByPostIds(postIds []uint) (map[uint]int, error) {
+	totals := make(map[uint]int)
+	if len(postIds) == 0 {
+		return totals, nil
+	}
+	rows, err := DB.Raw("select post_id, count(*) as total from comments where post_id in (?) group by post_id", postIds).Rows()
+	if err != nil {
+		seelog.Error("[CountCommentByPostIds]db raw err", err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			postId uint
+			total  int
+		)
+		if err = rows.Scan(&postId, &total); err != nil {
+			return nil, err
+		}
+		totals[postId] = total
+	}
+	return totals, rows.Err()
+}
+
 func CountComment() int {
 	var count int
 	DB.Model(&Comment{}).Count(&count)
 	return count
 }
+
+func ListAllComment() ([]*Comment, error) {
+	var comments []*Comment
+	err := DB.Order("id").Find(&comments).Error
+	return comments, err
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"blog/system"
+)
+
+// 支持的数据库，mysql和postgres的驱动需要分别使用-tags mysql、-tags postgres编译
+const (
+	DriverSqlite   = "sqlite3"
+	DriverMysql    = "mysql"
+	DriverPostgres = "postgres"
+)
+
+// 配置的数据库驱动，默认为sqlite3
+func Driver() string {
+	if driver := system.GetConfiguration().DbDriver; driver != "" {
+		return driver
+	}
+	return DriverSqlite
+}
+
+// 检查驱动是否已编译进来，避免只得到sql: unknown driver
+func checkDriver(driver string) error {
+	switch driver {
+	case DriverSqlite, DriverMysql, DriverPostgres:
+	default:
+		return errors.Errorf("unsupported db_driver %s", driver)
+	}
+	for _, name := range sql.Drivers() {
+		if name == driver {
+			return nil
+		}
+	}
+	return errors.Errorf("db_driver %s is not compiled in, build with -tags %s", driver, driver)
+}
+
+// 将时间列格式化为yyyy-mm的SQL表达式，用于按月归档
+func monthExpr(column string) string {
+	switch Driver() {
+	case DriverMysql:
+		return fmt.Sprintf("date_format(%s, '%%Y-%%m')", column)
+	case DriverPostgres:
+		return fmt.Sprintf("to_char(%s, 'YYYY-MM')", column)
+	}
+	return fmt.Sprintf("strftime('%%Y-%%m', %s)", column)
+}
@@ -0,0 +1,8 @@
+//go:build mysql
+// +build mysql
+
+package models
+
+import (
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+)
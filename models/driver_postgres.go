@@ -0,0 +1,8 @@
+//go:build postgres
+// +build postgres
+
+package models
+
+import (
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+)
@@ -20,6 +20,10 @@ func (link *Link) Update() error {
 	return DB.Save(link).Error
 }
 
+func (link *Link) UpdateView() error {
+	return DB.Model(link).UpdateColumn("view", link.View).Error
+}
+
 func (link *Link) Delete() error {
 	return DB.Delete(link).Error
 }
@@ -37,6 +41,6 @@ func MustListLinks() []*Link {
 
 func GetLinkById(id uint) (*Link, error) {
 	var link Link
-	err := DB.FirstOrCreate(&link, "id = ?", id).Error
+	err := DB.First(&link, id).Error
 	return &link, err
 }
@@ -0,0 +1,204 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// table media, 上传到各个存储中的文件
+type Media struct {
+	BaseModel
+	Driver      string          // 存储驱动
+	StorageKey  string          // 文件在存储中的标识
+	Url         string          // 访问地址
+	FileName    string          // 原始文件名
+	ContentType string          // 文件类型
+	Size        int64           // 文件大小
+	Width       int             // 图片宽度
+	Height      int             // 图片高度
+	Hash        string          // 原始文件内容的sha256，用于去重
+	UserId      uint            // 上传者
+	Posts       []*Post         `gorm:"-"` // 引用了该文件的文章
+	Variants    []*MediaVariant `gorm:"-"` // 缩略图、WebP等衍生文件
+}
+
+// table media_variants, 上传图片时生成的缩略图和WebP版本
+type MediaVariant struct {
+	BaseModel
+	MediaId     uint
+	Name        string // 缩略图为thumb，原尺寸为空
+	StorageKey  string
+	Url         string
+	ContentType string
+	Size        int64
+	Width       int
+	Height      int
+}
+
+// Media
+func (media *Media) Insert() error {
+	return DB.FirstOrCreate(media, "driver = ? and storage_key = ?", media.Driver, media.StorageKey).Error
+}
+
+func (media *Media) Delete() error {
+	return DB.Delete(media).Error
+}
+
+func (media *Media) IsImage() bool {
+	return strings.HasPrefix(media.ContentType, "image/")
+}
+
+// 生成img/source标签的srcset，包含原图和指定类型的衍生文件
+func (media *Media) Srcset(contentType string) string {
+	var candidates []string
+	if media.ContentType == contentType && media.Width > 0 {
+		candidates = append(candidates, fmt.Sprintf("%s %dw", media.Url, media.Width))
+	}
+	for _, variant := range media.Variants {
+		if variant.ContentType == contentType && variant.Width > 0 {
+			candidates = append(candidates, fmt.Sprintf("%s %dw", variant.Url, variant.Width))
+		}
+	}
+	return strings.Join(candidates, ", ")
+}
+
+// 缩略图地址，没有缩略图时返回原图地址
+func (media *Media) ThumbnailUrl() string {
+	for _, variant := range media.Variants {
+		if variant.Name == "thumb" && variant.ContentType == media.ContentType {
+			return variant.Url
+		}
+	}
+	return media.Url
+}
+
+func (variant *MediaVariant) Insert() error {
+	return DB.Create(variant).Error
+}
+
+func ListMediaVariantByMediaId(mediaId uint) ([]*MediaVariant, error) {
+	var variants []*MediaVariant
+	err := DB.Where("media_id = ?", mediaId).Order("width desc").Find(&variants).Error
+	return variants, err
+}
+
+// 一次查询多个文件的衍生文件，按文件id分组，各组按宽度倒序
+func ListMediaVariantByMediaIds(mediaIds []uint) (map[uint][]*MediaVariant, error) {
+	grouped := make(map[uint][]*MediaVariant)
+	if len(mediaIds) == 0 {
+		return grouped, nil
+	}
+	var variants []*MediaVariant
+	err := DB.Where("media_id in (?)", mediaIds).Order("width desc, id").Find(&variants).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, variant := range variants {
+		grouped[variant.MediaId] = append(grouped[variant.MediaId], variant)
+	}
+	return grouped, nil
+}
+
+func DeleteMediaVariantByMediaId(mediaId uint) error {
+	return DB.Where("media_id = ?", mediaId).Delete(&MediaVariant{}).Error
+}
+
+// 按地址查询，同时加载衍生文件
+func ListMediaByUrls(urls []string) ([]*Media, error) {
+	var medias []*Media
+	if len(urls) == 0 {
+		return medias, nil
+	}
+	err := DB.Where("url in (?)", urls).Find(&medias).Error
+	if err != nil {
+		return nil, err
+	}
+	mediaIds := make([]uint, len(medias))
+	for i, media := range medias {
+		mediaIds[i] = media.ID
+	}
+	variants, err := ListMediaVariantByMediaIds(mediaIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, media := range medias {
+		media.Variants = variants[media.ID]
+	}
+	return medias, nil
+}
+
+// 相同内容已上传到同一存储时返回该文件
+func GetMediaByHash(driver, hash string) (*Media, error) {
+	var media Media
+	err := DB.First(&media, "driver = ? and hash = ?", driver, hash).Error
+	return &media, err
+}
+
+// 用户已上传文件的总大小，包括衍生文件
+func SumMediaSizeByUserId(userId uint) (int64, error) {
+	var total struct {
+		Size int64
+	}
+	err := DB.Raw("select (select coalesce(sum(size), 0) from media where user_id = ?) + (select coalesce(sum(mv.size), 0) from media_variants mv inner join media m on mv.media_id = m.id where m.user_id = ?) as size", userId, userId).Scan(&total).Error
+	return total.Size, err
+}
+
+func GetMediaById(id uint) (*Media, error) {
+	var media Media
+	err := DB.First(&media, id).Error
+	return &media, err
+}
+
+// 按文件名或地址搜索，keyword为空时返回全部，pagination为nil时不分页
+func ListMedia(keyword string, pagination *Pagination) ([]*Media, error) {
+	var medias []*Media
+	db := DB.Model(&Media{})
+	if keyword != "" {
+		like := "%" + keyword + "%"
+		db = db.Where("file_name like ? or url like ?", like, like)
+	}
+	if pagination == nil {
+		err := db.Order("id desc").Find(&medias).Error
+		return medias, err
+	}
+	db, err := pagination.paginate(db, "media")
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Find(&medias).Error; err != nil {
+		return nil, err
+	}
+	medias = medias[:pagination.Fill(len(medias), func(i int) (time.Time, uint) {
+		return medias[i].CreatedAt, medias[i].ID
+	})]
+	return medias, nil
+}
+
+// 正文中包含各地址的文章，按地址分组，只包含id、标题和发布状态；所有地址在一次查询中完成
+func ListPostByMediaUrls(urls []string) (map[string][]*Post, error) {
+	usage := make(map[string][]*Post)
+	if len(urls) == 0 {
+		return usage, nil
+	}
+	conditions := make([]string, len(urls))
+	values := make([]interface{}, len(urls))
+	for i, url := range urls {
+		conditions[i] = "body like ?"
+		values[i] = "%" + url + "%"
+	}
+	var posts []*Post
+	err := DB.Select("id, title, is_published, body").Where(strings.Join(conditions, " or "), values...).Order("id").Find(&posts).Error
+	if err != nil {
+		return nil, err
+	}
+	// like中的%和_是通配符，按正文再次确认
+	for _, post := range posts {
+		for _, url := range urls {
+			if strings.Contains(post.Body, url) {
+				usage[url] = append(usage[url], &Post{BaseModel: post.BaseModel, Title: post.Title, IsPublished: post.IsPublished})
+			}
+		}
+	}
+	return usage, nil
+}
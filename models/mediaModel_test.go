@@ -0,0 +1,45 @@
+package models_test
+
+import (
+	"fmt"
+	"testing"
+
+	"blog/models"
+	"blog/models/testdb"
+)
+
+// 已上传文件的总大小包括衍生文件，没有上传时为0
+func TestSumMediaSizeByUserId(t *testing.T) {
+	testdb.Open(t)
+	files := []struct {
+		userId   uint
+		size     int64
+		variants []int64
+	}{
+		{1, 100, []int64{10, 20}},
+		{1, 50, nil},
+		{2, 1000, []int64{300}},
+	}
+	for i, file := range files {
+		media := &models.Media{Driver: "local", StorageKey: fmt.Sprintf("file-%d", i), UserId: file.userId, Size: file.size}
+		if err := media.Insert(); err != nil {
+			t.Fatal(err)
+		}
+		for _, size := range file.variants {
+			variant := &models.MediaVariant{MediaId: media.ID, Size: size}
+			if err := variant.Insert(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for userId, want := range map[uint]int64{1: 180, 2: 1300, 3: 0} {
+		size, err := models.SumMediaSizeByUserId(userId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != want {
+			t.Errorf("size of user %d = %d, want %d", userId, size, want)
+		}
+	}
+}
@@ -0,0 +1,1802 @@
+// Package memory 提供models中数据访问接口的内存实现，用于不依赖数据库的测试
+package memory
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"blog/models"
+)
+
+// 与gorm保持一致，查询不到时返回gorm.ErrRecordNotFound
+var ErrRecordNotFound = gorm.ErrRecordNotFound
+
+// 各接口共享的数据，文章、标签和评论之间的关联与数据库中一致
+type Store struct {
+	mu         sync.Mutex
+	nextId     uint
+	posts      map[uint]*models.Post
+	pages      map[uint]*models.Page
+	tags       map[uint]*models.Tag
+	postTags   map[uint]map[uint]bool // post id -> tag ids
+	categories map[uint]*models.Category
+	series     map[uint]*models.Series
+	seriesPost map[uint]*models.SeriesPost // post id -> 所在系列及位置
+	related    map[uint][]uint             // post id -> 按相似度排列的相关文章id
+	comments   map[uint]*models.Comment
+	links      map[uint]*models.Link
+	users      map[uint]*models.User
+
+	subscribers    map[uint]*models.Subscriber
+	subscriberTags map[uint]map[uint]bool   // subscriber id -> tag ids
+	bounceEvents   map[uint]map[string]bool // subscriber id -> 已记录的退信
+	media          map[uint]*models.Media
+	variants       map[uint]*models.MediaVariant
+	backups        map[uint]*models.Backup
+}
+
+func NewStore() *Store {
+	return &Store{
+		posts:      make(map[uint]*models.Post),
+		pages:      make(map[uint]*models.Page),
+		tags:       make(map[uint]*models.Tag),
+		postTags:   make(map[uint]map[uint]bool),
+		categories: make(map[uint]*models.Category),
+		series:     make(map[uint]*models.Series),
+		seriesPost: make(map[uint]*models.SeriesPost),
+		related:    make(map[uint][]uint),
+		comments:   make(map[uint]*models.Comment),
+		links:      make(map[uint]*models.Link),
+		users:      make(map[uint]*models.User),
+
+		subscribers:    make(map[uint]*models.Subscriber),
+		subscriberTags: make(map[uint]map[uint]bool),
+		bounceEvents:   make(map[uint]map[string]bool),
+		media:          make(map[uint]*models.Media),
+		variants:       make(map[uint]*models.MediaVariant),
+		backups:        make(map[uint]*models.Backup),
+	}
+}
+
+// NewRepositories 基于同一个Store的全部接口
+func NewRepositories(store *Store) *models.Repositories {
+	return &models.Repositories{
+		Posts:       postRepository{store},
+		Pages:       pageRepository{store},
+		Tags:        tagRepository{store},
+		Categories:  categoryRepository{store},
+		Series:      seriesRepository{store},
+		Comments:    commentRepository{store},
+		Links:       linkRepository{store},
+		Users:       userRepository{store},
+		Subscribers: subscriberRepository{store},
+		Media:       mediaRepository{store},
+		Backups:     backupRepository{store},
+	}
+}
+
+// 分配id并补全时间，调用方需持有锁
+func (s *Store) stamp(model *models.BaseModel) {
+	if model.ID == 0 {
+		s.nextId++
+		model.ID = s.nextId
+	} else if model.ID > s.nextId {
+		s.nextId = model.ID
+	}
+	now := time.Now()
+	if model.CreatedAt.IsZero() {
+		model.CreatedAt = now
+	}
+	model.UpdatedAt = now
+}
+
+// 与stamp相同，用于用户、链接和订阅者等使用gorm.Model的记录
+func (s *Store) stampModel(model *gorm.Model) {
+	if model.ID == 0 {
+		s.nextId++
+		model.ID = s.nextId
+	} else if model.ID > s.nextId {
+		s.nextId = model.ID
+	}
+	now := time.Now()
+	if model.CreatedAt.IsZero() {
+		model.CreatedAt = now
+	}
+	model.UpdatedAt = now
+}
+
+// AddLink 添加友情链接
+func (s *Store) AddLink(link *models.Link) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stampModel(&link.Model)
+	copied := *link
+	s.links[link.ID] = &copied
+}
+
+// AddUser 添加用户
+func (s *Store) AddUser(user *models.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stampModel(&user.Model)
+	copied := *user
+	s.users[user.ID] = &copied
+}
+
+// AddBackup 添加备份记录，备份记录由backup包写入，接口中只有查询
+func (s *Store) AddBackup(backup *models.Backup) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stamp(&backup.BaseModel)
+	copied := *backup
+	s.backups[backup.ID] = &copied
+}
+
+// SetRelated 设置文章的相关文章，对应related包预先计算的结果
+func (s *Store) SetRelated(postId uint, relatedIds []uint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.related[postId] = append([]uint(nil), relatedIds...)
+}
+
+func parseId(id string) (uint, error) {
+	n, err := strconv.ParseUint(id, 10, 64)
+	return uint(n), err
+}
+
+// 与数据库实现一致，按创建时间和id倒序分页，pagination为nil时不分页
+func pagePosts(posts []*models.Post, pagination *models.Pagination) ([]*models.Post, error) {
+	key := func(i int) (time.Time, uint) {
+		return posts[i].CreatedAt, posts[i].ID
+	}
+	sortByCreated(len(posts), key, func(i, j int) {
+		posts[i], posts[j] = posts[j], posts[i]
+	})
+	start, end, err := pageRange(len(posts), key, pagination)
+	if err != nil {
+		return nil, err
+	}
+	posts = posts[start:end]
+	if pagination != nil {
+		posts = posts[:pagination.Fill(len(posts), key)]
+	}
+	return posts, nil
+}
+
+// 按创建时间和id倒序排序
+func sortByCreated(n int, key func(i int) (time.Time, uint), swap func(i, j int)) {
+	sort.Sort(byCreated{n, key, swap})
+}
+
+type byCreated struct {
+	n    int
+	key  func(i int) (time.Time, uint)
+	swap func(i, j int)
+}
+
+func (b byCreated) Len() int { return b.n }
+
+func (b byCreated) Less(i, j int) bool {
+	iCreatedAt, iId := b.key(i)
+	jCreatedAt, jId := b.key(j)
+	return before(jCreatedAt, jId, iCreatedAt, iId)
+}
+
+func (b byCreated) Swap(i, j int) { b.swap(i, j) }
+
+// 已排序的n条记录中当前页的范围，多取一条用于判断是否有下一页；pagination为nil时返回全部
+func pageRange(n int, key func(i int) (time.Time, uint), pagination *models.Pagination) (int, int, error) {
+	if pagination == nil {
+		return 0, n, nil
+	}
+	start := 0
+	if pagination.Cursor == "" {
+		pagination.Total = n
+		start = (pagination.Page - 1) * pagination.PageSize
+	} else {
+		createdAt, id, err := models.DecodeCursor(pagination.Cursor)
+		if err != nil {
+			return 0, 0, err
+		}
+		for start < n {
+			startCreatedAt, startId := key(start)
+			if before(startCreatedAt, startId, createdAt, id) {
+				break
+			}
+			start++
+		}
+	}
+	if start > n {
+		start = n
+	}
+	end := start + pagination.PageSize + 1
+	if end > n {
+		end = n
+	}
+	return start, end, nil
+}
+
+// 记录a是否排在游标b之后，即(createdAt, id)更小
+func before(aCreatedAt time.Time, aId uint, bCreatedAt time.Time, bId uint) bool {
+	if aCreatedAt.Equal(bCreatedAt) {
+		return aId < bId
+	}
+	return aCreatedAt.Before(bCreatedAt)
+}
+
+type postRepository struct {
+	*Store
+}
+
+func (r postRepository) Insert(post *models.Post) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stamp(&post.BaseModel)
+	post.SyncPublishedAt()
+	copied := *post
+	r.posts[post.ID] = &copied
+	return nil
+}
+
+func (r postRepository) Update(post *models.Post) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.posts[post.ID]
+	if !ok {
+		return ErrRecordNotFound
+	}
+	post.SyncPublishedAt()
+	stored.Title = post.Title
+	stored.Body = post.Body
+	stored.IsPublished = post.IsPublished
+	stored.PublishedAt = post.PublishedAt
+	stored.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r postRepository) UpdateView(post *models.Post) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.posts[post.ID]
+	if !ok {
+		return ErrRecordNotFound
+	}
+	stored.View = post.View
+	return nil
+}
+
+func (r postRepository) Delete(id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.posts, id)
+	delete(r.postTags, id)
+	delete(r.seriesPost, id)
+	delete(r.related, id)
+	return nil
+}
+
+func (r postRepository) GetById(id string) (*models.Post, error) {
+	pid, err := parseId(id)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	post, ok := r.posts[pid]
+	if !ok {
+		return &models.Post{}, ErrRecordNotFound
+	}
+	copied := *post
+	return &copied, nil
+}
+
+// 符合条件的文章副本，调用方需持有锁
+func (r postRepository) filter(tag string, published bool, match func(*models.Post) bool) ([]*models.Post, error) {
+	var tagId uint
+	if tag != "" {
+		var err error
+		if tagId, err = parseId(tag); err != nil {
+			return nil, err
+		}
+	}
+	posts := make([]*models.Post, 0)
+	for _, post := range r.posts {
+		if published && !post.IsPublished {
+			continue
+		}
+		if tagId > 0 && !r.postTags[post.ID][tagId] {
+			continue
+		}
+		if match != nil && !match(post) {
+			continue
+		}
+		copied := *post
+		posts = append(posts, &copied)
+	}
+	return posts, nil
+}
+
+func (r postRepository) ListPublished(tag string, pagination *models.Pagination) ([]*models.Post, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	posts, err := r.filter(tag, true, nil)
+	if err != nil {
+		return nil, err
+	}
+	return pagePosts(posts, pagination)
+}
+
+func (r postRepository) ListAll(tag string, pagination *models.Pagination) ([]*models.Post, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	posts, err := r.filter(tag, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	return pagePosts(posts, pagination)
+}
+
+func (r postRepository) Count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.posts)
+}
+
+func (r postRepository) ListMaxRead() ([]*models.Post, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	posts, _ := r.filter("", true, nil)
+	sort.SliceStable(posts, func(i, j int) bool {
+		return posts[i].View > posts[j].View
+	})
+	if len(posts) > 5 {
+		posts = posts[:5]
+	}
+	return posts, nil
+}
+
+func (r postRepository) ListMaxComment() ([]*models.Post, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	totals := make(map[uint]int)
+	for _, comment := range r.comments {
+		totals[comment.PostID]++
+	}
+	posts, _ := r.filter("", false, func(post *models.Post) bool {
+		return totals[post.ID] > 0
+	})
+	for _, post := range posts {
+		post.CommentTotal = totals[post.ID]
+	}
+	sort.SliceStable(posts, func(i, j int) bool {
+		return posts[i].CommentTotal > posts[j].CommentTotal
+	})
+	if len(posts) > 5 {
+		posts = posts[:5]
+	}
+	return posts, nil
+}
+
+func (r postRepository) ListArchives() ([]*models.QrArchive, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	totals := make(map[string]int)
+	for _, post := range r.posts {
+		if post.IsPublished {
+			totals[post.CreatedAt.Format("2006-01")]++
+		}
+	}
+	months := make([]string, 0, len(totals))
+	for month := range totals {
+		months = append(months, month)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(months)))
+	archives := make([]*models.QrArchive, 0, len(months))
+	for _, month := range months {
+		date, _ := time.Parse("2006-01", month)
+		archives = append(archives, &models.QrArchive{
+			ArchiveDate: date,
+			Total:       totals[month],
+			Year:        date.Year(),
+			Month:       int(date.Month()),
+		})
+	}
+	return archives, nil
+}
+
+func archiveMonth(year, month string) string {
+	if len(month) == 1 {
+		month = "0" + month
+	}
+	return fmt.Sprintf("%s-%s", year, month)
+}
+
+func (r postRepository) ListByArchive(year, month string, pagination *models.Pagination) ([]*models.Post, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	condition := archiveMonth(year, month)
+	posts, _ := r.filter("", true, func(post *models.Post) bool {
+		return post.CreatedAt.Format("2006-01") == condition
+	})
+	return pagePosts(posts, pagination)
+}
+
+func (r postRepository) ListByCategory(categoryIds []uint, pagination *models.Pagination) ([]*models.Post, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	wanted := make(map[uint]bool, len(categoryIds))
+	for _, categoryId := range categoryIds {
+		wanted[categoryId] = true
+	}
+	posts, _ := r.filter("", true, func(post *models.Post) bool {
+		return wanted[post.CategoryId]
+	})
+	return pagePosts(posts, pagination)
+}
+
+func (r postRepository) ListRelated(postId uint) ([]*models.Post, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	posts := make([]*models.Post, 0)
+	for _, relatedId := range r.related[postId] {
+		if post, ok := r.posts[relatedId]; ok && post.IsPublished {
+			copied := *post
+			posts = append(posts, &copied)
+		}
+	}
+	return posts, nil
+}
+
+func (r postRepository) Save(post *models.Post, tagIds []uint, tagNames []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.categories[post.CategoryId]; post.CategoryId > 0 && !ok {
+		return models.ErrCategoryNotFound
+	}
+	tags := make(map[uint]bool, len(tagIds))
+	for _, tagId := range tagIds {
+		if _, ok := r.tags[tagId]; !ok {
+			return models.ErrTagNotFound
+		}
+		tags[tagId] = true
+	}
+	if post.ID != 0 {
+		if _, ok := r.posts[post.ID]; !ok {
+			return ErrRecordNotFound
+		}
+	}
+	for _, name := range tagNames {
+		tags[r.findOrCreateTag(name).ID] = true
+	}
+	if post.ID == 0 {
+		r.stamp(&post.BaseModel)
+		post.SyncPublishedAt()
+		copied := *post
+		r.posts[post.ID] = &copied
+	} else {
+		stored, ok := r.posts[post.ID]
+		if !ok {
+			return ErrRecordNotFound
+		}
+		post.PublishedAt = stored.PublishedAt
+		post.SyncPublishedAt()
+		stored.Title = post.Title
+		stored.Body = post.Body
+		stored.IsPublished = post.IsPublished
+		stored.PublishedAt = post.PublishedAt
+		stored.CategoryId = post.CategoryId
+		stored.UpdatedAt = time.Now()
+	}
+	r.postTags[post.ID] = tags
+	return nil
+}
+
+func (r postRepository) ListPublishedSinceBySubscriber(since time.Time, subscriberId uint) ([]*models.Post, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	posts := make([]*models.Post, 0)
+	for _, post := range r.posts {
+		if post.IsPublished && post.PublishedAt != nil && post.PublishedAt.After(since) && r.follows(subscriberId, post.ID) {
+			copied := *post
+			posts = append(posts, &copied)
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].PublishedAt.After(*posts[j].PublishedAt)
+	})
+	return posts, nil
+}
+
+func (r postRepository) ListByMediaUrls(urls []string) (map[string][]*models.Post, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	usage := make(map[string][]*models.Post)
+	for _, url := range urls {
+		for _, post := range r.posts {
+			if strings.Contains(post.Body, url) {
+				usage[url] = append(usage[url], &models.Post{BaseModel: post.BaseModel, Title: post.Title, IsPublished: post.IsPublished})
+			}
+		}
+		posts := usage[url]
+		sort.Slice(posts, func(i, j int) bool {
+			return posts[i].ID < posts[j].ID
+		})
+	}
+	return usage, nil
+}
+
+type pageRepository struct {
+	*Store
+}
+
+func (r pageRepository) Insert(page *models.Page) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stamp(&page.BaseModel)
+	copied := *page
+	r.pages[page.ID] = &copied
+	return nil
+}
+
+func (r pageRepository) Update(page *models.Page) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.pages[page.ID]
+	if !ok {
+		return ErrRecordNotFound
+	}
+	stored.Title = page.Title
+	stored.Body = page.Body
+	stored.IsPublished = page.IsPublished
+	stored.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r pageRepository) UpdateView(page *models.Page) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.pages[page.ID]
+	if !ok {
+		return ErrRecordNotFound
+	}
+	stored.View = page.View
+	return nil
+}
+
+func (r pageRepository) Delete(id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.pages, id)
+	return nil
+}
+
+func (r pageRepository) GetById(id string) (*models.Page, error) {
+	pid, err := parseId(id)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	page, ok := r.pages[pid]
+	if !ok {
+		return &models.Page{}, ErrRecordNotFound
+	}
+	copied := *page
+	return &copied, nil
+}
+
+func (r pageRepository) ListAll() ([]*models.Page, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pages := make([]*models.Page, 0, len(r.pages))
+	for _, page := range r.pages {
+		copied := *page
+		pages = append(pages, &copied)
+	}
+	sort.Slice(pages, func(i, j int) bool {
+		return pages[i].ID < pages[j].ID
+	})
+	return pages, nil
+}
+
+func (r pageRepository) ListPublished() ([]*models.Page, error) {
+	pages, _ := r.ListAll()
+	published := make([]*models.Page, 0, len(pages))
+	for _, page := range pages {
+		if page.IsPublished {
+			published = append(published, page)
+		}
+	}
+	return published, nil
+}
+
+func (r pageRepository) Count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.pages)
+}
+
+type tagRepository struct {
+	*Store
+}
+
+// 与数据库实现一致，同名标签已存在时返回已有标签
+// 按名称查找标签，不存在时创建，调用方需持有锁
+func (s *Store) findOrCreateTag(name string) *models.Tag {
+	for _, stored := range s.tags {
+		if stored.Name == name {
+			return stored
+		}
+	}
+	tag := &models.Tag{Name: name}
+	s.stamp(&tag.BaseModel)
+	s.tags[tag.ID] = tag
+	return tag
+}
+
+func (r tagRepository) Insert(tag *models.Tag) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if tag.ID == 0 {
+		for _, stored := range r.tags {
+			if stored.Name == tag.Name {
+				*tag = *stored
+				return nil
+			}
+		}
+	}
+	r.stamp(&tag.BaseModel)
+	copied := *tag
+	r.tags[tag.ID] = &copied
+	return nil
+}
+
+func (r tagRepository) Update(tag *models.Tag) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.tags[tag.ID]
+	if !ok {
+		return ErrRecordNotFound
+	}
+	for _, other := range r.tags {
+		if other.ID != tag.ID && other.Name == tag.Name {
+			return models.ErrTagNameExists
+		}
+	}
+	stored.Name = tag.Name
+	stored.Description = tag.Description
+	stored.Cover = tag.Cover
+	stored.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r tagRepository) Delete(id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tags, id)
+	for _, tagIds := range r.postTags {
+		delete(tagIds, id)
+	}
+	for _, tagIds := range r.subscriberTags {
+		delete(tagIds, id)
+	}
+	return nil
+}
+
+func (r tagRepository) Merge(sourceId, targetId uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, sourceOk := r.tags[sourceId]
+	_, targetOk := r.tags[targetId]
+	if sourceId == targetId || !sourceOk || !targetOk {
+		return models.ErrTagNotFound
+	}
+	for _, tagIds := range r.postTags {
+		if tagIds[sourceId] {
+			delete(tagIds, sourceId)
+			tagIds[targetId] = true
+		}
+	}
+	for _, tagIds := range r.subscriberTags {
+		if tagIds[sourceId] {
+			delete(tagIds, sourceId)
+			tagIds[targetId] = true
+		}
+	}
+	delete(r.tags, sourceId)
+	return nil
+}
+
+func (r tagRepository) GetById(id uint) (*models.Tag, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tag, ok := r.tags[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	copied := *tag
+	return &copied, nil
+}
+
+func (r tagRepository) ListPublished() ([]*models.Tag, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	totals := make(map[uint]int)
+	for postId, tagIds := range r.postTags {
+		if post, ok := r.posts[postId]; !ok || !post.IsPublished {
+			continue
+		}
+		for tagId := range tagIds {
+			totals[tagId]++
+		}
+	}
+	tags := make([]*models.Tag, 0, len(totals))
+	for tagId, total := range totals {
+		if tag, ok := r.tags[tagId]; ok {
+			copied := *tag
+			copied.Total = total
+			tags = append(tags, &copied)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].ID < tags[j].ID
+	})
+	return tags, nil
+}
+
+func (r tagRepository) ListAll() ([]*models.Tag, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	totals := make(map[uint]int)
+	for _, tagIds := range r.postTags {
+		for tagId := range tagIds {
+			totals[tagId]++
+		}
+	}
+	tags := make([]*models.Tag, 0, len(r.tags))
+	for _, tag := range r.tags {
+		copied := *tag
+		copied.Total = totals[tag.ID]
+		tags = append(tags, &copied)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].ID < tags[j].ID
+	})
+	return tags, nil
+}
+
+func (r tagRepository) ListByPostId(postId uint) ([]*models.Tag, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var tags []*models.Tag
+	for tagId := range r.postTags[postId] {
+		if tag, ok := r.tags[tagId]; ok {
+			copied := *tag
+			tags = append(tags, &copied)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].ID < tags[j].ID
+	})
+	return tags, nil
+}
+
+func (r tagRepository) ListByPostIds(postIds []uint) (map[uint][]*models.Tag, error) {
+	postTags := make(map[uint][]*models.Tag)
+	for _, postId := range postIds {
+		tags, _ := r.ListByPostId(postId)
+		if len(tags) > 0 {
+			postTags[postId] = tags
+		}
+	}
+	return postTags, nil
+}
+
+func (r tagRepository) Count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.tags)
+}
+
+type categoryRepository struct {
+	*Store
+}
+
+// 与数据库实现一致的别名和上级分类检查，调用方需持有锁
+func (r categoryRepository) check(category *models.Category) error {
+	for _, stored := range r.categories {
+		if stored.Slug == category.Slug && stored.ID != category.ID {
+			return models.ErrCategorySlugExists
+		}
+	}
+	if category.ParentId == 0 {
+		return nil
+	}
+	if _, ok := r.categories[category.ParentId]; !ok {
+		return models.ErrCategoryNotFound
+	}
+	for id, steps := category.ParentId, 0; id != 0 && steps <= len(r.categories); steps++ {
+		if category.ID != 0 && id == category.ID {
+			return models.ErrCategoryCycle
+		}
+		parent, ok := r.categories[id]
+		if !ok {
+			break
+		}
+		id = parent.ParentId
+	}
+	return nil
+}
+
+func (r categoryRepository) Insert(category *models.Category) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.check(category); err != nil {
+		return err
+	}
+	r.stamp(&category.BaseModel)
+	copied := *category
+	r.categories[category.ID] = &copied
+	return nil
+}
+
+func (r categoryRepository) Update(category *models.Category) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.categories[category.ID]
+	if !ok {
+		return ErrRecordNotFound
+	}
+	if err := r.check(category); err != nil {
+		return err
+	}
+	stored.Name = category.Name
+	stored.Slug = category.Slug
+	stored.ParentId = category.ParentId
+	stored.Sort = category.Sort
+	stored.Description = category.Description
+	stored.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r categoryRepository) Delete(id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	category, ok := r.categories[id]
+	if !ok {
+		return ErrRecordNotFound
+	}
+	for _, stored := range r.categories {
+		if stored.ParentId == id {
+			return models.ErrCategoryHasChildren
+		}
+	}
+	for _, post := range r.posts {
+		if post.CategoryId == id {
+			post.CategoryId = category.ParentId
+		}
+	}
+	delete(r.categories, id)
+	return nil
+}
+
+func (r categoryRepository) GetById(id uint) (*models.Category, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	category, ok := r.categories[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	copied := *category
+	return &copied, nil
+}
+
+func (r categoryRepository) ListAll() ([]*models.Category, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counts := make(map[uint]int)
+	for _, post := range r.posts {
+		if post.IsPublished {
+			counts[post.CategoryId]++
+		}
+	}
+	categories := make([]*models.Category, 0, len(r.categories))
+	for _, category := range r.categories {
+		copied := *category
+		copied.Count = counts[category.ID]
+		categories = append(categories, &copied)
+	}
+	return models.FlattenCategories(models.CategoryTree(categories)), nil
+}
+
+func (r categoryRepository) Count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.categories)
+}
+
+type seriesRepository struct {
+	*Store
+}
+
+func (r seriesRepository) Save(series *models.Series, postIds []uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, stored := range r.series {
+		if stored.Slug == series.Slug && stored.ID != series.ID {
+			return models.ErrSeriesSlugExists
+		}
+	}
+	for _, postId := range postIds {
+		if _, ok := r.posts[postId]; !ok {
+			return models.ErrPostNotFound
+		}
+	}
+	if series.ID == 0 {
+		r.stamp(&series.BaseModel)
+		copied := *series
+		r.series[series.ID] = &copied
+	} else {
+		stored, ok := r.series[series.ID]
+		if !ok {
+			return ErrRecordNotFound
+		}
+		stored.Title = series.Title
+		stored.Slug = series.Slug
+		stored.Description = series.Description
+		stored.UpdatedAt = time.Now()
+	}
+	for postId, seriesPost := range r.seriesPost {
+		if seriesPost.SeriesId == series.ID {
+			delete(r.seriesPost, postId)
+		}
+	}
+	position := 0
+	for _, postId := range postIds {
+		if seriesPost, ok := r.seriesPost[postId]; ok && seriesPost.SeriesId == series.ID {
+			continue
+		}
+		position++
+		r.seriesPost[postId] = &models.SeriesPost{SeriesId: series.ID, PostId: postId, Position: position}
+	}
+	return nil
+}
+
+func (r seriesRepository) Delete(id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for postId, seriesPost := range r.seriesPost {
+		if seriesPost.SeriesId == id {
+			delete(r.seriesPost, postId)
+		}
+	}
+	delete(r.series, id)
+	return nil
+}
+
+func (r seriesRepository) GetById(id uint) (*models.Series, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	series, ok := r.series[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	copied := *series
+	return &copied, nil
+}
+
+func (r seriesRepository) GetBySlug(slug string) (*models.Series, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, series := range r.series {
+		if series.Slug == slug {
+			copied := *series
+			return &copied, nil
+		}
+	}
+	return nil, ErrRecordNotFound
+}
+
+func (r seriesRepository) GetByPostId(postId uint) (*models.Series, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	seriesPost, ok := r.seriesPost[postId]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	series, ok := r.series[seriesPost.SeriesId]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	copied := *series
+	return &copied, nil
+}
+
+func (r seriesRepository) ListAll() ([]*models.Series, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	totals := make(map[uint]int)
+	for _, seriesPost := range r.seriesPost {
+		totals[seriesPost.SeriesId]++
+	}
+	list := make([]*models.Series, 0, len(r.series))
+	for _, series := range r.series {
+		copied := *series
+		copied.Total = totals[series.ID]
+		list = append(list, &copied)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	return list, nil
+}
+
+func (r seriesRepository) ListPosts(seriesId uint, published bool) ([]*models.Post, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var seriesPosts []*models.SeriesPost
+	for _, seriesPost := range r.seriesPost {
+		if seriesPost.SeriesId == seriesId {
+			seriesPosts = append(seriesPosts, seriesPost)
+		}
+	}
+	sort.Slice(seriesPosts, func(i, j int) bool {
+		return seriesPosts[i].Position < seriesPosts[j].Position
+	})
+	posts := make([]*models.Post, 0, len(seriesPosts))
+	for _, seriesPost := range seriesPosts {
+		post, ok := r.posts[seriesPost.PostId]
+		if !ok || published && !post.IsPublished {
+			continue
+		}
+		copied := *post
+		posts = append(posts, &copied)
+	}
+	return posts, nil
+}
+
+type commentRepository struct {
+	*Store
+}
+
+func (r commentRepository) Insert(comment *models.Comment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stamp(&comment.BaseModel)
+	copied := *comment
+	r.comments[comment.ID] = &copied
+	return nil
+}
+
+func (r commentRepository) Delete(id, userId uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if comment, ok := r.comments[id]; ok && comment.UserID == userId {
+		delete(r.comments, id)
+	}
+	return nil
+}
+
+func (r commentRepository) MarkRead(id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	comment, ok := r.comments[id]
+	if !ok {
+		return ErrRecordNotFound
+	}
+	comment.ReadState = true
+	return nil
+}
+
+func (r commentRepository) MarkAllRead() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, comment := range r.comments {
+		comment.ReadState = true
+	}
+	return nil
+}
+
+func (r commentRepository) list(match func(*models.Comment) bool) []*models.Comment {
+	comments := make([]*models.Comment, 0)
+	for _, comment := range r.comments {
+		if !match(comment) {
+			continue
+		}
+		copied := *comment
+		if user, ok := r.users[comment.UserID]; ok {
+			copied.NickName = user.NickName
+			copied.AvatarUrl = user.AvatarUrl
+			copied.GithubUrl = user.GithubUrl
+		}
+		comments = append(comments, &copied)
+	}
+	sort.Slice(comments, func(i, j int) bool {
+		return comments[i].CreatedAt.After(comments[j].CreatedAt)
+	})
+	return comments
+}
+
+func (r commentRepository) ListByPostId(postId uint) ([]*models.Comment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.list(func(comment *models.Comment) bool {
+		_, ok := r.users[comment.UserID]
+		return comment.PostID == postId && ok
+	}), nil
+}
+
+func (r commentRepository) ListUnread() ([]*models.Comment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.list(func(comment *models.Comment) bool {
+		return !comment.ReadState
+	}), nil
+}
+
+func (r commentRepository) CountByPostIds(postIds []uint) (map[uint]int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	wanted := make(map[uint]bool, len(postIds))
+	for _, postId := range postIds {
+		wanted[postId] = true
+	}
+	totals := make(map[uint]int)
+	for _, comment := range r.comments {
+		if wanted[comment.PostID] {
+			totals[comment.PostID]++
+		}
+	}
+	return totals, nil
+}
+
+func (r commentRepository) Count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.comments)
+}
+
+type linkRepository struct {
+	*Store
+}
+
+func (r linkRepository) Insert(link *models.Link) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, stored := range r.links {
+		if stored.Url == link.Url {
+			*link = *stored
+			return nil
+		}
+	}
+	r.stampModel(&link.Model)
+	copied := *link
+	r.links[link.ID] = &copied
+	return nil
+}
+
+func (r linkRepository) Update(link *models.Link) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.links[link.ID]
+	if !ok {
+		return ErrRecordNotFound
+	}
+	stored.Name = link.Name
+	stored.Url = link.Url
+	stored.Sort = link.Sort
+	stored.View = link.View
+	stored.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r linkRepository) UpdateView(link *models.Link) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.links[link.ID]
+	if !ok {
+		return ErrRecordNotFound
+	}
+	stored.View = link.View
+	return nil
+}
+
+func (r linkRepository) Delete(id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.links, id)
+	return nil
+}
+
+func (r linkRepository) GetById(id uint) (*models.Link, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	link, ok := r.links[id]
+	if !ok {
+		return &models.Link{}, ErrRecordNotFound
+	}
+	copied := *link
+	return &copied, nil
+}
+
+func (r linkRepository) ListAll() ([]*models.Link, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	links := make([]*models.Link, 0, len(r.links))
+	for _, link := range r.links {
+		copied := *link
+		links = append(links, &copied)
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].Sort == links[j].Sort {
+			return links[i].ID < links[j].ID
+		}
+		return links[i].Sort < links[j].Sort
+	})
+	return links, nil
+}
+
+type userRepository struct {
+	*Store
+}
+
+// 与数据库的唯一索引一致，邮箱和github账号不能重复
+func (r userRepository) Insert(user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, stored := range r.users {
+		if user.Email != "" && stored.Email == user.Email {
+			return fmt.Errorf("email %s already exists", user.Email)
+		}
+		if user.GithubLoginId != "" && stored.GithubLoginId == user.GithubLoginId {
+			return fmt.Errorf("github login id %s already exists", user.GithubLoginId)
+		}
+	}
+	r.stampModel(&user.Model)
+	copied := *user
+	r.users[user.ID] = &copied
+	return nil
+}
+
+// 按条件查找用户的副本，调用方需持有锁
+func (r userRepository) find(match func(*models.User) bool) (*models.User, error) {
+	for _, user := range r.users {
+		if match(user) {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return &models.User{}, ErrRecordNotFound
+}
+
+func (r userRepository) GetById(id uint) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[id]
+	if !ok {
+		return &models.User{}, ErrRecordNotFound
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (r userRepository) GetByUsername(username string) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.find(func(user *models.User) bool {
+		return user.Email == username
+	})
+}
+
+func (r userRepository) GetByGithubId(githubId string) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.find(func(user *models.User) bool {
+		return user.GithubLoginId == githubId
+	})
+}
+
+func (r userRepository) FirstOrCreateByGithub(user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if stored, err := r.find(func(stored *models.User) bool {
+		return stored.GithubLoginId == user.GithubLoginId
+	}); err == nil {
+		*user = *stored
+		return nil
+	}
+	r.stampModel(&user.Model)
+	copied := *user
+	r.users[user.ID] = &copied
+	return nil
+}
+
+// 修改已保存的用户，调用方需持有锁
+func (r userRepository) update(id uint, update func(stored *models.User)) error {
+	stored, ok := r.users[id]
+	if !ok {
+		return ErrRecordNotFound
+	}
+	update(stored)
+	stored.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r userRepository) UpdateProfile(user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.update(user.ID, func(stored *models.User) {
+		stored.AvatarUrl = user.AvatarUrl
+		stored.NickName = user.NickName
+	})
+}
+
+func (r userRepository) UpdateEmail(user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.update(user.ID, func(stored *models.User) {
+		stored.Email = user.Email
+	})
+}
+
+func (r userRepository) UpdateGithubUserInfo(user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.update(user.ID, func(stored *models.User) {
+		stored.GithubLoginId = user.GithubLoginId
+		stored.AvatarUrl = user.AvatarUrl
+		stored.GithubUrl = user.GithubUrl
+	})
+}
+
+func (r userRepository) Lock(user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.update(user.ID, func(stored *models.User) {
+		stored.LockState = user.LockState
+	})
+}
+
+func (r userRepository) ListNonAdmin() ([]*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	users := make([]*models.User, 0, len(r.users))
+	for _, user := range r.users {
+		if !user.IsAdmin {
+			copied := *user
+			users = append(users, &copied)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].ID < users[j].ID
+	})
+	return users, nil
+}
+
+type subscriberRepository struct {
+	*Store
+}
+
+// 订阅者是否应收到该文章：未关注标签，或关注了文章的任一标签，调用方需持有锁
+func (s *Store) follows(subscriberId, postId uint) bool {
+	tagIds := s.subscriberTags[subscriberId]
+	if len(tagIds) == 0 {
+		return true
+	}
+	for tagId := range s.postTags[postId] {
+		if tagIds[tagId] {
+			return true
+		}
+	}
+	return false
+}
+
+func (r subscriberRepository) Insert(subscriber *models.Subscriber) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, stored := range r.subscribers {
+		if stored.Email == subscriber.Email {
+			*subscriber = *stored
+			return nil
+		}
+	}
+	// 与数据库中的默认值一致
+	subscriber.SubscribeState = true
+	if subscriber.Frequency == "" {
+		subscriber.Frequency = models.FrequencyImmediate
+	}
+	r.stampModel(&subscriber.Model)
+	copied := *subscriber
+	copied.Tags = nil
+	r.subscribers[subscriber.ID] = &copied
+	return nil
+}
+
+// 修改已保存的订阅者，调用方需持有锁
+func (r subscriberRepository) update(id uint, update func(stored *models.Subscriber)) error {
+	stored, ok := r.subscribers[id]
+	if !ok {
+		return ErrRecordNotFound
+	}
+	update(stored)
+	stored.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r subscriberRepository) Update(subscriber *models.Subscriber) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.update(subscriber.ID, func(stored *models.Subscriber) {
+		stored.VerifyState = subscriber.VerifyState
+		stored.SubscribeState = subscriber.SubscribeState
+		stored.OutTime = subscriber.OutTime
+		stored.Signature = subscriber.Signature
+		stored.SecretKey = subscriber.SecretKey
+		stored.Frequency = subscriber.Frequency
+	})
+}
+
+func (r subscriberRepository) UpdateBounce(subscriber *models.Subscriber, eventId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.subscribers[subscriber.ID]; !ok {
+		return ErrRecordNotFound
+	}
+	if r.bounceEvents[subscriber.ID][eventId] {
+		return models.ErrBounceRecorded
+	}
+	if r.bounceEvents[subscriber.ID] == nil {
+		r.bounceEvents[subscriber.ID] = make(map[string]bool)
+	}
+	r.bounceEvents[subscriber.ID][eventId] = true
+	return r.update(subscriber.ID, func(stored *models.Subscriber) {
+		stored.SoftBounceCount = subscriber.SoftBounceCount
+		stored.HardBounceCount = subscriber.HardBounceCount
+		stored.LastBounceAt = subscriber.LastBounceAt
+		stored.SubscribeState = subscriber.SubscribeState
+	})
+}
+
+func (r subscriberRepository) UpdateLastDigest(subscriber *models.Subscriber) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.subscribers[subscriber.ID]
+	if !ok {
+		return ErrRecordNotFound
+	}
+	stored.LastDigestAt = subscriber.LastDigestAt
+	return nil
+}
+
+// 按条件查找订阅者的副本，调用方需持有锁
+func (r subscriberRepository) find(match func(*models.Subscriber) bool) (*models.Subscriber, error) {
+	for _, subscriber := range r.subscribers {
+		if match(subscriber) {
+			copied := *subscriber
+			return &copied, nil
+		}
+	}
+	return &models.Subscriber{}, ErrRecordNotFound
+}
+
+func (r subscriberRepository) GetById(id uint) (*models.Subscriber, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.find(func(subscriber *models.Subscriber) bool {
+		return subscriber.ID == id
+	})
+}
+
+func (r subscriberRepository) GetByEmail(email string) (*models.Subscriber, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.find(func(subscriber *models.Subscriber) bool {
+		return subscriber.Email == email
+	})
+}
+
+func (r subscriberRepository) GetBySignature(signature string) (*models.Subscriber, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.find(func(subscriber *models.Subscriber) bool {
+		return subscriber.Signature == signature
+	})
+}
+
+// 符合条件的订阅者副本，按id排列，调用方需持有锁
+func (r subscriberRepository) list(match func(*models.Subscriber) bool) []*models.Subscriber {
+	subscribers := make([]*models.Subscriber, 0)
+	for _, subscriber := range r.subscribers {
+		if match(subscriber) {
+			copied := *subscriber
+			subscribers = append(subscribers, &copied)
+		}
+	}
+	sort.Slice(subscribers, func(i, j int) bool {
+		return subscribers[i].ID < subscribers[j].ID
+	})
+	return subscribers
+}
+
+func (r subscriberRepository) ListByState(state string, pagination *models.Pagination) ([]*models.Subscriber, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	subscribers := r.list(func(subscriber *models.Subscriber) bool {
+		switch state {
+		case models.SubscriberStateVerified:
+			return subscriber.VerifyState && subscriber.SubscribeState
+		case models.SubscriberStateUnsubscribed:
+			return subscriber.VerifyState && !subscriber.SubscribeState
+		case models.SubscriberStatePending:
+			return !subscriber.VerifyState
+		}
+		return true
+	})
+	if pagination == nil {
+		return subscribers, nil
+	}
+	key := func(i int) (time.Time, uint) {
+		return subscribers[i].CreatedAt, subscribers[i].ID
+	}
+	sortByCreated(len(subscribers), key, func(i, j int) {
+		subscribers[i], subscribers[j] = subscribers[j], subscribers[i]
+	})
+	start, end, err := pageRange(len(subscribers), key, pagination)
+	if err != nil {
+		return nil, err
+	}
+	subscribers = subscribers[start:end]
+	return subscribers[:pagination.Fill(len(subscribers), key)], nil
+}
+
+func (r subscriberRepository) ListByFrequency(frequency string) ([]*models.Subscriber, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.list(func(subscriber *models.Subscriber) bool {
+		return subscriber.VerifyState && subscriber.SubscribeState && subscriber.Frequency == frequency
+	}), nil
+}
+
+func (r subscriberRepository) ListByPost(frequency string, postId uint) ([]*models.Subscriber, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.list(func(subscriber *models.Subscriber) bool {
+		return subscriber.VerifyState && subscriber.SubscribeState && subscriber.Frequency == frequency && r.follows(subscriber.ID, postId)
+	}), nil
+}
+
+func (r subscriberRepository) Count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.list(func(subscriber *models.Subscriber) bool {
+		return subscriber.VerifyState && subscriber.SubscribeState
+	}))
+}
+
+func (r subscriberRepository) SetTags(subscriberId uint, tagIds []uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	set := make(map[uint]bool, len(tagIds))
+	for _, tagId := range tagIds {
+		if _, ok := r.tags[tagId]; !ok {
+			return models.ErrTagNotFound
+		}
+		set[tagId] = true
+	}
+	r.subscriberTags[subscriberId] = set
+	return nil
+}
+
+func (r subscriberRepository) ListTags(subscriberId uint) ([]*models.Tag, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tags := make([]*models.Tag, 0)
+	for tagId := range r.subscriberTags[subscriberId] {
+		if tag, ok := r.tags[tagId]; ok {
+			copied := *tag
+			tags = append(tags, &copied)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].ID < tags[j].ID
+	})
+	return tags, nil
+}
+
+type mediaRepository struct {
+	*Store
+}
+
+func (r mediaRepository) Insert(media *models.Media) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, stored := range r.media {
+		if stored.Driver == media.Driver && stored.StorageKey == media.StorageKey {
+			*media = *stored
+			return nil
+		}
+	}
+	r.stamp(&media.BaseModel)
+	copied := *media
+	copied.Posts, copied.Variants = nil, nil
+	r.media[media.ID] = &copied
+	return nil
+}
+
+func (r mediaRepository) InsertVariant(variant *models.MediaVariant) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stamp(&variant.BaseModel)
+	copied := *variant
+	r.variants[variant.ID] = &copied
+	return nil
+}
+
+func (r mediaRepository) Delete(id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for variantId, variant := range r.variants {
+		if variant.MediaId == id {
+			delete(r.variants, variantId)
+		}
+	}
+	delete(r.media, id)
+	return nil
+}
+
+// 按条件查找文件的副本，调用方需持有锁
+func (r mediaRepository) find(match func(*models.Media) bool) (*models.Media, error) {
+	for _, media := range r.media {
+		if match(media) {
+			copied := *media
+			return &copied, nil
+		}
+	}
+	return &models.Media{}, ErrRecordNotFound
+}
+
+func (r mediaRepository) GetById(id uint) (*models.Media, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.find(func(media *models.Media) bool {
+		return media.ID == id
+	})
+}
+
+func (r mediaRepository) GetByHash(driver, hash string) (*models.Media, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.find(func(media *models.Media) bool {
+		return media.Driver == driver && media.Hash == hash
+	})
+}
+
+func (r mediaRepository) List(keyword string, pagination *models.Pagination) ([]*models.Media, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	medias := make([]*models.Media, 0)
+	for _, media := range r.media {
+		if keyword == "" || strings.Contains(media.FileName, keyword) || strings.Contains(media.Url, keyword) {
+			copied := *media
+			medias = append(medias, &copied)
+		}
+	}
+	key := func(i int) (time.Time, uint) {
+		return medias[i].CreatedAt, medias[i].ID
+	}
+	if pagination == nil {
+		// 与数据库实现一致，不分页时按id倒序
+		sort.Slice(medias, func(i, j int) bool {
+			return medias[i].ID > medias[j].ID
+		})
+		return medias, nil
+	}
+	sortByCreated(len(medias), key, func(i, j int) {
+		medias[i], medias[j] = medias[j], medias[i]
+	})
+	start, end, err := pageRange(len(medias), key, pagination)
+	if err != nil {
+		return nil, err
+	}
+	medias = medias[start:end]
+	return medias[:pagination.Fill(len(medias), key)], nil
+}
+
+// 文件的衍生文件副本，按宽度倒序，调用方需持有锁
+func (r mediaRepository) listVariants(mediaId uint) []*models.MediaVariant {
+	variants := make([]*models.MediaVariant, 0)
+	for _, variant := range r.variants {
+		if variant.MediaId == mediaId {
+			copied := *variant
+			variants = append(variants, &copied)
+		}
+	}
+	sort.Slice(variants, func(i, j int) bool {
+		if variants[i].Width == variants[j].Width {
+			return variants[i].ID < variants[j].ID
+		}
+		return variants[i].Width > variants[j].Width
+	})
+	return variants
+}
+
+func (r mediaRepository) ListVariants(mediaId uint) ([]*models.MediaVariant, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.listVariants(mediaId), nil
+}
+
+func (r mediaRepository) ListVariantsByMediaIds(mediaIds []uint) (map[uint][]*models.MediaVariant, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	grouped := make(map[uint][]*models.MediaVariant)
+	for _, mediaId := range mediaIds {
+		if variants := r.listVariants(mediaId); len(variants) > 0 {
+			grouped[mediaId] = variants
+		}
+	}
+	return grouped, nil
+}
+
+func (r mediaRepository) ListByUrls(urls []string) ([]*models.Media, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	wanted := make(map[string]bool, len(urls))
+	for _, url := range urls {
+		wanted[url] = true
+	}
+	medias := make([]*models.Media, 0)
+	for _, media := range r.media {
+		if wanted[media.Url] {
+			copied := *media
+			copied.Variants = r.listVariants(media.ID)
+			medias = append(medias, &copied)
+		}
+	}
+	sort.Slice(medias, func(i, j int) bool {
+		return medias[i].ID < medias[j].ID
+	})
+	return medias, nil
+}
+
+func (r mediaRepository) SumSizeByUserId(userId uint) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var total int64
+	for _, media := range r.media {
+		if media.UserId != userId {
+			continue
+		}
+		total += media.Size
+		for _, variant := range r.variants {
+			if variant.MediaId == media.ID {
+				total += variant.Size
+			}
+		}
+	}
+	return total, nil
+}
+
+type backupRepository struct {
+	*Store
+}
+
+func (r backupRepository) ListAll() ([]*models.Backup, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	backups := make([]*models.Backup, 0, len(r.backups))
+	for _, backup := range r.backups {
+		copied := *backup
+		backups = append(backups, &copied)
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].ID > backups[j].ID
+	})
+	return backups, nil
+}
@@ -0,0 +1,279 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cihub/seelog"
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+
+	"blog/system"
+)
+
+// 一次数据库结构变更，Up和Down在同一个事务中执行，Down为nil表示不可回滚
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// table schema_migrations, 已执行的迁移
+type SchemaMigration struct {
+	Version   int64 `gorm:"primary_key;auto_increment:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+// 迁移的执行状态
+type MigrationStatus struct {
+	*Migration
+	AppliedAt *time.Time // 未执行时为nil
+}
+
+// 按版本号排序的全部迁移
+func sortedMigrations() []*Migration {
+	sorted := make([]*Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+	return sorted
+}
+
+func appliedMigrations() (map[int64]*SchemaMigration, error) {
+	if err := DB.AutoMigrate(&SchemaMigration{}).Error; err != nil {
+		return nil, err
+	}
+	var records []*SchemaMigration
+	if err := DB.Find(&records).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]*SchemaMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// 全部迁移及其执行状态
+func ListMigrationStatus() ([]*MigrationStatus, error) {
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	var statuses []*MigrationStatus
+	for _, migration := range sortedMigrations() {
+		status := &MigrationStatus{Migration: migration}
+		if record, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &record.AppliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// 按版本号依次执行未执行的迁移，steps<=0时执行全部，返回执行的数量
+func MigrateUp(steps int) (int, error) {
+	statuses, err := ListMigrationStatus()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, status := range statuses {
+		if status.AppliedAt != nil {
+			continue
+		}
+		if steps > 0 && count >= steps {
+			break
+		}
+		migration := status.Migration
+		err = runMigration(migration, migration.Up, func(tx *gorm.DB) error {
+			return tx.Create(&SchemaMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return count, errors.Wrapf(err, "migrate up %d_%s", migration.Version, migration.Name)
+		}
+		seelog.Infof("[MigrateUp]applied %d_%s", migration.Version, migration.Name)
+		count++
+	}
+	return count, nil
+}
+
+// 按版本号倒序回滚已执行的迁移，steps<=0时回滚全部，返回回滚的数量
+func MigrateDown(steps int) (int, error) {
+	statuses, err := ListMigrationStatus()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for i := len(statuses) - 1; i >= 0; i-- {
+		if statuses[i].AppliedAt == nil {
+			continue
+		}
+		if steps > 0 && count >= steps {
+			break
+		}
+		migration := statuses[i].Migration
+		if migration.Down == nil {
+			return count, errors.Errorf("migration %d_%s is irreversible", migration.Version, migration.Name)
+		}
+		err = runMigration(migration, migration.Down, func(tx *gorm.DB) error {
+			return tx.Delete(&SchemaMigration{Version: migration.Version}).Error
+		})
+		if err != nil {
+			return count, errors.Wrapf(err, "migrate down %d_%s", migration.Version, migration.Name)
+		}
+		seelog.Infof("[MigrateDown]reverted %d_%s", migration.Version, migration.Name)
+		count++
+	}
+	return count, nil
+}
+
+func runMigration(migration *Migration, change, record func(tx *gorm.DB) error) error {
+	return Transaction(func(tx *gorm.DB) error {
+		if err := change(tx); err != nil {
+			return err
+		}
+		return record(tx)
+	})
+}
+
+// 启动时的迁移：开启migrate_on_startup时执行全部未执行的迁移，否则只提示
+func MigrateOnStartup() error {
+	if system.GetConfiguration().MigrateOnStartup {
+		_, err := MigrateUp(0)
+		return err
+	}
+	statuses, err := ListMigrationStatus()
+	if err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			seelog.Warnf("[MigrateOnStartup]migration %d_%s is pending, run the migrate up command", status.Version, status.Name)
+		}
+	}
+	return nil
+}
+
+// 删除model对应表中的columns，model为删除后的表结构快照。
+// 内置的SQLite不支持drop column，按SQLite文档的做法新建表、复制数据、删除旧表再改名，并重建仍然适用的索引
+func dropColumns(tx *gorm.DB, model interface{}, columns ...string) error {
+	if Driver() != DriverSqlite {
+		for _, column := range columns {
+			if err := tx.Model(model).DropColumn(column).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return rebuildSqliteTable(tx, model)
+}
+
+func rebuildSqliteTable(tx *gorm.DB, model interface{}) error {
+	table := tx.NewScope(model).TableName()
+	temp := table + "__rebuild"
+	if err := tx.Table(temp).CreateTable(model).Error; err != nil {
+		return err
+	}
+	// 由结构标签自动创建在临时表上的索引名称带有临时表名，删除后统一按旧表的索引重建
+	var autoIndexes []string
+	if err := tx.Raw("select name from sqlite_master where type = 'index' and tbl_name = ? and sql is not null", temp).Pluck("name", &autoIndexes).Error; err != nil {
+		return err
+	}
+	for _, name := range autoIndexes {
+		if err := tx.Exec("drop index " + quoteSqlite(name)).Error; err != nil {
+			return err
+		}
+	}
+	keep, err := sqliteColumns(tx, "pragma table_info("+quoteSqlite(temp)+")", 1)
+	if err != nil {
+		return err
+	}
+	kept := make(map[string]bool, len(keep))
+	quoted := make([]string, len(keep))
+	for i, column := range keep {
+		kept[column] = true
+		quoted[i] = quoteSqlite(column)
+	}
+	// 记录旧表上只涉及保留列的索引，删除旧表后重新创建
+	type index struct {
+		Name string
+		Sql  string
+	}
+	var indexes, restore []index
+	if err = tx.Raw("select name, sql from sqlite_master where type = 'index' and tbl_name = ? and sql is not null", table).Scan(&indexes).Error; err != nil {
+		return err
+	}
+	for _, idx := range indexes {
+		columns, err := sqliteColumns(tx, "pragma index_info("+quoteSqlite(idx.Name)+")", 2)
+		if err != nil {
+			return err
+		}
+		applies := true
+		for _, column := range columns {
+			applies = applies && kept[column]
+		}
+		if applies {
+			restore = append(restore, idx)
+		}
+	}
+	list := strings.Join(quoted, ", ")
+	statements := []string{
+		fmt.Sprintf("insert into %s (%s) select %s from %s", quoteSqlite(temp), list, list, quoteSqlite(table)),
+		"drop table " + quoteSqlite(table),
+		fmt.Sprintf("alter table %s rename to %s", quoteSqlite(temp), quoteSqlite(table)),
+	}
+	for _, idx := range restore {
+		statements = append(statements, idx.Sql)
+	}
+	for _, statement := range statements {
+		if err = tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 执行pragma并读取结果中第n列的列名
+func sqliteColumns(tx *gorm.DB, pragma string, n int) ([]string, error) {
+	rows, err := tx.Raw(pragma).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	names, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var columns []string
+	for rows.Next() {
+		values := make([]interface{}, len(names))
+		var name sql.NullString
+		for i := range values {
+			if i == n {
+				values[i] = &name
+			} else {
+				values[i] = new(interface{})
+			}
+		}
+		if err = rows.Scan(values...); err != nil {
+			return nil, err
+		}
+		columns = append(columns, name.String)
+	}
+	return columns, rows.Err()
+}
+
+func quoteSqlite(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
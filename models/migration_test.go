@@ -0,0 +1,109 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"blog/models"
+	"blog/models/testdb"
+)
+
+func TestMigrateDownUp(t *testing.T) {
+	db := testdb.Open(t)
+	statuses, err := models.ListMigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			t.Fatalf("migration %d is not applied", status.Version)
+		}
+	}
+
+	n, err := models.MigrateDown(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(statuses) {
+		t.Fatalf("rolled back %d migrations, want %d", n, len(statuses))
+	}
+	for _, table := range []string{"posts", "tags", "categories", "series", "related_posts", "media", "bounce_events"} {
+		if db.HasTable(table) {
+			t.Errorf("table %s still exists after rolling back all migrations", table)
+		}
+	}
+
+	if n, err = models.MigrateUp(0); err != nil {
+		t.Fatal(err)
+	}
+	if n != len(statuses) {
+		t.Fatalf("applied %d migrations, want %d", n, len(statuses))
+	}
+}
+
+// 回滚新增列的迁移时只删除这些列，已有数据保留，再次迁移后补全published_at
+func TestMigrateDownKeepsRows(t *testing.T) {
+	db := testdb.Open(t)
+	category := &models.Category{Name: "Go", Slug: "go"}
+	if err := category.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	tag := &models.Tag{Name: "gorm", Description: "orm"}
+	if err := tag.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	createdAt := time.Date(2020, 5, 10, 12, 0, 0, 0, time.UTC)
+	post := &models.Post{Title: "migrations", Body: "body", IsPublished: true, CategoryId: category.ID}
+	post.CreatedAt = createdAt
+	if err := models.SavePost(post, []uint{tag.ID}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// 9 bounce_events, 8 text_columns, 7 published_at, 6 related_posts, 5 series, 4 categories
+	if _, err := models.MigrateDown(6); err != nil {
+		t.Fatal(err)
+	}
+	for _, column := range []string{"category_id", "published_at"} {
+		if db.Dialect().HasColumn("posts", column) {
+			t.Errorf("posts.%s still exists", column)
+		}
+	}
+	if !db.Dialect().HasColumn("tags", "description") {
+		t.Error("tags.description was dropped by a later migration")
+	}
+	var count int
+	if err := db.Table("posts").Where("title = ?", "migrations").Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("posts with title migrations = %d, want 1", count)
+	}
+
+	// 3 tag description and cover
+	if _, err := models.MigrateDown(1); err != nil {
+		t.Fatal(err)
+	}
+	if db.Dialect().HasColumn("tags", "description") {
+		t.Error("tags.description still exists")
+	}
+	if err := db.Table("tags").Where("name = ?", "gorm").Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("tags named gorm = %d, want 1", count)
+	}
+
+	if _, err := models.MigrateUp(0); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := models.GetPostById(itoa(post.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.CategoryId != 0 {
+		t.Errorf("category_id = %d, want 0", stored.CategoryId)
+	}
+	if stored.PublishedAt == nil || !stored.PublishedAt.Equal(stored.CreatedAt) {
+		t.Errorf("published_at = %v, want created_at %v", stored.PublishedAt, stored.CreatedAt)
+	}
+}
@@ -0,0 +1,504 @@
+package models
+
+import (
+	"mime"
+	"path"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// 全部迁移，新增结构变更时在末尾追加，已发布的迁移不要修改。
+// 迁移只使用本文件中定义的结构快照，不使用会随功能变化的模型结构，保证同一个迁移在任何时候执行的结果都相同
+var migrations = []*Migration{
+	{
+		// 引入迁移之前由AutoMigrate创建的表结构，对已有数据库重复执行不会改变数据
+		Version: 1,
+		Name:    "initial_schema",
+		Up: func(tx *gorm.DB) error {
+			err := tx.AutoMigrate(&pageV1{}, &postV1{}, &tagV1{}, &postTagV1{}, &userV1{}, &commentV1{}, &subscriberV1{}, &linkV1{}, &smmsFileV1{}, &subscriberTagV1{}, &mediaV1{}, &mediaVariantV1{}, &backupV1{}).Error
+			if err != nil {
+				return err
+			}
+			indexes := []struct {
+				model   interface{}
+				unique  bool
+				name    string
+				columns []string
+			}{
+				{&postTagV1{}, true, "uk_post_tag", []string{"post_id", "tag_id"}},
+				{&subscriberTagV1{}, true, "uk_subscriber_tag", []string{"subscriber_id", "tag_id"}},
+				{&mediaV1{}, false, "idx_media_storage_key", []string{"driver", "storage_key"}},
+				{&mediaV1{}, false, "idx_media_hash", []string{"hash"}},
+				{&mediaVariantV1{}, false, "idx_media_variant_media_id", []string{"media_id"}},
+			}
+			for _, index := range indexes {
+				if err = addIndex(tx, index.model, index.unique, index.name, index.columns...); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.DropTableIfExists(&pageV1{}, &postV1{}, &tagV1{}, &postTagV1{}, &userV1{}, &commentV1{}, &subscriberV1{}, &linkV1{}, &smmsFileV1{}, &subscriberTagV1{}, &mediaV1{}, &mediaVariantV1{}, &backupV1{}).Error
+		},
+	},
+	{
+		// 将早期只记录在smms_files中的上传文件同步到媒体库
+		Version: 2,
+		Name:    "sync_smms_file_media",
+		Up:      syncSmmsFileMedia,
+		Down: func(tx *gorm.DB) error {
+			return tx.Where("driver = ? and storage_key in (select path from smms_files)", "smms").Delete(&mediaV1{}).Error
+		},
+	},
+	{
+		// 标签介绍和封面图片
+		Version: 3,
+		Name:    "tag_description_cover",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&tagV3{}).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &tagV1{}, "description", "cover")
+		},
+	},
+	{
+		// 多级分类和文章的主分类
+		Version: 4,
+		Name:    "categories",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&categoryV4{}, &postV4{}).Error; err != nil {
+				return err
+			}
+			// 已有文章为未分类，包括旧版本回滚后保留了category_id列的SQLite数据库
+			if err := tx.Model(&postV4{}).Where("category_id is null").UpdateColumn("category_id", 0).Error; err != nil {
+				return err
+			}
+			if err := addIndex(tx, &categoryV4{}, true, "uk_category_slug", "slug"); err != nil {
+				return err
+			}
+			if err := addIndex(tx, &categoryV4{}, false, "idx_category_parent_id", "parent_id"); err != nil {
+				return err
+			}
+			return addIndex(tx, &postV4{}, false, "idx_post_category_id", "category_id")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.DropTableIfExists(&categoryV4{}).Error; err != nil {
+				return err
+			}
+			return dropColumns(tx, &postV1{}, "category_id")
+		},
+	},
+	{
+		// 文章系列
+		Version: 5,
+		Name:    "series",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&seriesV5{}, &seriesPostV5{}).Error; err != nil {
+				return err
+			}
+			if err := addIndex(tx, &seriesV5{}, true, "uk_series_slug", "slug"); err != nil {
+				return err
+			}
+			if err := addIndex(tx, &seriesPostV5{}, true, "uk_series_post_post_id", "post_id"); err != nil {
+				return err
+			}
+			return addIndex(tx, &seriesPostV5{}, false, "idx_series_post_series_id", "series_id", "position")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.DropTableIfExists(&seriesV5{}, &seriesPostV5{}).Error
+		},
+	},
+	{
+		// 预先计算的相关文章，启动后由后台任务生成
+		Version: 6,
+		Name:    "related_posts",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&relatedPostV6{}).Error; err != nil {
+				return err
+			}
+			return addIndex(tx, &relatedPostV6{}, false, "idx_related_post_post_id", "post_id", "score")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.DropTableIfExists(&relatedPostV6{}).Error
+		},
+	},
+	{
+		// 文章的发布时间，摘要邮件按它筛选文章；已发布的文章以创建时间作为发布时间
+		Version: 7,
+		Name:    "post_published_at",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&postV7{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Exec("update posts set published_at = created_at where is_published = ? and published_at is null", true).Error; err != nil {
+				return err
+			}
+			return addIndex(tx, &postV7{}, false, "idx_post_published_at", "published_at")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &postV4{}, "published_at")
+		},
+	},
+	{
+		// 正文、评论和备份信息改为text，之前在mysql和postgres上创建的是varchar(255)，较长的内容会被截断或拒绝；
+		// sqlite不限制长度，无需修改
+		Version: 8,
+		Name:    "text_columns",
+		Up: func(tx *gorm.DB) error {
+			if Driver() == DriverSqlite {
+				return nil
+			}
+			for _, column := range textColumns {
+				if err := tx.Table(column[0]).ModifyColumn(column[1], "text").Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		// 保留text类型，改回varchar(255)会截断已有的内容
+		Down: func(tx *gorm.DB) error {
+			return nil
+		},
+	},
+	{
+		// 已记录的退信，用于退信处理失败重试或重复推送时不重复计数
+		Version: 9,
+		Name:    "bounce_events",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&bounceEventV9{}).Error; err != nil {
+				return err
+			}
+			return addIndex(tx, &bounceEventV9{}, true, "uk_bounce_event", "event_id", "subscriber_id")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.DropTableIfExists(&bounceEventV9{}).Error
+		},
+	},
+}
+
+// 迁移8改为text的列，表名和列名
+var textColumns = [][2]string{
+	{"posts", "body"},
+	{"pages", "body"},
+	{"comments", "content"},
+	{"backups", "message"},
+}
+
+// 索引不存在时创建，兼容迁移之前已经创建了索引的数据库
+func addIndex(tx *gorm.DB, model interface{}, unique bool, name string, columns ...string) error {
+	scope := tx.NewScope(model)
+	if scope.Dialect().HasIndex(scope.TableName(), name) {
+		return nil
+	}
+	if unique {
+		return tx.Model(model).AddUniqueIndex(name, columns...).Error
+	}
+	return tx.Model(model).AddIndex(name, columns...).Error
+}
+
+func syncSmmsFileMedia(tx *gorm.DB) error {
+	var smmsFiles []*smmsFileV1
+	if err := tx.Find(&smmsFiles).Error; err != nil {
+		return err
+	}
+	for _, smmsFile := range smmsFiles {
+		media := &mediaV1{
+			Driver:      "smms",
+			StorageKey:  smmsFile.Path,
+			Url:         smmsFile.Url,
+			FileName:    smmsFile.FileName,
+			ContentType: mime.TypeByExtension(path.Ext(smmsFile.FileName)),
+			Size:        int64(smmsFile.Size),
+			Width:       smmsFile.Width,
+			Height:      smmsFile.Height,
+		}
+		media.CreatedAt = smmsFile.CreatedAt
+		err := tx.FirstOrCreate(media, "driver = ? and storage_key = ?", media.Driver, media.StorageKey).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 以下是各个迁移执行时的表结构快照，类型名的后缀是引入或最后修改该表的迁移版本。
+// gorm不读取未导出的嵌入结构，所以不嵌入BaseModel，而是各自写出id和时间字段
+
+type pageV1 struct {
+	ID          uint `gorm:"primary_key"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Title       string
+	Body        string `gorm:"type:text"`
+	View        int
+	IsPublished bool
+}
+
+func (pageV1) TableName() string { return "pages" }
+
+type postV1 struct {
+	ID          uint `gorm:"primary_key"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Title       string
+	Body        string `gorm:"type:text"`
+	View        int
+	IsPublished bool
+}
+
+func (postV1) TableName() string { return "posts" }
+
+type tagV1 struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Name      string
+}
+
+func (tagV1) TableName() string { return "tags" }
+
+type postTagV1 struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	PostId    uint
+	TagId     uint
+}
+
+func (postTagV1) TableName() string { return "post_tags" }
+
+type userV1 struct {
+	ID            uint `gorm:"primary_key"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	DeletedAt     *time.Time `sql:"index"`
+	Email         string     `gorm:"unique_index;default:null"`
+	Telephone     string     `gorm:"unique_index;default:null"`
+	Password      string     `gorm:"default:null"`
+	VerifyState   string     `gorm:"default:'0'"`
+	SecretKey     string     `gorm:"default:null"`
+	OutTime       time.Time
+	GithubLoginId string `gorm:"unique_index;default:null"`
+	GithubUrl     string
+	IsAdmin       bool
+	AvatarUrl     string
+	NickName      string
+	LockState     bool `gorm:"default:'0'"`
+}
+
+func (userV1) TableName() string { return "users" }
+
+type commentV1 struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uint
+	Content   string `gorm:"type:text"`
+	PostID    uint
+	ReadState bool `gorm:"default:'0'"`
+}
+
+func (commentV1) TableName() string { return "comments" }
+
+type subscriberV1 struct {
+	ID              uint `gorm:"primary_key"`
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	DeletedAt       *time.Time `sql:"index"`
+	Email           string     `gorm:"unique_index"`
+	VerifyState     bool       `gorm:"default:'0'"`
+	SubscribeState  bool       `gorm:"default:'1'"`
+	OutTime         time.Time
+	SecretKey       string
+	Signature       string
+	Frequency       string `gorm:"default:'immediate'"`
+	LastDigestAt    time.Time
+	SoftBounceCount int
+	HardBounceCount int
+	LastBounceAt    time.Time
+}
+
+func (subscriberV1) TableName() string { return "subscribers" }
+
+type linkV1 struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt *time.Time `sql:"index"`
+	Name      string
+	Url       string
+	Sort      int `gorm:"default:'0'"`
+	View      int
+}
+
+func (linkV1) TableName() string { return "links" }
+
+type smmsFileV1 struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	FileName  string
+	StoreName string
+	Size      int
+	Width     int
+	Height    int
+	Hash      string
+	Delete    string
+	Url       string
+	Path      string
+}
+
+func (smmsFileV1) TableName() string { return "smms_files" }
+
+type subscriberTagV1 struct {
+	ID           uint `gorm:"primary_key"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	SubscriberId uint
+	TagId        uint
+}
+
+func (subscriberTagV1) TableName() string { return "subscriber_tags" }
+
+type mediaV1 struct {
+	ID          uint `gorm:"primary_key"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Driver      string
+	StorageKey  string
+	Url         string
+	FileName    string
+	ContentType string
+	Size        int64
+	Width       int
+	Height      int
+	Hash        string
+	UserId      uint
+}
+
+func (mediaV1) TableName() string { return "media" }
+
+type mediaVariantV1 struct {
+	ID          uint `gorm:"primary_key"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	MediaId     uint
+	Name        string
+	StorageKey  string
+	Url         string
+	ContentType string
+	Size        int64
+	Width       int
+	Height      int
+}
+
+func (mediaVariantV1) TableName() string { return "media_variants" }
+
+type backupV1 struct {
+	ID          uint `gorm:"primary_key"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	FileName    string
+	Destination string
+	Size        int64
+	Status      string
+	Message     string `gorm:"type:text"`
+}
+
+func (backupV1) TableName() string { return "backups" }
+
+type tagV3 struct {
+	ID          uint `gorm:"primary_key"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Name        string
+	Description string `gorm:"type:text"`
+	Cover       string
+}
+
+func (tagV3) TableName() string { return "tags" }
+
+type categoryV4 struct {
+	ID          uint `gorm:"primary_key"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Name        string
+	Slug        string
+	ParentId    uint
+	Sort        int    `gorm:"default:'0'"`
+	Description string `gorm:"type:text"`
+}
+
+func (categoryV4) TableName() string { return "categories" }
+
+type postV4 struct {
+	ID          uint `gorm:"primary_key"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Title       string
+	Body        string `gorm:"type:text"`
+	View        int
+	IsPublished bool
+	CategoryId  uint `gorm:"default:'0'"`
+}
+
+func (postV4) TableName() string { return "posts" }
+
+type seriesV5 struct {
+	ID          uint `gorm:"primary_key"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Title       string
+	Slug        string
+	Description string `gorm:"type:text"`
+}
+
+func (seriesV5) TableName() string { return "series" }
+
+type seriesPostV5 struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	SeriesId  uint
+	PostId    uint
+	Position  int
+}
+
+func (seriesPostV5) TableName() string { return "series_posts" }
+
+type relatedPostV6 struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	PostId    uint
+	RelatedId uint
+	Score     float64
+}
+
+func (relatedPostV6) TableName() string { return "related_posts" }
+
+type postV7 struct {
+	ID          uint `gorm:"primary_key"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Title       string
+	Body        string `gorm:"type:text"`
+	View        int
+	IsPublished bool
+	CategoryId  uint `gorm:"default:'0'"`
+	PublishedAt *time.Time
+}
+
+func (postV7) TableName() string { return "posts" }
+
+type bounceEventV9 struct {
+	ID           uint `gorm:"primary_key"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	EventId      string `gorm:"size:64"`
+	SubscriberId uint
+}
+
+func (bounceEventV9) TableName() string { return "bounce_events" }
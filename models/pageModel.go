@@ -6,7 +6,7 @@ import . "blog/helpers"
 type Page struct {
 	BaseModel
 	Title       string // title
-	Body        string // body
+	Body        string `gorm:"type:text"` // body
 	View        int    // view count
 	IsPublished bool   // published or not
 }
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+
+	"blog/system"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Pagination 列表的分页参数，记录按created_at、id倒序排列。
+// Cursor为空时按页码分页并统计Total；否则为游标(keyset)分页，从游标指向的记录之后继续读取，
+// 翻页较深时不需要扫描offset之前的行，翻页期间新增的记录也不会造成重复。
+// 查询完成后NextCursor为下一页的游标，没有下一页时为空
+type Pagination struct {
+	Page       int    `json:"page"`
+	PageSize   int    `json:"page_size"`
+	Cursor     string `json:"cursor,omitempty"`
+	Total      int    `json:"total"` // 仅页码分页时统计
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// NewPagination 页码从1开始，pageSize限制在1到max_page_size之间，小于1时使用defaultSize
+func NewPagination(page, pageSize, defaultSize int, cursor string) *Pagination {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = defaultSize
+	}
+	if maxSize := system.GetConfiguration().MaxPageSize; pageSize > maxSize {
+		pageSize = maxSize
+	}
+	return &Pagination{Page: page, PageSize: pageSize, Cursor: cursor}
+}
+
+func (p *Pagination) TotalPage() int {
+	return (p.Total + p.PageSize - 1) / p.PageSize
+}
+
+func (p *Pagination) HasPrev() bool {
+	return p.Cursor == "" && p.Page > 1
+}
+
+func (p *Pagination) HasNext() bool {
+	return p.NextCursor != ""
+}
+
+// 为查询加上排序、游标条件和limit，页码分页时先统计总数；table为排序字段所属的表名或别名
+func (p *Pagination) paginate(db *gorm.DB, table string) (*gorm.DB, error) {
+	if p.Cursor == "" {
+		if err := db.Count(&p.Total).Error; err != nil {
+			return nil, err
+		}
+		db = db.Offset((p.Page - 1) * p.PageSize)
+	} else {
+		createdAt, id, err := DecodeCursor(p.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where(fmt.Sprintf("%[1]s.created_at < ? or (%[1]s.created_at = ? and %[1]s.id < ?)", table), createdAt, createdAt, id)
+	}
+	// 多取一条用于判断是否还有下一页
+	return db.Order(table + ".created_at desc").Order(table + ".id desc").Limit(p.PageSize + 1), nil
+}
+
+// Fill 处理多取一条的查询结果：n为结果条数，key返回第i条记录的创建时间和id，返回本页应保留的条数并设置NextCursor
+func (p *Pagination) Fill(n int, key func(i int) (time.Time, uint)) int {
+	p.NextCursor = ""
+	if n <= p.PageSize {
+		return n
+	}
+	p.NextCursor = EncodeCursor(key(p.PageSize - 1))
+	return p.PageSize
+}
+
+// EncodeCursor 游标由记录的创建时间和id组成，时间保留原始时区，保证与数据库中的值比较一致
+func EncodeCursor(createdAt time.Time, id uint) string {
+	value := createdAt.Format(time.RFC3339Nano) + "," + strconv.FormatUint(uint64(id), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(value))
+}
+
+func DecodeCursor(cursor string) (time.Time, uint, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(data), ",", 2)
+	if len(parts) != 2 {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	id, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	return createdAt, uint(id), nil
+}
@@ -9,15 +9,20 @@ import (
 	"time"
 	"fmt"
 	. "blog/helpers"
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
 )
 
 // table posts
 type Post struct {
 	BaseModel
 	Title        string                // title
-	Body         string                // body
+	Body         string     `gorm:"type:text"` // body
 	View         int                   // view count
 	IsPublished  bool                  // published or not
+	PublishedAt  *time.Time            // 最近一次发布的时间，未发布时为nil，摘要邮件按它筛选文章
+	CategoryId   uint       `gorm:"default:'0'"` // 主分类，0为未分类
+	Category     *Category  `gorm:"-"` // 主分类，列表页和文章页使用
 	Tags         []*Tag     `gorm:"-"` // tags of post
 	Comments     []*Comment `gorm:"-"` // comments of post
 	CommentTotal int        `gorm:"-"` // count of comment
@@ -33,17 +38,112 @@ type QrArchive struct {
 
 // Post
 func (post *Post) Insert() error {
+	post.SyncPublishedAt()
 	return DB.Create(post).Error
 }
 
+// 更新标题、正文和发布状态，post.PublishedAt应为数据库中的值
 func (post *Post) Update() error {
+	post.SyncPublishedAt()
 	return DB.Model(post).Updates(map[string]interface{}{
 		"title":        post.Title,
 		"body":         post.Body,
 		"is_published": post.IsPublished,
+		"published_at": post.PublishedAt,
 	}).Error
 }
 
+// SyncPublishedAt 由未发布变为已发布时记录发布时间，取消发布时清空，重新发布的文章会再次进入摘要
+func (post *Post) SyncPublishedAt() {
+	if !post.IsPublished {
+		post.PublishedAt = nil
+	} else if post.PublishedAt == nil {
+		now := time.Now()
+		post.PublishedAt = &now
+	}
+}
+
+// 保存文章时引用了不存在的标签
+var ErrTagNotFound = errors.New("tag not found")
+
+// SavePost 在一个事务中新建或更新文章并用tagIds替换其全部标签，任一步失败时都不会留下部分写入；post.ID为0时新建。
+// tagNames为编辑时新输入的标签名，不存在的标签会被创建；post.CategoryId不为0时分类必须存在
+func SavePost(post *Post, tagIds []uint, tagNames []string) error {
+	tagIds = uniqueIds(tagIds)
+	return Transaction(func(tx *gorm.DB) error {
+		// 更新时先确认文章存在：MySQL默认返回实际修改的行数，内容未变时RowsAffected为0，不能据此判断
+		var stored Post
+		if post.ID != 0 {
+			if err := tx.Select("published_at").First(&stored, post.ID).Error; err != nil {
+				return err
+			}
+		}
+		if post.CategoryId > 0 {
+			var count int
+			if err := tx.Model(&Category{}).Where("id = ?", post.CategoryId).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return ErrCategoryNotFound
+			}
+		}
+		if len(tagIds) > 0 {
+			var count int
+			if err := tx.Model(&Tag{}).Where("id in (?)", tagIds).Count(&count).Error; err != nil {
+				return err
+			}
+			if count != len(tagIds) {
+				return ErrTagNotFound
+			}
+		}
+		newTagIds, err := findOrCreateTags(tx, tagNames)
+		if err != nil {
+			return err
+		}
+		tagIds = uniqueIds(append(tagIds, newTagIds...))
+		if post.ID == 0 {
+			post.SyncPublishedAt()
+			if err := tx.Create(post).Error; err != nil {
+				return err
+			}
+		} else {
+			post.PublishedAt = stored.PublishedAt
+			post.SyncPublishedAt()
+			err = tx.Model(post).Updates(map[string]interface{}{
+				"title":        post.Title,
+				"body":         post.Body,
+				"is_published": post.IsPublished,
+				"published_at": post.PublishedAt,
+				"category_id":  post.CategoryId,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		if err := tx.Delete(&PostTag{}, "post_id = ?", post.ID).Error; err != nil {
+			return err
+		}
+		for _, tagId := range tagIds {
+			if err := tx.Create(&PostTag{PostId: post.ID, TagId: tagId}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func uniqueIds(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
 func (post *Post) UpdateView() error {
 	return DB.Model(post).Updates(map[string]interface{}{
 		"view": post.View,
@@ -66,54 +166,50 @@ func (post *Post) Excerpt() template.HTML {
 	return excerpt
 }
 
-func ListPublishedPost(tag string, pageIndex, pageSize int) ([]*Post, error) {
-	return _listPost(tag, true, pageIndex, pageSize)
+// pagination为nil时返回全部
+func ListPublishedPost(tag string, pagination *Pagination) ([]*Post, error) {
+	return _listPost(tag, true, pagination)
 }
 
-func ListAllPost(tag string) ([]*Post, error) {
-	return _listPost(tag, false, 0, 0)
+func ListAllPost(tag string, pagination *Pagination) ([]*Post, error) {
+	return _listPost(tag, false, pagination)
 }
 
-func _listPost(tag string, published bool, pageIndex, pageSize int) ([]*Post, error) {
-	var posts []*Post
-	var err error
+func _listPost(tag string, published bool, pagination *Pagination) ([]*Post, error) {
+	db := DB.Model(&Post{}).Select("posts.*")
 	if len(tag) > 0 {
 		tagId, err := ParseIdToUint(tag, "_listPost")
 		if err != nil {
 			return nil, err
 		}
-		var rows *sql.Rows
-		if published {
-			if pageIndex > 0 {
-				rows, err = DB.Raw("select p.* from posts p inner join post_tags pt on p.id = pt.post_id where pt.tag_id = ? and p.is_published = ? order by created_at desc limit ? offset ?", tagId, true, pageSize, (pageIndex-1)*pageSize).Rows()
-			} else {
-				rows, err = DB.Raw("select p.* from posts p inner join post_tags pt on p.id = pt.post_id where pt.tag_id = ? and p.is_published = ? order by created_at desc", tagId, true).Rows()
-			}
-		} else {
-			rows, err = DB.Raw("select p.* from posts p inner join post_tags pt on p.id = pt.post_id where pt.tag_id = ? order by created_at desc", tagId).Rows()
-		}
-		if err != nil {
-			seelog.Error("[_listPost]db raw err", err)
-			return nil, err
-		}
-		defer rows.Close()
-		for rows.Next() {
-			var post Post
-			DB.ScanRows(rows, &post)
-			posts = append(posts, &post)
-		}
-	} else {
-		if published {
-			if pageIndex > 0 {
-				err = DB.Where("is_published = ?", true).Order("created_at desc").Limit(pageSize).Offset((pageIndex - 1) * pageSize).Find(&posts).Error
-			} else {
-				err = DB.Where("is_published = ?", true).Order("created_at desc").Find(&posts).Error
-			}
-		} else {
-			err = DB.Order("created_at desc").Find(&posts).Error
-		}
+		db = db.Joins("inner join post_tags pt on posts.id = pt.post_id").Where("pt.tag_id = ?", tagId)
+	}
+	if published {
+		db = db.Where("posts.is_published = ?", true)
+	}
+	return findPosts(db, pagination)
+}
+
+// 按创建时间倒序查询文章，pagination不为nil时分页
+func findPosts(db *gorm.DB, pagination *Pagination) ([]*Post, error) {
+	var (
+		posts []*Post
+		err   error
+	)
+	if pagination == nil {
+		err = db.Order("posts.created_at desc").Find(&posts).Error
+		return posts, err
+	}
+	if db, err = pagination.paginate(db, "posts"); err != nil {
+		return nil, err
+	}
+	if err = db.Find(&posts).Error; err != nil {
+		return nil, err
 	}
-	return posts, err
+	posts = posts[:pagination.Fill(len(posts), func(i int) (time.Time, uint) {
+		return posts[i].CreatedAt, posts[i].ID
+	})]
+	return posts, nil
 }
 
 func MustListMaxReadPost() (posts []*Post) {
@@ -135,7 +231,7 @@ func ListMaxCommentPost() (posts []*Post, err error) {
 	var (
 		rows *sql.Rows
 	)
-	rows, err = DB.Raw("select p.*,c.total comment_total from posts p inner join (select post_id,count(*) total from comments group by post_id) c on p.id = c.post_id order by c.total desc limit 5").Rows()
+	rows, err = DB.Raw("select p.*,c.total as comment_total from posts p inner join (select post_id,count(*) as total from comments group by post_id) c on p.id = c.post_id order by c.total desc limit 5").Rows()
 	if err != nil {
 		seelog.Error("[ListMaxCommentPost]db raw err", err)
 		return
@@ -149,22 +245,6 @@ func ListMaxCommentPost() (posts []*Post, err error) {
 	return
 }
 
-func CountPostByTag(tag string) (count int, err error) {
-	var (
-		tagId uint64
-	)
-	if len(tag) > 0 {
-		tagId, err = ParseIdToUint(tag, "CountPostByTag")
-		if err != nil {
-			return
-		}
-		err = DB.Raw("select count(*) from posts p inner join post_tags pt on p.id = pt.post_id where pt.tag_id = ? and p.is_published = ?", tagId, true).Row().Scan(&count)
-	} else {
-		err = DB.Raw("select count(*) from posts p where p.is_published = ?", true).Row().Scan(&count)
-	}
-	return
-}
-
 func CountPost() int {
 	var count int
 	DB.Model(&Post{}).Count(&count)
@@ -188,8 +268,7 @@ func MustListPostArchives() []*QrArchive {
 
 func ListPostArchives() ([]*QrArchive, error) {
 	var archives []*QrArchive
-	//querysql := `select DATE_FORMAT(created_at,'%Y-%m') as month,count(*) as total from posts where is_published = ? group by month order by month desc`
-	querysql := `select strftime('%Y-%m',created_at) as month,count(*) as total from posts where is_published = ? group by month order by month desc`
+	querysql := `select ` + monthExpr("created_at") + ` as month,count(*) as total from posts where is_published = ? group by month order by month desc`
 	rows, err := DB.Raw(querysql, true).Rows()
 	if err != nil {
 		seelog.Error("[ListPostArchives]db raw err", err)
@@ -209,26 +288,24 @@ func ListPostArchives() ([]*QrArchive, error) {
 	return archives, nil
 }
 
-func ListPostByArchive(year, month string, pageIndex, pageSize int) ([]*Post, error) {
-	var (
-		rows *sql.Rows
-		err  error
-	)
+func ListPostByArchive(year, month string, pagination *Pagination) ([]*Post, error) {
 	if len(month) == 1 {
 		month = "0" + month
 	}
 	condition := fmt.Sprintf("%s-%s", year, month)
-	if pageIndex > 0 {
-		//querysql := `select * from posts where date_format(created_at,'%Y-%m') = ? and is_published = ? order by created_at desc limit ? offset ?`
-		querysql := `select * from posts where strftime('%Y-%m',created_at) = ? and is_published = ? order by created_at desc limit ? offset ?`
-		rows, err = DB.Raw(querysql, condition, true, pageSize, (pageIndex-1)*pageSize).Rows()
-	} else {
-		//querysql := `select * from posts where date_format(created_at,'%Y-%m') = ? and is_published = ? order by created_at desc`
-		querysql := `select * from posts where strftime('%Y-%m',created_at) = ? and is_published = ? order by created_at desc`
-		rows, err = DB.Raw(querysql, condition, true).Rows()
-	}
+	db := DB.Model(&Post{}).Where(monthExpr("posts.created_at")+" = ? and posts.is_published = ?", condition, true)
+	return findPosts(db, pagination)
+}
+
+// 获取指定时间之后发布、且符合订阅者标签偏好的文章，按发布时间而不是创建时间筛选，先写草稿后发布的文章也会包含在内
+func ListPublishedPostSinceBySubscriber(since time.Time, subscriberId uint) ([]*Post, error) {
+	querysql := `select p.* from posts p where p.is_published = ? and p.published_at > ?
+		and (not exists (select 1 from subscriber_tags st where st.subscriber_id = ?)
+		or exists (select 1 from subscriber_tags st inner join post_tags pt on st.tag_id = pt.tag_id where st.subscriber_id = ? and pt.post_id = p.id))
+		order by p.published_at desc`
+	rows, err := DB.Raw(querysql, true, since, subscriberId, subscriberId).Rows()
 	if err != nil {
-		seelog.Error("[ListPostByArchive]db raw err", err)
+		seelog.Error("[ListPublishedPostSinceBySubscriber]db raw err", err)
 		return nil, err
 	}
 	defer rows.Close()
@@ -240,14 +317,3 @@ func ListPostByArchive(year, month string, pageIndex, pageSize int) ([]*Post, er
 	}
 	return posts, nil
 }
-
-func CountPostByArchive(year, month string) (count int, err error) {
-	if len(month) == 1 {
-		month = "0" + month
-	}
-	condition := fmt.Sprintf("%s-%s", year, month)
-	//querysql := `select count(*) from posts where date_format(created_at,'%Y-%m') = ? and is_published = ? order by created_at desc`
-	querysql := `select count(*) from posts where strftime('%Y-%m',created_at) = ? and is_published = ?`
-	err = DB.Raw(querysql, condition, true).Row().Scan(&count)
-	return
-}
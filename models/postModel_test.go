@@ -0,0 +1,207 @@
+package models_test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"blog/models"
+	"blog/models/testdb"
+)
+
+// 按指定的创建时间新建文章
+func createPost(t *testing.T, title string, published bool, createdAt time.Time, tagIds ...uint) *models.Post {
+	t.Helper()
+	post := &models.Post{Title: title, Body: title, IsPublished: published}
+	post.CreatedAt = createdAt
+	if err := models.SavePost(post, tagIds, nil); err != nil {
+		t.Fatal(err)
+	}
+	return post
+}
+
+func createTag(t *testing.T, name string) *models.Tag {
+	t.Helper()
+	tag := &models.Tag{Name: name}
+	if err := tag.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	return tag
+}
+
+func postTitles(posts []*models.Post) []string {
+	titles := make([]string, len(posts))
+	for i, post := range posts {
+		titles[i] = post.Title
+	}
+	return titles
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// 按月归档使用各数据库的日期格式化函数
+func TestListPostArchives(t *testing.T) {
+	testdb.Open(t)
+	createPost(t, "jan-1", true, time.Date(2020, 1, 15, 12, 0, 0, 0, time.UTC))
+	createPost(t, "jan-2", true, time.Date(2020, 1, 20, 12, 0, 0, 0, time.UTC))
+	createPost(t, "feb-draft", false, time.Date(2020, 2, 10, 12, 0, 0, 0, time.UTC))
+	createPost(t, "mar", true, time.Date(2020, 3, 2, 12, 0, 0, 0, time.UTC))
+
+	archives, err := models.ListPostArchives()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ year, month, total int }{{2020, 3, 1}, {2020, 1, 2}}
+	if len(archives) != len(want) {
+		t.Fatalf("got %d archives, want %d", len(archives), len(want))
+	}
+	for i, archive := range archives {
+		if archive.Year != want[i].year || archive.Month != want[i].month || archive.Total != want[i].total {
+			t.Errorf("archive %d = %d-%d (%d), want %d-%d (%d)", i,
+				archive.Year, archive.Month, archive.Total, want[i].year, want[i].month, want[i].total)
+		}
+	}
+
+	posts, err := models.ListPostByArchive("2020", "1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if titles := postTitles(posts); !equalStrings(titles, []string{"jan-2", "jan-1"}) {
+		t.Errorf("posts of 2020-01 = %v", titles)
+	}
+	pagination := &models.Pagination{Page: 1, PageSize: 1}
+	posts, err = models.ListPostByArchive("2020", "01", pagination)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if titles := postTitles(posts); !equalStrings(titles, []string{"jan-2"}) || pagination.Total != 2 {
+		t.Errorf("first page of 2020-01 = %v, total %d", titles, pagination.Total)
+	}
+	pagination = &models.Pagination{Page: 1, PageSize: 1, Cursor: pagination.NextCursor}
+	posts, err = models.ListPostByArchive("2020", "01", pagination)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if titles := postTitles(posts); !equalStrings(titles, []string{"jan-1"}) || pagination.NextCursor != "" {
+		t.Errorf("page after cursor = %v, next cursor %q", titles, pagination.NextCursor)
+	}
+}
+
+// 摘要按发布时间筛选，先写草稿后发布的文章也包含在内
+func TestListPublishedPostSinceBySubscriber(t *testing.T) {
+	testdb.Open(t)
+	golang := createTag(t, "go")
+	rust := createTag(t, "rust")
+	now := time.Now()
+
+	old := &models.Post{Title: "old", IsPublished: true}
+	old.CreatedAt = now.Add(-72 * time.Hour)
+	publishedAt := now.Add(-48 * time.Hour)
+	old.PublishedAt = &publishedAt
+	if err := old.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	draft := createPost(t, "draft", false, now.Add(-72*time.Hour), golang.ID)
+	draft.IsPublished = true
+	if err := models.SavePost(draft, []uint{golang.ID}, nil); err != nil {
+		t.Fatal(err)
+	}
+	createPost(t, "rust", true, now.Add(-time.Minute), rust.ID)
+	createPost(t, "unpublished", false, now.Add(-time.Minute), golang.ID)
+
+	all := &models.Subscriber{Email: "all@example.com"}
+	if err := all.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	gopher := &models.Subscriber{Email: "gopher@example.com"}
+	if err := gopher.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.SetSubscriberTags(gopher.ID, []uint{golang.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	since := now.Add(-24 * time.Hour)
+	posts, err := models.ListPublishedPostSinceBySubscriber(since, all.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	titles := postTitles(posts)
+	sort.Strings(titles)
+	if !equalStrings(titles, []string{"draft", "rust"}) {
+		t.Errorf("posts for subscriber without tags = %v, want [draft rust]", titles)
+	}
+	posts, err = models.ListPublishedPostSinceBySubscriber(since, gopher.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if titles := postTitles(posts); !equalStrings(titles, []string{"draft"}) {
+		t.Errorf("posts for subscriber of go = %v, want [draft]", titles)
+	}
+}
+
+// MySQL对内容未变的更新返回RowsAffected为0，不能被当作文章不存在
+func TestSavePostUnchanged(t *testing.T) {
+	testdb.Open(t)
+	tag := createTag(t, "go")
+	post := createPost(t, "unchanged", true, time.Now(), tag.ID)
+	if err := models.SavePost(post, []uint{tag.ID}, nil); err != nil {
+		t.Fatalf("saving an unchanged post: %v", err)
+	}
+
+	missing := &models.Post{Title: "missing"}
+	missing.ID = post.ID + 100
+	if err := models.SavePost(missing, nil, nil); err != gorm.ErrRecordNotFound {
+		t.Fatalf("saving a missing post = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+}
+
+// mysql和postgres上正文、页面和评论不能被限制为varchar(255)
+func TestLongText(t *testing.T) {
+	db := testdb.Open(t)
+	body := strings.Repeat("长文本 long text ", 1000)
+	post := createPost(t, "long", true, time.Now())
+	post.Body = body
+	if err := models.SavePost(post, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	page := &models.Page{Title: "long", Body: body}
+	if err := page.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	comment := &models.Comment{PostID: post.ID, Content: body}
+	if err := comment.Insert(); err != nil {
+		t.Fatal(err)
+	}
+
+	var storedPost models.Post
+	var storedPage models.Page
+	var storedComment models.Comment
+	for _, err := range []error{
+		db.First(&storedPost, post.ID).Error,
+		db.First(&storedPage, page.ID).Error,
+		db.First(&storedComment, comment.ID).Error,
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, value := range map[string]string{"post": storedPost.Body, "page": storedPage.Body, "comment": storedComment.Content} {
+		if value != body {
+			t.Errorf("%s stored %d bytes, want %d", name, len(value), len(body))
+		}
+	}
+}
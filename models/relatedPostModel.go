@@ -0,0 +1,41 @@
+package models
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+// table related_posts, 预先计算的相关文章，由related包在文章变化后重新生成
+type RelatedPost struct {
+	BaseModel
+	PostId    uint
+	RelatedId uint    // 相关文章id
+	Score     float64 // 相似度，越大越相关
+}
+
+// ReplaceRelatedPosts 在一个事务中用related替换全部相关文章
+func ReplaceRelatedPosts(related []*RelatedPost) error {
+	return Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&RelatedPost{}).Error; err != nil {
+			return err
+		}
+		for _, r := range related {
+			if err := tx.Create(r).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// 删除文章时同时删除以它为来源或结果的相关文章
+func DeleteRelatedPostByPostId(postId uint) error {
+	return DB.Delete(&RelatedPost{}, "post_id = ? or related_id = ?", postId, postId).Error
+}
+
+// 文章的相关文章，按相似度倒序，只返回已发布的文章
+func ListRelatedPost(postId uint) ([]*Post, error) {
+	var posts []*Post
+	err := DB.Model(&Post{}).Select("posts.*").Joins("inner join related_posts rp on posts.id = rp.related_id").
+		Where("rp.post_id = ? and posts.is_published = ?", postId, true).Order("rp.score desc").Find(&posts).Error
+	return posts, err
+}
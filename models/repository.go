@@ -0,0 +1,664 @@
+package models
+
+import (
+	"strconv"
+	"time"
+)
+
+// 文章
+type PostRepository interface {
+	Insert(post *Post) error
+	Update(post *Post) error
+	UpdateView(post *Post) error
+	// 删除文章及其标签、系列和相关文章关联
+	Delete(id uint) error
+	GetById(id string) (*Post, error)
+	// tag为标签id，为空时不限标签；pagination为nil时不分页
+	ListPublished(tag string, pagination *Pagination) ([]*Post, error)
+	// 包括未发布的文章
+	ListAll(tag string, pagination *Pagination) ([]*Post, error)
+	Count() int
+	ListMaxRead() ([]*Post, error)
+	ListMaxComment() ([]*Post, error)
+	ListArchives() ([]*QrArchive, error)
+	ListByArchive(year, month string, pagination *Pagination) ([]*Post, error)
+	// 已发布的属于categoryIds中任一分类的文章
+	ListByCategory(categoryIds []uint, pagination *Pagination) ([]*Post, error)
+	// 预先计算的相关文章，按相似度倒序，只包括已发布的文章
+	ListRelated(postId uint) ([]*Post, error)
+	// 在一个事务中新建(post.ID为0)或更新文章，并用tagIds替换其全部标签；标签不存在时返回ErrTagNotFound，
+	// post.CategoryId指向的分类不存在时返回ErrCategoryNotFound。
+	// tagNames中的标签按名称查找，不存在时创建
+	Save(post *Post, tagIds []uint, tagNames []string) error
+	// since之后发布、且订阅者关注了其任一标签的文章，订阅者未关注标签时不限标签；按发布时间倒序
+	ListPublishedSinceBySubscriber(since time.Time, subscriberId uint) ([]*Post, error)
+	// 正文中包含各地址的文章，按地址分组，只包含id、标题和发布状态
+	ListByMediaUrls(urls []string) (map[string][]*Post, error)
+}
+
+// 页面
+type PageRepository interface {
+	Insert(page *Page) error
+	Update(page *Page) error
+	UpdateView(page *Page) error
+	Delete(id uint) error
+	GetById(id string) (*Page, error)
+	ListAll() ([]*Page, error)
+	ListPublished() ([]*Page, error)
+	Count() int
+}
+
+// 标签
+type TagRepository interface {
+	Insert(tag *Tag) error
+	// 名称与其他标签重复时返回ErrTagNameExists
+	Update(tag *Tag) error
+	// 删除标签及其与文章、订阅者的关联
+	Delete(id uint) error
+	// 将sourceId合并到targetId后删除sourceId
+	Merge(sourceId, targetId uint) error
+	GetById(id uint) (*Tag, error)
+	// 已发布文章使用的标签及文章数
+	ListPublished() ([]*Tag, error)
+	// 全部标签及关联的文章数
+	ListAll() ([]*Tag, error)
+	ListByPostId(postId uint) ([]*Tag, error)
+	// 批量查询多篇文章的标签，避免列表页逐篇查询
+	ListByPostIds(postIds []uint) (map[uint][]*Tag, error)
+	Count() int
+}
+
+// 分类
+type CategoryRepository interface {
+	// 别名重复时返回ErrCategorySlugExists，上级分类不存在时返回ErrCategoryNotFound
+	Insert(category *Category) error
+	// 移动到自身或子分类之下时返回ErrCategoryCycle
+	Update(category *Category) error
+	// 有子分类时返回ErrCategoryHasChildren，分类下的文章改为属于上级分类
+	Delete(id uint) error
+	GetById(id uint) (*Category, error)
+	// 全部分类按树的先序排列，包含已发布文章数，Path、Depth和Total已计算
+	ListAll() ([]*Category, error)
+	Count() int
+}
+
+// 系列
+type SeriesRepository interface {
+	// 新建(series.ID为0)或更新系列，并按postIds的顺序替换其文章；别名重复时返回ErrSeriesSlugExists，文章不存在时返回ErrPostNotFound
+	Save(series *Series, postIds []uint) error
+	// 删除系列，其中的文章不受影响
+	Delete(id uint) error
+	GetById(id uint) (*Series, error)
+	GetBySlug(slug string) (*Series, error)
+	// 文章所属的系列，不属于任何系列时返回gorm.ErrRecordNotFound
+	GetByPostId(postId uint) (*Series, error)
+	// 全部系列及包含的文章数
+	ListAll() ([]*Series, error)
+	// 系列中按顺序排列的文章，published为true时只返回已发布的文章
+	ListPosts(seriesId uint, published bool) ([]*Post, error)
+}
+
+// 评论
+type CommentRepository interface {
+	Insert(comment *Comment) error
+	// 只能删除userId自己的评论
+	Delete(id, userId uint) error
+	MarkRead(id uint) error
+	MarkAllRead() error
+	// 按时间倒序，包含评论者的昵称和头像
+	ListByPostId(postId uint) ([]*Comment, error)
+	ListUnread() ([]*Comment, error)
+	// 批量统计多篇文章的评论数
+	CountByPostIds(postIds []uint) (map[uint]int, error)
+	Count() int
+}
+
+// 友情链接
+type LinkRepository interface {
+	// 地址已存在时返回已有的链接
+	Insert(link *Link) error
+	Update(link *Link) error
+	UpdateView(link *Link) error
+	Delete(id uint) error
+	GetById(id uint) (*Link, error)
+	// 按sort升序
+	ListAll() ([]*Link, error)
+}
+
+// 用户
+type UserRepository interface {
+	// 邮箱已注册时返回错误
+	Insert(user *User) error
+	GetById(id uint) (*User, error)
+	GetByUsername(username string) (*User, error)
+	GetByGithubId(githubId string) (*User, error)
+	// 按user.GithubLoginId查找，不存在时创建
+	FirstOrCreateByGithub(user *User) error
+	// 保存头像和昵称
+	UpdateProfile(user *User) error
+	// 保存邮箱，为空时解绑
+	UpdateEmail(user *User) error
+	// 保存github账号、头像和主页，GithubLoginId为空时解绑
+	UpdateGithubUserInfo(user *User) error
+	// 保存锁定状态
+	Lock(user *User) error
+	// 非管理员用户
+	ListNonAdmin() ([]*User, error)
+}
+
+// 订阅者
+type SubscriberRepository interface {
+	// 邮箱已存在时返回已有的订阅者
+	Insert(subscriber *Subscriber) error
+	// 保存激活、订阅状态、签名和推送频率
+	Update(subscriber *Subscriber) error
+	// 记录退信eventId并保存退信次数和订阅状态，已记录过时返回ErrBounceRecorded
+	UpdateBounce(subscriber *Subscriber, eventId string) error
+	UpdateLastDigest(subscriber *Subscriber) error
+	GetById(id uint) (*Subscriber, error)
+	GetByEmail(email string) (*Subscriber, error)
+	GetBySignature(signature string) (*Subscriber, error)
+	// state为空时返回全部，pagination为nil时不分页
+	ListByState(state string, pagination *Pagination) ([]*Subscriber, error)
+	// 指定推送频率的有效订阅者
+	ListByFrequency(frequency string) ([]*Subscriber, error)
+	// 应收到该文章通知的有效订阅者：未关注标签，或关注了文章的任一标签
+	ListByPost(frequency string, postId uint) ([]*Subscriber, error)
+	// 已激活且订阅中的人数
+	Count() int
+	// 用tagIds替换订阅者关注的标签，为空时表示接收所有文章；标签不存在时返回ErrTagNotFound
+	SetTags(subscriberId uint, tagIds []uint) error
+	ListTags(subscriberId uint) ([]*Tag, error)
+}
+
+// 上传的文件
+type MediaRepository interface {
+	// 同一存储中标识相同时返回已有的记录
+	Insert(media *Media) error
+	InsertVariant(variant *MediaVariant) error
+	// 删除文件记录及其衍生文件记录，不删除存储中的文件
+	Delete(id uint) error
+	GetById(id uint) (*Media, error)
+	// 相同内容已上传到同一存储时返回该文件
+	GetByHash(driver, hash string) (*Media, error)
+	// 按文件名或地址搜索，keyword为空时返回全部，pagination为nil时不分页
+	List(keyword string, pagination *Pagination) ([]*Media, error)
+	// 按宽度倒序
+	ListVariants(mediaId uint) ([]*MediaVariant, error)
+	// 多个文件的衍生文件，按文件id分组，各组按宽度倒序
+	ListVariantsByMediaIds(mediaIds []uint) (map[uint][]*MediaVariant, error)
+	// 按地址查询，同时加载衍生文件
+	ListByUrls(urls []string) ([]*Media, error)
+	// 用户已上传文件的总大小，包括衍生文件
+	SumSizeByUserId(userId uint) (int64, error)
+}
+
+// 备份记录
+type BackupRepository interface {
+	// 按id倒序
+	ListAll() ([]*Backup, error)
+}
+
+// 控制器使用的全部数据访问接口
+type Repositories struct {
+	Posts       PostRepository
+	Pages       PageRepository
+	Tags        TagRepository
+	Categories  CategoryRepository
+	Series      SeriesRepository
+	Comments    CommentRepository
+	Links       LinkRepository
+	Users       UserRepository
+	Subscribers SubscriberRepository
+	Media       MediaRepository
+	Backups     BackupRepository
+}
+
+// 基于gorm的实现，每次调用时使用当前的DB，恢复备份重新打开数据库后依然有效
+func NewGormRepositories() *Repositories {
+	return &Repositories{
+		Posts:       gormPostRepository{},
+		Pages:       gormPageRepository{},
+		Tags:        gormTagRepository{},
+		Categories:  gormCategoryRepository{},
+		Series:      gormSeriesRepository{},
+		Comments:    gormCommentRepository{},
+		Links:       gormLinkRepository{},
+		Users:       gormUserRepository{},
+		Subscribers: gormSubscriberRepository{},
+		Media:       gormMediaRepository{},
+		Backups:     gormBackupRepository{},
+	}
+}
+
+type gormPostRepository struct{}
+
+func (gormPostRepository) Insert(post *Post) error {
+	return post.Insert()
+}
+
+func (gormPostRepository) Update(post *Post) error {
+	return post.Update()
+}
+
+func (gormPostRepository) UpdateView(post *Post) error {
+	return post.UpdateView()
+}
+
+func (gormPostRepository) Delete(id uint) error {
+	post := &Post{}
+	post.ID = id
+	if err := post.Delete(); err != nil {
+		return err
+	}
+	if err := DeletePostTagByPostId(id); err != nil {
+		return err
+	}
+	if err := DeleteSeriesPostByPostId(id); err != nil {
+		return err
+	}
+	return DeleteRelatedPostByPostId(id)
+}
+
+func (gormPostRepository) GetById(id string) (*Post, error) {
+	return GetPostById(id)
+}
+
+func (gormPostRepository) ListPublished(tag string, pagination *Pagination) ([]*Post, error) {
+	return ListPublishedPost(tag, pagination)
+}
+
+func (gormPostRepository) ListAll(tag string, pagination *Pagination) ([]*Post, error) {
+	return ListAllPost(tag, pagination)
+}
+
+func (gormPostRepository) Count() int {
+	return CountPost()
+}
+
+func (gormPostRepository) ListMaxRead() ([]*Post, error) {
+	return ListMaxReadPost()
+}
+
+func (gormPostRepository) ListMaxComment() ([]*Post, error) {
+	return ListMaxCommentPost()
+}
+
+func (gormPostRepository) ListArchives() ([]*QrArchive, error) {
+	return ListPostArchives()
+}
+
+func (gormPostRepository) ListByArchive(year, month string, pagination *Pagination) ([]*Post, error) {
+	return ListPostByArchive(year, month, pagination)
+}
+
+func (gormPostRepository) ListByCategory(categoryIds []uint, pagination *Pagination) ([]*Post, error) {
+	return ListPostByCategory(categoryIds, pagination)
+}
+
+func (gormPostRepository) ListRelated(postId uint) ([]*Post, error) {
+	return ListRelatedPost(postId)
+}
+
+func (gormPostRepository) Save(post *Post, tagIds []uint, tagNames []string) error {
+	return SavePost(post, tagIds, tagNames)
+}
+
+func (gormPostRepository) ListPublishedSinceBySubscriber(since time.Time, subscriberId uint) ([]*Post, error) {
+	return ListPublishedPostSinceBySubscriber(since, subscriberId)
+}
+
+func (gormPostRepository) ListByMediaUrls(urls []string) (map[string][]*Post, error) {
+	return ListPostByMediaUrls(urls)
+}
+
+type gormPageRepository struct{}
+
+func (gormPageRepository) Insert(page *Page) error {
+	return page.Insert()
+}
+
+func (gormPageRepository) Update(page *Page) error {
+	return page.Update()
+}
+
+func (gormPageRepository) UpdateView(page *Page) error {
+	return page.UpdateView()
+}
+
+func (gormPageRepository) Delete(id uint) error {
+	page := &Page{}
+	page.ID = id
+	return page.Delete()
+}
+
+func (gormPageRepository) GetById(id string) (*Page, error) {
+	return GetPageById(id)
+}
+
+func (gormPageRepository) ListAll() ([]*Page, error) {
+	return ListAllPage()
+}
+
+func (gormPageRepository) ListPublished() ([]*Page, error) {
+	return ListPublishedPage()
+}
+
+func (gormPageRepository) Count() int {
+	return CountPage()
+}
+
+type gormTagRepository struct{}
+
+func (gormTagRepository) Insert(tag *Tag) error {
+	return tag.Insert()
+}
+
+func (gormTagRepository) Update(tag *Tag) error {
+	return tag.Update()
+}
+
+func (gormTagRepository) Delete(id uint) error {
+	return DeleteTag(id)
+}
+
+func (gormTagRepository) Merge(sourceId, targetId uint) error {
+	return MergeTag(sourceId, targetId)
+}
+
+func (gormTagRepository) GetById(id uint) (*Tag, error) {
+	return GetTagById(id)
+}
+
+func (gormTagRepository) ListPublished() ([]*Tag, error) {
+	return ListTag()
+}
+
+func (gormTagRepository) ListAll() ([]*Tag, error) {
+	return ListAllTag()
+}
+
+func (gormTagRepository) ListByPostId(postId uint) ([]*Tag, error) {
+	return ListTagByPostId(strconv.FormatUint(uint64(postId), 10))
+}
+
+func (gormTagRepository) ListByPostIds(postIds []uint) (map[uint][]*Tag, error) {
+	return ListTagByPostIds(postIds)
+}
+
+func (gormTagRepository) Count() int {
+	return CountTag()
+}
+
+type gormCategoryRepository struct{}
+
+func (gormCategoryRepository) Insert(category *Category) error {
+	return category.Insert()
+}
+
+func (gormCategoryRepository) Update(category *Category) error {
+	return category.Update()
+}
+
+func (gormCategoryRepository) Delete(id uint) error {
+	return DeleteCategory(id)
+}
+
+func (gormCategoryRepository) GetById(id uint) (*Category, error) {
+	return GetCategoryById(id)
+}
+
+func (gormCategoryRepository) ListAll() ([]*Category, error) {
+	return ListAllCategory()
+}
+
+func (gormCategoryRepository) Count() int {
+	return CountCategory()
+}
+
+type gormSeriesRepository struct{}
+
+func (gormSeriesRepository) Save(series *Series, postIds []uint) error {
+	return SaveSeries(series, postIds)
+}
+
+func (gormSeriesRepository) Delete(id uint) error {
+	return DeleteSeries(id)
+}
+
+func (gormSeriesRepository) GetById(id uint) (*Series, error) {
+	return GetSeriesById(id)
+}
+
+func (gormSeriesRepository) GetBySlug(slug string) (*Series, error) {
+	return GetSeriesBySlug(slug)
+}
+
+func (gormSeriesRepository) GetByPostId(postId uint) (*Series, error) {
+	return GetSeriesByPostId(postId)
+}
+
+func (gormSeriesRepository) ListAll() ([]*Series, error) {
+	return ListAllSeries()
+}
+
+func (gormSeriesRepository) ListPosts(seriesId uint, published bool) ([]*Post, error) {
+	return ListPostBySeries(seriesId, published)
+}
+
+type gormCommentRepository struct{}
+
+func (gormCommentRepository) Insert(comment *Comment) error {
+	return comment.Insert()
+}
+
+func (gormCommentRepository) Delete(id, userId uint) error {
+	comment := &Comment{UserID: userId}
+	comment.ID = id
+	return comment.Delete()
+}
+
+func (gormCommentRepository) MarkRead(id uint) error {
+	comment := &Comment{}
+	comment.ID = id
+	return comment.Update()
+}
+
+func (gormCommentRepository) MarkAllRead() error {
+	return SetAllCommentRead()
+}
+
+func (gormCommentRepository) ListByPostId(postId uint) ([]*Comment, error) {
+	return ListCommentByPostID(strconv.FormatUint(uint64(postId), 10))
+}
+
+func (gormCommentRepository) ListUnread() ([]*Comment, error) {
+	return ListUnreadComment()
+}
+
+func (gormCommentRepository) CountByPostIds(postIds []uint) (map[uint]int, error) {
+	return CountCommentByPostIds(postIds)
+}
+
+func (gormCommentRepository) Count() int {
+	return CountComment()
+}
+
+type gormLinkRepository struct{}
+
+func (gormLinkRepository) Insert(link *Link) error {
+	return link.Insert()
+}
+
+func (gormLinkRepository) Update(link *Link) error {
+	return link.Update()
+}
+
+func (gormLinkRepository) UpdateView(link *Link) error {
+	return link.UpdateView()
+}
+
+func (gormLinkRepository) Delete(id uint) error {
+	link := &Link{}
+	link.ID = id
+	return link.Delete()
+}
+
+func (gormLinkRepository) GetById(id uint) (*Link, error) {
+	return GetLinkById(id)
+}
+
+func (gormLinkRepository) ListAll() ([]*Link, error) {
+	return ListLinks()
+}
+
+type gormUserRepository struct{}
+
+func (gormUserRepository) Insert(user *User) error {
+	return user.Insert()
+}
+
+func (gormUserRepository) GetById(id uint) (*User, error) {
+	return GetUser(id)
+}
+
+func (gormUserRepository) GetByUsername(username string) (*User, error) {
+	return GetUserByUsername(username)
+}
+
+func (gormUserRepository) GetByGithubId(githubId string) (*User, error) {
+	return GetUserByGithubId(githubId)
+}
+
+func (gormUserRepository) FirstOrCreateByGithub(user *User) error {
+	_, err := user.FirstOrCreate()
+	return err
+}
+
+func (gormUserRepository) UpdateProfile(user *User) error {
+	return user.UpdateProfile(user.AvatarUrl, user.NickName)
+}
+
+func (gormUserRepository) UpdateEmail(user *User) error {
+	return user.UpdateEmail(user.Email)
+}
+
+func (gormUserRepository) UpdateGithubUserInfo(user *User) error {
+	return user.UpdateGithubUserInfo()
+}
+
+func (gormUserRepository) Lock(user *User) error {
+	return user.Lock()
+}
+
+func (gormUserRepository) ListNonAdmin() ([]*User, error) {
+	return ListUsers()
+}
+
+type gormSubscriberRepository struct{}
+
+func (gormSubscriberRepository) Insert(subscriber *Subscriber) error {
+	return subscriber.Insert()
+}
+
+func (gormSubscriberRepository) Update(subscriber *Subscriber) error {
+	return subscriber.Update()
+}
+
+func (gormSubscriberRepository) UpdateBounce(subscriber *Subscriber, eventId string) error {
+	return subscriber.UpdateBounce(eventId)
+}
+
+func (gormSubscriberRepository) UpdateLastDigest(subscriber *Subscriber) error {
+	return subscriber.UpdateLastDigest()
+}
+
+func (gormSubscriberRepository) GetById(id uint) (*Subscriber, error) {
+	return GetSubscriberById(id)
+}
+
+func (gormSubscriberRepository) GetByEmail(email string) (*Subscriber, error) {
+	return GetSubscriberByEmail(email)
+}
+
+func (gormSubscriberRepository) GetBySignature(signature string) (*Subscriber, error) {
+	return GetSubscriberBySignature(signature)
+}
+
+func (gormSubscriberRepository) ListByState(state string, pagination *Pagination) ([]*Subscriber, error) {
+	return ListSubscriberByState(state, pagination)
+}
+
+func (gormSubscriberRepository) ListByFrequency(frequency string) ([]*Subscriber, error) {
+	return ListSubscriberByFrequency(frequency)
+}
+
+func (gormSubscriberRepository) ListByPost(frequency string, postId uint) ([]*Subscriber, error) {
+	return ListSubscriberByPost(frequency, postId)
+}
+
+func (gormSubscriberRepository) Count() int {
+	count, _ := CountSubscriber()
+	return count
+}
+
+func (gormSubscriberRepository) SetTags(subscriberId uint, tagIds []uint) error {
+	return SetSubscriberTags(subscriberId, tagIds)
+}
+
+func (gormSubscriberRepository) ListTags(subscriberId uint) ([]*Tag, error) {
+	return ListTagBySubscriberId(subscriberId)
+}
+
+type gormMediaRepository struct{}
+
+func (gormMediaRepository) Insert(media *Media) error {
+	return media.Insert()
+}
+
+func (gormMediaRepository) InsertVariant(variant *MediaVariant) error {
+	return variant.Insert()
+}
+
+func (gormMediaRepository) Delete(id uint) error {
+	if err := DeleteMediaVariantByMediaId(id); err != nil {
+		return err
+	}
+	media := &Media{}
+	media.ID = id
+	return media.Delete()
+}
+
+func (gormMediaRepository) GetById(id uint) (*Media, error) {
+	return GetMediaById(id)
+}
+
+func (gormMediaRepository) GetByHash(driver, hash string) (*Media, error) {
+	return GetMediaByHash(driver, hash)
+}
+
+func (gormMediaRepository) List(keyword string, pagination *Pagination) ([]*Media, error) {
+	return ListMedia(keyword, pagination)
+}
+
+func (gormMediaRepository) ListVariants(mediaId uint) ([]*MediaVariant, error) {
+	return ListMediaVariantByMediaId(mediaId)
+}
+
+func (gormMediaRepository) ListVariantsByMediaIds(mediaIds []uint) (map[uint][]*MediaVariant, error) {
+	return ListMediaVariantByMediaIds(mediaIds)
+}
+
+func (gormMediaRepository) ListByUrls(urls []string) ([]*Media, error) {
+	return ListMediaByUrls(urls)
+}
+
+func (gormMediaRepository) SumSizeByUserId(userId uint) (int64, error) {
+	return SumMediaSizeByUserId(userId)
+}
+
+type gormBackupRepository struct{}
+
+func (gormBackupRepository) ListAll() ([]*Backup, error) {
+	return ListBackup()
+}
@@ -0,0 +1,764 @@
+package models_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"blog/models"
+	"blog/models/memory"
+	"blog/models/testdb"
+)
+
+// 内存实现和gorm实现运行同一组检查，避免两者的行为不一致
+func TestRepositories(t *testing.T) {
+	implementations := []struct {
+		name string
+		open func(t *testing.T) *models.Repositories
+	}{
+		{"memory", func(t *testing.T) *models.Repositories {
+			return memory.NewRepositories(memory.NewStore())
+		}},
+		{"gorm", func(t *testing.T) *models.Repositories {
+			testdb.Open(t)
+			return models.NewGormRepositories()
+		}},
+	}
+	checks := []struct {
+		name string
+		run  func(t *testing.T, repos *models.Repositories)
+	}{
+		{"PostSave", testPostSave},
+		{"TagMerge", testTagMerge},
+		{"TagUpdate", testTagUpdate},
+		{"ListPublished", testListPublished},
+		{"CategoryTree", testCategoryTree},
+		{"SeriesSave", testSeriesSave},
+		{"Users", testUsers},
+		{"Links", testLinks},
+		{"Subscribers", testSubscribers},
+		{"Media", testMedia},
+	}
+	for _, implementation := range implementations {
+		for _, check := range checks {
+			t.Run(implementation.name+"/"+check.name, func(t *testing.T) {
+				check.run(t, implementation.open(t))
+			})
+		}
+	}
+}
+
+func insertTag(t *testing.T, repos *models.Repositories, name string) *models.Tag {
+	t.Helper()
+	tag := &models.Tag{Name: name}
+	if err := repos.Tags.Insert(tag); err != nil {
+		t.Fatal(err)
+	}
+	return tag
+}
+
+func savePost(t *testing.T, repos *models.Repositories, post *models.Post, tagIds ...uint) *models.Post {
+	t.Helper()
+	if err := repos.Posts.Save(post, tagIds, nil); err != nil {
+		t.Fatal(err)
+	}
+	return post
+}
+
+func insertCategory(t *testing.T, repos *models.Repositories, category *models.Category) *models.Category {
+	t.Helper()
+	if err := repos.Categories.Insert(category); err != nil {
+		t.Fatal(err)
+	}
+	return category
+}
+
+func postTagNames(t *testing.T, repos *models.Repositories, postId uint) []string {
+	t.Helper()
+	tags, err := repos.Tags.ListByPostId(postId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tagNames(tags)
+}
+
+func testPostSave(t *testing.T, repos *models.Repositories) {
+	tag := insertTag(t, repos, "go")
+	category := insertCategory(t, repos, &models.Category{Name: "Backend", Slug: "backend"})
+	post := savePost(t, repos, &models.Post{Title: "draft", Body: "body", CategoryId: category.ID}, tag.ID)
+	if post.ID == 0 || post.PublishedAt != nil {
+		t.Fatalf("saved draft has id %d and published_at %v", post.ID, post.PublishedAt)
+	}
+
+	if err := repos.Posts.Save(&models.Post{Title: "bad tag"}, []uint{tag.ID, 9999}, nil); err != models.ErrTagNotFound {
+		t.Errorf("saving with a missing tag = %v, want %v", err, models.ErrTagNotFound)
+	}
+	if err := repos.Posts.Save(&models.Post{Title: "bad category", CategoryId: 9999}, nil, nil); err != models.ErrCategoryNotFound {
+		t.Errorf("saving with a missing category = %v, want %v", err, models.ErrCategoryNotFound)
+	}
+	missing := &models.Post{Title: "missing"}
+	missing.ID = 9999
+	if err := repos.Posts.Save(missing, nil, nil); err != gorm.ErrRecordNotFound {
+		t.Errorf("saving a missing post = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+	if count := repos.Posts.Count(); count != 1 {
+		t.Errorf("failed saves left %d posts, want 1", count)
+	}
+
+	post.IsPublished = true
+	if err := repos.Posts.Save(post, []uint{tag.ID}, []string{"gorm", "go"}); err != nil {
+		t.Fatal(err)
+	}
+	if post.PublishedAt == nil {
+		t.Error("published_at was not set on publish")
+	}
+	if names := postTagNames(t, repos, post.ID); !equalStrings(names, []string{"go", "gorm"}) {
+		t.Errorf("tags = %v, want [go gorm]", names)
+	}
+	if count := repos.Tags.Count(); count != 2 {
+		t.Errorf("tag count = %d, want 2", count)
+	}
+	// 内容未变时再次保存
+	if err := repos.Posts.Save(post, []uint{tag.ID}, []string{"gorm"}); err != nil {
+		t.Errorf("saving an unchanged post: %v", err)
+	}
+	stored, err := repos.Posts.GetById(itoa(post.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.IsPublished || stored.CategoryId != category.ID || stored.PublishedAt == nil {
+		t.Errorf("stored post = published %v, category %d, published_at %v", stored.IsPublished, stored.CategoryId, stored.PublishedAt)
+	}
+}
+
+func testTagMerge(t *testing.T, repos *models.Repositories) {
+	source := insertTag(t, repos, "golang")
+	target := insertTag(t, repos, "go")
+	onlySource := savePost(t, repos, &models.Post{Title: "only-source", IsPublished: true}, source.ID)
+	both := savePost(t, repos, &models.Post{Title: "both", IsPublished: true}, source.ID, target.ID)
+
+	if err := repos.Tags.Merge(source.ID, target.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, post := range []*models.Post{onlySource, both} {
+		if names := postTagNames(t, repos, post.ID); !equalStrings(names, []string{"go"}) {
+			t.Errorf("tags of %s = %v, want [go]", post.Title, names)
+		}
+	}
+	if _, err := repos.Tags.GetById(source.ID); err != gorm.ErrRecordNotFound {
+		t.Errorf("getting the merged tag = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+	tags, err := repos.Tags.ListAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0].ID != target.ID || tags[0].Total != 2 {
+		t.Errorf("tags after merge = %v", tags)
+	}
+
+	if err = repos.Tags.Merge(source.ID, target.ID); err != models.ErrTagNotFound {
+		t.Errorf("merging a missing tag = %v, want %v", err, models.ErrTagNotFound)
+	}
+	if err = repos.Tags.Merge(target.ID, target.ID); err == nil {
+		t.Error("merging a tag into itself succeeded")
+	}
+}
+
+// 重命名为已有标签的名称会被拒绝，保留原名称
+func testTagUpdate(t *testing.T, repos *models.Repositories) {
+	golang := insertTag(t, repos, "golang")
+	insertTag(t, repos, "go")
+
+	if err := repos.Tags.Update(&models.Tag{BaseModel: golang.BaseModel, Name: "go"}); err != models.ErrTagNameExists {
+		t.Errorf("renaming to an existing name = %v, want %v", err, models.ErrTagNameExists)
+	}
+	if stored, _ := repos.Tags.GetById(golang.ID); stored.Name != "golang" {
+		t.Errorf("name after rejected rename = %s, want golang", stored.Name)
+	}
+	if err := repos.Tags.Update(&models.Tag{BaseModel: golang.BaseModel, Name: "golang", Description: "Go"}); err != nil {
+		t.Errorf("updating without renaming = %v", err)
+	}
+	if err := repos.Tags.Update(&models.Tag{BaseModel: golang.BaseModel, Name: "rust"}); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := repos.Tags.GetById(golang.ID); stored.Name != "rust" {
+		t.Errorf("name after rename = %s, want rust", stored.Name)
+	}
+}
+
+func testListPublished(t *testing.T, repos *models.Repositories) {
+	tag := insertTag(t, repos, "go")
+	base := time.Date(2021, 6, 1, 8, 0, 0, 0, time.UTC)
+	for i, title := range []string{"p0", "p1", "draft", "p3", "p4"} {
+		post := &models.Post{Title: title, IsPublished: title != "draft"}
+		post.CreatedAt = base.Add(time.Duration(i) * time.Hour)
+		var tagIds []uint
+		if i%2 == 0 {
+			tagIds = []uint{tag.ID}
+		}
+		savePost(t, repos, post, tagIds...)
+	}
+
+	pagination := &models.Pagination{Page: 1, PageSize: 2}
+	posts, err := repos.Posts.ListPublished("", pagination)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if titles := postTitles(posts); !equalStrings(titles, []string{"p4", "p3"}) || pagination.Total != 4 || !pagination.HasNext() {
+		t.Errorf("page 1 = %v, total %d, next cursor %q", titles, pagination.Total, pagination.NextCursor)
+	}
+	cursor := pagination.NextCursor
+
+	pagination = &models.Pagination{Page: 2, PageSize: 2}
+	if posts, err = repos.Posts.ListPublished("", pagination); err != nil {
+		t.Fatal(err)
+	}
+	if titles := postTitles(posts); !equalStrings(titles, []string{"p1", "p0"}) || pagination.HasNext() {
+		t.Errorf("page 2 = %v, next cursor %q", titles, pagination.NextCursor)
+	}
+
+	pagination = &models.Pagination{Page: 1, PageSize: 2, Cursor: cursor}
+	if posts, err = repos.Posts.ListPublished("", pagination); err != nil {
+		t.Fatal(err)
+	}
+	if titles := postTitles(posts); !equalStrings(titles, []string{"p1", "p0"}) || pagination.HasNext() {
+		t.Errorf("page after cursor = %v, next cursor %q", titles, pagination.NextCursor)
+	}
+
+	if _, err = repos.Posts.ListPublished("", &models.Pagination{Page: 1, PageSize: 2, Cursor: "bad"}); err != models.ErrInvalidCursor {
+		t.Errorf("listing with a bad cursor = %v, want %v", err, models.ErrInvalidCursor)
+	}
+	if posts, err = repos.Posts.ListPublished(itoa(tag.ID), nil); err != nil {
+		t.Fatal(err)
+	}
+	if titles := postTitles(posts); !equalStrings(titles, []string{"p4", "p0"}) {
+		t.Errorf("posts tagged go = %v, want [p4 p0]", titles)
+	}
+}
+
+func testCategoryTree(t *testing.T, repos *models.Repositories) {
+	backend := insertCategory(t, repos, &models.Category{Name: "Backend", Slug: "backend"})
+	golang := insertCategory(t, repos, &models.Category{Name: "Go", Slug: "go", ParentId: backend.ID})
+	gin := insertCategory(t, repos, &models.Category{Name: "Gin", Slug: "gin", ParentId: golang.ID})
+	frontend := insertCategory(t, repos, &models.Category{Name: "Frontend", Slug: "frontend", Sort: -1})
+	for _, post := range []*models.Post{
+		{Title: "go-1", IsPublished: true, CategoryId: golang.ID},
+		{Title: "go-2", IsPublished: true, CategoryId: golang.ID},
+		{Title: "gin", IsPublished: true, CategoryId: gin.ID},
+		{Title: "draft", CategoryId: backend.ID},
+		{Title: "css", IsPublished: true, CategoryId: frontend.ID},
+		{Title: "uncategorized", IsPublished: true},
+	} {
+		savePost(t, repos, post)
+	}
+
+	categories, err := repos.Categories.ListAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		slug         string
+		depth, count int
+		total        int
+		path         string
+	}{
+		{"frontend", 0, 1, 1, "/category/frontend"},
+		{"backend", 0, 0, 3, "/category/backend"},
+		{"go", 1, 2, 3, "/category/backend/go"},
+		{"gin", 2, 1, 1, "/category/backend/go/gin"},
+	}
+	if len(categories) != len(want) {
+		t.Fatalf("got %d categories, want %d", len(categories), len(want))
+	}
+	for i, category := range categories {
+		w := want[i]
+		if category.Slug != w.slug || category.Depth != w.depth || category.Count != w.count || category.Total != w.total || category.Path != w.path {
+			t.Errorf("category %d = %s depth %d count %d total %d path %s, want %+v", i,
+				category.Slug, category.Depth, category.Count, category.Total, category.Path, w)
+		}
+	}
+
+	if err = repos.Categories.Insert(&models.Category{Name: "Go", Slug: "go"}); err != models.ErrCategorySlugExists {
+		t.Errorf("inserting a duplicate slug = %v, want %v", err, models.ErrCategorySlugExists)
+	}
+	if err = repos.Categories.Insert(&models.Category{Name: "Orphan", Slug: "orphan", ParentId: 9999}); err != models.ErrCategoryNotFound {
+		t.Errorf("inserting under a missing parent = %v, want %v", err, models.ErrCategoryNotFound)
+	}
+	backend.ParentId = gin.ID
+	if err = repos.Categories.Update(backend); err != models.ErrCategoryCycle {
+		t.Errorf("moving a category under its descendant = %v, want %v", err, models.ErrCategoryCycle)
+	}
+	backend.ParentId = 0
+	if err = repos.Categories.Update(backend); err != nil {
+		t.Errorf("saving an unchanged category: %v", err)
+	}
+	missing := &models.Category{Name: "Missing", Slug: "missing"}
+	missing.ID = 9999
+	if err = repos.Categories.Update(missing); err != gorm.ErrRecordNotFound {
+		t.Errorf("updating a missing category = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+	if err = repos.Categories.Delete(golang.ID); err != models.ErrCategoryHasChildren {
+		t.Errorf("deleting a category with children = %v, want %v", err, models.ErrCategoryHasChildren)
+	}
+
+	// 删除分类后其文章属于上级分类
+	if err = repos.Categories.Delete(gin.ID); err != nil {
+		t.Fatal(err)
+	}
+	if categories, err = repos.Categories.ListAll(); err != nil {
+		t.Fatal(err)
+	}
+	for _, category := range categories {
+		if category.ID == golang.ID && (category.Count != 3 || category.Total != 3) {
+			t.Errorf("go after deleting gin has count %d and total %d, want 3", category.Count, category.Total)
+		}
+	}
+}
+
+func testSeriesSave(t *testing.T, repos *models.Repositories) {
+	first := savePost(t, repos, &models.Post{Title: "first", IsPublished: true})
+	second := savePost(t, repos, &models.Post{Title: "second"})
+	third := savePost(t, repos, &models.Post{Title: "third", IsPublished: true})
+
+	series := &models.Series{Title: "Gorm", Slug: "gorm"}
+	if err := repos.Series.Save(series, []uint{third.ID, second.ID, first.ID}); err != nil {
+		t.Fatal(err)
+	}
+	posts, err := repos.Series.ListPosts(series.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if titles := postTitles(posts); !equalStrings(titles, []string{"third", "second", "first"}) {
+		t.Errorf("series posts = %v", titles)
+	}
+	if posts, err = repos.Series.ListPosts(series.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if titles := postTitles(posts); !equalStrings(titles, []string{"third", "first"}) {
+		t.Errorf("published series posts = %v", titles)
+	}
+	stored, err := repos.Series.GetByPostId(second.ID)
+	if err != nil || stored.ID != series.ID {
+		t.Errorf("series of second = %v, %v", stored, err)
+	}
+
+	if err = repos.Series.Save(&models.Series{Title: "Other", Slug: "gorm"}, nil); err != models.ErrSeriesSlugExists {
+		t.Errorf("saving a duplicate slug = %v, want %v", err, models.ErrSeriesSlugExists)
+	}
+	if err = repos.Series.Save(&models.Series{Title: "Other", Slug: "other"}, []uint{9999}); err != models.ErrPostNotFound {
+		t.Errorf("saving with a missing post = %v, want %v", err, models.ErrPostNotFound)
+	}
+	missing := &models.Series{Title: "Missing", Slug: "missing"}
+	missing.ID = 9999
+	if err = repos.Series.Save(missing, nil); err != gorm.ErrRecordNotFound {
+		t.Errorf("saving a missing series = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+	// 更新时替换系列中的全部文章
+	if err = repos.Series.Save(series, []uint{first.ID}); err != nil {
+		t.Fatal(err)
+	}
+	list, err := repos.Series.ListAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Total != 1 {
+		t.Errorf("series after removing posts = %v", list)
+	}
+	if _, err = repos.Series.GetByPostId(third.ID); err != gorm.ErrRecordNotFound {
+		t.Errorf("series of a removed post = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+}
+
+// 备份记录只能由backup包写入，两种实现各自添加后检查查询
+func TestBackupRepository(t *testing.T) {
+	backups := []*models.Backup{
+		{FileName: "a.db.gz", Destination: "local", Status: models.BackupStatusSuccess},
+		{FileName: "b.db.gz", Destination: "s3", Status: models.BackupStatusFailed, Message: "timeout"},
+	}
+	store := memory.NewStore()
+	for _, backup := range backups {
+		copied := *backup
+		store.AddBackup(&copied)
+	}
+	testBackups(t, memory.NewRepositories(store))
+
+	testdb.Open(t)
+	for _, backup := range backups {
+		copied := *backup
+		if err := copied.Insert(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testBackups(t, models.NewGormRepositories())
+}
+
+func testBackups(t *testing.T, repos *models.Repositories) {
+	t.Helper()
+	backups, err := repos.Backups.ListAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 || backups[0].FileName != "b.db.gz" || backups[0].Message != "timeout" || backups[1].FileName != "a.db.gz" {
+		t.Errorf("backups = %v, want newest first", backups)
+	}
+}
+
+func testUsers(t *testing.T, repos *models.Repositories) {
+	admin := &models.User{Email: "admin@example.com", Password: "secret", IsAdmin: true}
+	if err := repos.Users.Insert(admin); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Users.Insert(&models.User{Email: "admin@example.com"}); err == nil {
+		t.Error("inserting a duplicate email succeeded")
+	}
+	stored, err := repos.Users.GetByUsername("admin@example.com")
+	if err != nil || stored.ID != admin.ID || stored.Password != "secret" {
+		t.Fatalf("user by email = %v, %v", stored, err)
+	}
+
+	visitor := &models.User{GithubLoginId: "octocat", AvatarUrl: "avatar"}
+	if err = repos.Users.FirstOrCreateByGithub(visitor); err != nil || visitor.ID == 0 {
+		t.Fatalf("creating github user = %d, %v", visitor.ID, err)
+	}
+	again := &models.User{GithubLoginId: "octocat"}
+	if err = repos.Users.FirstOrCreateByGithub(again); err != nil || again.ID != visitor.ID || again.AvatarUrl != "avatar" {
+		t.Errorf("existing github user = %d %q, %v, want %d", again.ID, again.AvatarUrl, err, visitor.ID)
+	}
+	if stored, err = repos.Users.GetByGithubId("octocat"); err != nil || stored.ID != visitor.ID {
+		t.Errorf("user by github id = %v, %v", stored, err)
+	}
+
+	visitor.AvatarUrl, visitor.NickName = "new-avatar", "cat"
+	if err = repos.Users.UpdateProfile(visitor); err != nil {
+		t.Fatal(err)
+	}
+	visitor.Email = "cat@example.com"
+	if err = repos.Users.UpdateEmail(visitor); err != nil {
+		t.Fatal(err)
+	}
+	visitor.LockState = true
+	if err = repos.Users.Lock(visitor); err != nil {
+		t.Fatal(err)
+	}
+	if stored, err = repos.Users.GetById(visitor.ID); err != nil {
+		t.Fatal(err)
+	}
+	if stored.AvatarUrl != "new-avatar" || stored.NickName != "cat" || stored.Email != "cat@example.com" || !stored.LockState {
+		t.Errorf("updated user = %+v", stored)
+	}
+
+	visitor.Email = ""
+	if err = repos.Users.UpdateEmail(visitor); err != nil {
+		t.Fatal(err)
+	}
+	visitor.GithubLoginId = ""
+	if err = repos.Users.UpdateGithubUserInfo(visitor); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repos.Users.GetByUsername("cat@example.com"); err != gorm.ErrRecordNotFound {
+		t.Errorf("user by unbound email = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+	if _, err = repos.Users.GetByGithubId("octocat"); err != gorm.ErrRecordNotFound {
+		t.Errorf("user by unbound github id = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+
+	users, err := repos.Users.ListNonAdmin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].ID != visitor.ID {
+		t.Errorf("non-admin users = %v, want only the visitor", users)
+	}
+}
+
+func testLinks(t *testing.T, repos *models.Repositories) {
+	second := &models.Link{Name: "second", Url: "https://b.example.com", Sort: 2}
+	first := &models.Link{Name: "first", Url: "https://a.example.com", Sort: 1}
+	for _, link := range []*models.Link{second, first} {
+		if err := repos.Links.Insert(link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	duplicate := &models.Link{Name: "duplicate", Url: "https://b.example.com"}
+	if err := repos.Links.Insert(duplicate); err != nil || duplicate.ID != second.ID {
+		t.Errorf("inserting a duplicate url = %d, %v, want %d", duplicate.ID, err, second.ID)
+	}
+	links, err := repos.Links.ListAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 2 || links[0].Name != "first" || links[1].Name != "second" {
+		t.Errorf("links = %v, want sorted by sort", links)
+	}
+
+	first.View++
+	if err = repos.Links.UpdateView(first); err != nil {
+		t.Fatal(err)
+	}
+	second.Name = "renamed"
+	if err = repos.Links.Update(second); err != nil {
+		t.Fatal(err)
+	}
+	if link, err := repos.Links.GetById(first.ID); err != nil || link.View != 1 {
+		t.Errorf("viewed link = %v, %v", link, err)
+	}
+	if link, err := repos.Links.GetById(second.ID); err != nil || link.Name != "renamed" {
+		t.Errorf("updated link = %v, %v", link, err)
+	}
+
+	if err = repos.Links.Delete(second.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repos.Links.GetById(second.ID); err != gorm.ErrRecordNotFound {
+		t.Errorf("getting a deleted link = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+	if _, err = repos.Links.GetById(9999); err != gorm.ErrRecordNotFound {
+		t.Errorf("getting a missing link = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+}
+
+func subscriberEmails(subscribers []*models.Subscriber) []string {
+	emails := make([]string, len(subscribers))
+	for i, subscriber := range subscribers {
+		emails[i] = subscriber.Email
+	}
+	return emails
+}
+
+func testSubscribers(t *testing.T, repos *models.Repositories) {
+	golang := insertTag(t, repos, "go")
+	rust := insertTag(t, repos, "rust")
+	goPost := savePost(t, repos, &models.Post{Title: "go post", IsPublished: true}, golang.ID)
+	rustPost := savePost(t, repos, &models.Post{Title: "rust post", IsPublished: true}, rust.ID)
+
+	base := time.Date(2021, 6, 1, 8, 0, 0, 0, time.UTC)
+	var subscribers []*models.Subscriber
+	for i, frequency := range []string{models.FrequencyImmediate, models.FrequencyDaily, models.FrequencyImmediate} {
+		subscriber := &models.Subscriber{Email: string(rune('a'+i)) + "@example.com", Frequency: frequency}
+		subscriber.CreatedAt = base.Add(time.Duration(i) * time.Hour)
+		if err := repos.Subscribers.Insert(subscriber); err != nil {
+			t.Fatal(err)
+		}
+		subscribers = append(subscribers, subscriber)
+	}
+	a, b, c := subscribers[0], subscribers[1], subscribers[2]
+	duplicate := &models.Subscriber{Email: "a@example.com"}
+	if err := repos.Subscribers.Insert(duplicate); err != nil || duplicate.ID != a.ID {
+		t.Errorf("inserting a duplicate email = %d, %v, want %d", duplicate.ID, err, a.ID)
+	}
+	// a和b已激活，c待激活
+	for _, subscriber := range []*models.Subscriber{a, b} {
+		subscriber.VerifyState = true
+		subscriber.Signature = "sig-" + subscriber.Email
+		if err := repos.Subscribers.Update(subscriber); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if count := repos.Subscribers.Count(); count != 2 {
+		t.Errorf("subscriber count = %d, want 2", count)
+	}
+	if stored, err := repos.Subscribers.GetBySignature("sig-b@example.com"); err != nil || stored.ID != b.ID {
+		t.Errorf("subscriber by signature = %v, %v", stored, err)
+	}
+
+	if err := repos.Subscribers.SetTags(a.ID, []uint{golang.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Subscribers.SetTags(a.ID, []uint{golang.ID, 9999}); err != models.ErrTagNotFound {
+		t.Errorf("setting a missing tag = %v, want %v", err, models.ErrTagNotFound)
+	}
+	tags, err := repos.Subscribers.ListTags(a.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := tagNames(tags); !equalStrings(names, []string{"go"}) {
+		t.Errorf("subscriber tags = %v, want [go]", names)
+	}
+	notified, err := repos.Subscribers.ListByPost(models.FrequencyImmediate, goPost.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if emails := subscriberEmails(notified); !equalStrings(emails, []string{"a@example.com"}) {
+		t.Errorf("notified of go post = %v, want [a@example.com]", emails)
+	}
+	if notified, err = repos.Subscribers.ListByPost(models.FrequencyImmediate, rustPost.ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(notified) != 0 {
+		t.Errorf("notified of rust post = %v, want none", subscriberEmails(notified))
+	}
+	daily, err := repos.Subscribers.ListByFrequency(models.FrequencyDaily)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if emails := subscriberEmails(daily); !equalStrings(emails, []string{"b@example.com"}) {
+		t.Errorf("daily subscribers = %v, want [b@example.com]", emails)
+	}
+	posts, err := repos.Posts.ListPublishedSinceBySubscriber(time.Now().Add(-time.Hour), a.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if titles := postTitles(posts); !equalStrings(titles, []string{"go post"}) {
+		t.Errorf("digest posts of a = %v, want [go post]", titles)
+	}
+	if posts, err = repos.Posts.ListPublishedSinceBySubscriber(time.Now().Add(-time.Hour), b.ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 2 {
+		t.Errorf("digest posts of b = %v, want both", postTitles(posts))
+	}
+
+	b.HardBounceCount = 2
+	b.SubscribeState = false
+	if err = repos.Subscribers.UpdateBounce(b, "event-1"); err != nil {
+		t.Fatal(err)
+	}
+	// 同一次退信不重复记录，其他订阅者的同一封退信照常记录
+	b.HardBounceCount = 3
+	if err = repos.Subscribers.UpdateBounce(b, "event-1"); err != models.ErrBounceRecorded {
+		t.Errorf("recording a bounce twice = %v, want %v", err, models.ErrBounceRecorded)
+	}
+	if err = repos.Subscribers.UpdateBounce(a, "event-1"); err != nil {
+		t.Errorf("recording the bounce of another subscriber = %v", err)
+	}
+	digestAt := base.Add(24 * time.Hour)
+	a.LastDigestAt = digestAt
+	if err = repos.Subscribers.UpdateLastDigest(a); err != nil {
+		t.Fatal(err)
+	}
+	if stored, err := repos.Subscribers.GetByEmail("b@example.com"); err != nil || stored.HardBounceCount != 2 || stored.SubscribeState {
+		t.Errorf("bounced subscriber = %+v, %v", stored, err)
+	}
+	if stored, err := repos.Subscribers.GetById(a.ID); err != nil || !stored.LastDigestAt.Equal(digestAt) {
+		t.Errorf("last digest at = %v, %v, want %v", stored.LastDigestAt, err, digestAt)
+	}
+
+	for state, want := range map[string][]string{
+		models.SubscriberStateVerified:     {"a@example.com"},
+		models.SubscriberStateUnsubscribed: {"b@example.com"},
+		models.SubscriberStatePending:      {"c@example.com"},
+	} {
+		list, err := repos.Subscribers.ListByState(state, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if emails := subscriberEmails(list); !equalStrings(emails, want) {
+			t.Errorf("%s subscribers = %v, want %v", state, emails, want)
+		}
+	}
+	pagination := &models.Pagination{Page: 1, PageSize: 2}
+	list, err := repos.Subscribers.ListByState("", pagination)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if emails := subscriberEmails(list); !equalStrings(emails, []string{c.Email, b.Email}) || pagination.Total != 3 || !pagination.HasNext() {
+		t.Errorf("page 1 = %v, total %d", emails, pagination.Total)
+	}
+	pagination = &models.Pagination{Page: 1, PageSize: 2, Cursor: pagination.NextCursor}
+	if list, err = repos.Subscribers.ListByState("", pagination); err != nil {
+		t.Fatal(err)
+	}
+	if emails := subscriberEmails(list); !equalStrings(emails, []string{a.Email}) || pagination.HasNext() {
+		t.Errorf("page after cursor = %v", emails)
+	}
+}
+
+func testMedia(t *testing.T, repos *models.Repositories) {
+	image := &models.Media{Driver: "local", StorageKey: "a.png", Url: "/static/uploads/a.png", FileName: "a.png", ContentType: "image/png", Size: 100, UserId: 1, Hash: "hash-a"}
+	file := &models.Media{Driver: "local", StorageKey: "b.txt", Url: "/static/uploads/b.txt", FileName: "b.txt", ContentType: "text/plain", Size: 5, UserId: 2, Hash: "hash-b"}
+	for _, media := range []*models.Media{image, file} {
+		if err := repos.Media.Insert(media); err != nil {
+			t.Fatal(err)
+		}
+	}
+	duplicate := &models.Media{Driver: "local", StorageKey: "a.png"}
+	if err := repos.Media.Insert(duplicate); err != nil || duplicate.ID != image.ID {
+		t.Errorf("inserting a duplicate key = %d, %v, want %d", duplicate.ID, err, image.ID)
+	}
+	for _, variant := range []*models.MediaVariant{
+		{MediaId: image.ID, Name: "thumb", StorageKey: "a_thumb.png", Url: "/static/uploads/a_thumb.png", ContentType: "image/png", Size: 10, Width: 100},
+		{MediaId: image.ID, StorageKey: "a.webp", Url: "/static/uploads/a.webp", ContentType: "image/webp", Size: 20, Width: 800},
+	} {
+		if err := repos.Media.InsertVariant(variant); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if stored, err := repos.Media.GetByHash("local", "hash-a"); err != nil || stored.ID != image.ID {
+		t.Errorf("media by hash = %v, %v", stored, err)
+	}
+	if _, err := repos.Media.GetByHash("s3", "hash-a"); err != gorm.ErrRecordNotFound {
+		t.Errorf("media by hash in another driver = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+	variants, err := repos.Media.ListVariants(image.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(variants) != 2 || variants[0].Width != 800 || variants[1].Width != 100 {
+		t.Errorf("variants = %v, want widest first", variants)
+	}
+	medias, err := repos.Media.ListByUrls([]string{image.Url, "/missing.png"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(medias) != 1 || medias[0].ID != image.ID || len(medias[0].Variants) != 2 {
+		t.Errorf("media by urls = %v", medias)
+	}
+	if size, err := repos.Media.SumSizeByUserId(1); err != nil || size != 130 {
+		t.Errorf("size of user 1 = %d, %v, want 130", size, err)
+	}
+	if medias, err = repos.Media.List("b.txt", nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(medias) != 1 || medias[0].ID != file.ID {
+		t.Errorf("media matching b.txt = %v", medias)
+	}
+	if medias, err = repos.Media.List("", nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(medias) != 2 || medias[0].ID != file.ID {
+		t.Errorf("all media = %v, want newest first", medias)
+	}
+
+	// 地址中的_在like中是通配符，/static/uploads/aXpng不应算作引用a_png
+	underscore := "/static/uploads/a_png"
+	savePost(t, repos, &models.Post{Title: "with image", Body: "![a](" + image.Url + ")"})
+	savePost(t, repos, &models.Post{Title: "with both", Body: "![a](" + image.Url + ") [b](" + file.Url + ")"})
+	savePost(t, repos, &models.Post{Title: "without image", Body: "text /static/uploads/aXpng"})
+	usage, err := repos.Posts.ListByMediaUrls([]string{image.Url, file.Url, underscore})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if titles := postTitles(usage[image.Url]); !equalStrings(titles, []string{"with image", "with both"}) {
+		t.Errorf("posts using the image = %v, want [with image with both]", titles)
+	}
+	if titles := postTitles(usage[file.Url]); !equalStrings(titles, []string{"with both"}) {
+		t.Errorf("posts using the file = %v, want [with both]", titles)
+	}
+	if posts := usage[underscore]; len(posts) != 0 {
+		t.Errorf("posts using %s = %v, want none", underscore, postTitles(posts))
+	}
+	grouped, err := repos.Media.ListVariantsByMediaIds([]uint{image.ID, file.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(grouped) != 1 || len(grouped[image.ID]) != 2 || grouped[image.ID][0].Width != 800 {
+		t.Errorf("variants by media ids = %v", grouped)
+	}
+
+	if err = repos.Media.Delete(image.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repos.Media.GetById(image.ID); err != gorm.ErrRecordNotFound {
+		t.Errorf("getting deleted media = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+	if variants, err = repos.Media.ListVariants(image.ID); err != nil || len(variants) != 0 {
+		t.Errorf("variants of deleted media = %v, %v", variants, err)
+	}
+}
+
+func itoa(id uint) string {
+	return strconv.Itoa(int(id))
+}
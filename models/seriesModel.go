@@ -0,0 +1,175 @@
+package models
+
+import (
+	"github.com/cihub/seelog"
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+)
+
+// table series, 多篇文章组成的系列，按指定顺序阅读
+type Series struct {
+	BaseModel
+	Title       string                    // 标题
+	Slug        string                    // 系列页地址/series/:slug中的别名，全站唯一
+	Description string  `gorm:"type:text"` // 系列介绍，显示在系列页
+	Total       int     `gorm:"-"`         // 包含的文章数(包括未发布的文章)
+	Posts       []*Post `gorm:"-"`         // 按顺序排列的文章
+}
+
+// table series_posts, 文章在系列中的位置，每篇文章最多属于一个系列
+type SeriesPost struct {
+	BaseModel
+	SeriesId uint
+	PostId   uint
+	Position int // 从1开始
+}
+
+var (
+	// 别名已被其他系列使用
+	ErrSeriesSlugExists = errors.New("series slug already exists")
+	// 保存系列时引用了不存在的文章
+	ErrPostNotFound = errors.New("post not found")
+)
+
+// 文章在Posts中的位置，从1开始，不在其中时返回0
+func (series *Series) Part(postId uint) int {
+	for i, post := range series.Posts {
+		if post.ID == postId {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// 上一篇，没有时返回nil
+func (series *Series) Prev(postId uint) *Post {
+	if part := series.Part(postId); part > 1 {
+		return series.Posts[part-2]
+	}
+	return nil
+}
+
+// 下一篇，没有时返回nil
+func (series *Series) Next(postId uint) *Post {
+	if part := series.Part(postId); part > 0 && part < len(series.Posts) {
+		return series.Posts[part]
+	}
+	return nil
+}
+
+// SaveSeries 在一个事务中新建(series.ID为0)或更新系列，并按postIds的顺序替换其全部文章；
+// 已属于其他系列的文章会从原系列中移出
+func SaveSeries(series *Series, postIds []uint) error {
+	postIds = uniqueIds(postIds)
+	return Transaction(func(tx *gorm.DB) error {
+		if series.ID != 0 {
+			if err := tx.Select("id").First(&Series{}, series.ID).Error; err != nil {
+				return err
+			}
+		}
+		var count int
+		if err := tx.Model(&Series{}).Where("slug = ? and id <> ?", series.Slug, series.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrSeriesSlugExists
+		}
+		if len(postIds) > 0 {
+			if err := tx.Model(&Post{}).Where("id in (?)", postIds).Count(&count).Error; err != nil {
+				return err
+			}
+			if count != len(postIds) {
+				return ErrPostNotFound
+			}
+		}
+		if series.ID == 0 {
+			if err := tx.Create(series).Error; err != nil {
+				return err
+			}
+		} else {
+			err := tx.Model(series).Updates(map[string]interface{}{
+				"title":       series.Title,
+				"slug":        series.Slug,
+				"description": series.Description,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		if err := tx.Delete(&SeriesPost{}, "series_id = ?", series.ID).Error; err != nil {
+			return err
+		}
+		if len(postIds) > 0 {
+			if err := tx.Delete(&SeriesPost{}, "post_id in (?)", postIds).Error; err != nil {
+				return err
+			}
+		}
+		for i, postId := range postIds {
+			if err := tx.Create(&SeriesPost{SeriesId: series.ID, PostId: postId, Position: i + 1}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// 删除系列，其中的文章不受影响
+func DeleteSeries(id uint) error {
+	return Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&SeriesPost{}, "series_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Series{}, "id = ?", id).Error
+	})
+}
+
+func DeleteSeriesPostByPostId(postId uint) error {
+	return DB.Delete(&SeriesPost{}, "post_id = ?", postId).Error
+}
+
+func GetSeriesById(id uint) (*Series, error) {
+	var series Series
+	err := DB.First(&series, id).Error
+	return &series, err
+}
+
+func GetSeriesBySlug(slug string) (*Series, error) {
+	var series Series
+	err := DB.First(&series, "slug = ?", slug).Error
+	return &series, err
+}
+
+// 文章所属的系列，不属于任何系列时返回gorm.ErrRecordNotFound
+func GetSeriesByPostId(postId uint) (*Series, error) {
+	var series Series
+	err := DB.Select("series.*").Joins("inner join series_posts sp on series.id = sp.series_id").Where("sp.post_id = ?", postId).First(&series).Error
+	return &series, err
+}
+
+// 全部系列及包含的文章数
+func ListAllSeries() ([]*Series, error) {
+	var series []*Series
+	rows, err := DB.Raw("select s.*, (select count(*) from series_posts sp where sp.series_id = s.id) as total from series s order by s.id").Rows()
+	if err != nil {
+		seelog.Error("[ListAllSeries]db raw err", err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s Series
+		DB.ScanRows(rows, &s)
+		series = append(series, &s)
+	}
+	return series, nil
+}
+
+// 系列中按顺序排列的文章，published为true时只返回已发布的文章
+func ListPostBySeries(seriesId uint, published bool) ([]*Post, error) {
+	var posts []*Post
+	db := DB.Model(&Post{}).Select("posts.*").Joins("inner join series_posts sp on posts.id = sp.post_id").Where("sp.series_id = ?", seriesId)
+	if published {
+		db = db.Where("posts.is_published = ?", true)
+	}
+	err := db.Order("sp.position").Find(&posts).Error
+	return posts, err
+}
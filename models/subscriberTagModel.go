@@ -0,0 +1,67 @@
+package models
+
+import (
+	"github.com/cihub/seelog"
+	"github.com/jinzhu/gorm"
+)
+
+// table subscriber_tags
+type SubscriberTag struct {
+	BaseModel
+	SubscriberId uint // subscriber id
+	TagId        uint // tag id
+}
+
+// subscriber_tags
+func (st *SubscriberTag) Insert() error {
+	return DB.FirstOrCreate(st, "subscriber_id = ? and tag_id = ?", st.SubscriberId, st.TagId).Error
+}
+
+func DeleteSubscriberTagBySubscriberId(subscriberId uint) error {
+	return DB.Delete(&SubscriberTag{}, "subscriber_id = ?", subscriberId).Error
+}
+
+// 重新设置订阅者关注的标签，为空时表示接收所有文章；标签不存在时返回ErrTagNotFound，不修改已有的标签
+func SetSubscriberTags(subscriberId uint, tagIds []uint) error {
+	tagIds = uniqueIds(tagIds)
+	return Transaction(func(tx *gorm.DB) error {
+		if len(tagIds) > 0 {
+			var count int
+			if err := tx.Model(&Tag{}).Where("id in (?)", tagIds).Count(&count).Error; err != nil {
+				return err
+			}
+			if count != len(tagIds) {
+				return ErrTagNotFound
+			}
+		}
+		if err := tx.Delete(&SubscriberTag{}, "subscriber_id = ?", subscriberId).Error; err != nil {
+			return err
+		}
+		for _, tagId := range tagIds {
+			st := &SubscriberTag{
+				SubscriberId: subscriberId,
+				TagId:        tagId,
+			}
+			if err := tx.Create(st).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func ListTagBySubscriberId(subscriberId uint) ([]*Tag, error) {
+	var tags []*Tag
+	rows, err := DB.Raw("select t.* from tags t inner join subscriber_tags st on t.id = st.tag_id where st.subscriber_id = ?", subscriberId).Rows()
+	if err != nil {
+		seelog.Error("[ListTagBySubscriberId]db raw err", err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tag Tag
+		DB.ScanRows(rows, &tag)
+		tags = append(tags, &tag)
+	}
+	return tags, nil
+}
@@ -1,19 +1,40 @@
 package models
 
 import (
+	"github.com/cihub/seelog"
 	"github.com/jinzhu/gorm"
 	"time"
 )
 
+// 订阅推送频率
+const (
+	FrequencyImmediate = "immediate" // 文章发布时立即推送
+	FrequencyDaily     = "daily"     // 每日摘要
+	FrequencyWeekly    = "weekly"    // 每周摘要
+)
+
+// 订阅者状态，用于后台筛选
+const (
+	SubscriberStateVerified     = "verified"     // 已激活且订阅中
+	SubscriberStateUnsubscribed = "unsubscribed" // 已激活但已退订
+	SubscriberStatePending      = "pending"      // 待激活
+)
+
 // table subscribe
 type Subscriber struct {
 	gorm.Model
-	Email          string `gorm:"unique_index"` //邮箱
-	VerifyState    bool   `gorm:"default:'0'"`  //验证状态
-	SubscribeState bool   `gorm:"default:'1'"`  //订阅状态
-	OutTime        time.Time                    //过期时间
-	SecretKey      string                       // 秘钥
-	Signature      string                       //签名
+	Email           string    `gorm:"unique_index"` //邮箱
+	VerifyState     bool      `gorm:"default:'0'"`  //验证状态
+	SubscribeState  bool      `gorm:"default:'1'"`  //订阅状态
+	OutTime         time.Time //过期时间
+	SecretKey       string    // 秘钥
+	Signature       string    //签名
+	Frequency       string    `gorm:"default:'immediate'"` //推送频率
+	LastDigestAt    time.Time //上次发送摘要时间
+	SoftBounceCount int       //临时退信次数
+	HardBounceCount int       //永久退信次数
+	LastBounceAt    time.Time //上次退信时间
+	Tags            []*Tag    `gorm:"-"` // 关注的标签
 }
 
 // Subscriber
@@ -28,9 +49,14 @@ func (s *Subscriber) Update() error {
 		"out_time":        s.OutTime,
 		"signature":       s.Signature,
 		"secret_key":      s.SecretKey,
+		"frequency":       s.Frequency,
 	}).Error
 }
 
+func (s *Subscriber) UpdateLastDigest() error {
+	return DB.Model(s).UpdateColumn("last_digest_at", s.LastDigestAt).Error
+}
+
 func ListSubscriber(invalid bool) ([]*Subscriber, error) {
 	var subscribers []*Subscriber
 	db := DB.Model(&Subscriber{})
@@ -41,6 +67,62 @@ func ListSubscriber(invalid bool) ([]*Subscriber, error) {
 	return subscribers, err
 }
 
+// 按状态筛选订阅者，state为空时返回全部，pagination为nil时不分页
+func ListSubscriberByState(state string, pagination *Pagination) ([]*Subscriber, error) {
+	var subscribers []*Subscriber
+	db := DB.Model(&Subscriber{})
+	switch state {
+	case SubscriberStateVerified:
+		db = db.Where("verify_state = ? and subscribe_state = ?", true, true)
+	case SubscriberStateUnsubscribed:
+		db = db.Where("verify_state = ? and subscribe_state = ?", true, false)
+	case SubscriberStatePending:
+		db = db.Where("verify_state = ?", false)
+	}
+	if pagination == nil {
+		err := db.Find(&subscribers).Error
+		return subscribers, err
+	}
+	db, err := pagination.paginate(db, "subscribers")
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Find(&subscribers).Error; err != nil {
+		return nil, err
+	}
+	subscribers = subscribers[:pagination.Fill(len(subscribers), func(i int) (time.Time, uint) {
+		return subscribers[i].CreatedAt, subscribers[i].ID
+	})]
+	return subscribers, nil
+}
+
+// 获取指定推送频率的有效订阅者
+func ListSubscriberByFrequency(frequency string) ([]*Subscriber, error) {
+	var subscribers []*Subscriber
+	err := DB.Where("verify_state = ? and subscribe_state = ? and frequency = ?", true, true, frequency).Find(&subscribers).Error
+	return subscribers, err
+}
+
+// 获取应收到该文章通知的订阅者：未限定标签，或关注了文章的任一标签
+func ListSubscriberByPost(frequency string, postId uint) ([]*Subscriber, error) {
+	var subscribers []*Subscriber
+	querysql := `select s.* from subscribers s where s.deleted_at is null and s.verify_state = ? and s.subscribe_state = ? and s.frequency = ?
+		and (not exists (select 1 from subscriber_tags st where st.subscriber_id = s.id)
+		or exists (select 1 from subscriber_tags st inner join post_tags pt on st.tag_id = pt.tag_id where st.subscriber_id = s.id and pt.post_id = ?))`
+	rows, err := DB.Raw(querysql, true, true, frequency, postId).Rows()
+	if err != nil {
+		seelog.Error("[ListSubscriberByPost]db raw err", err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var subscriber Subscriber
+		DB.ScanRows(rows, &subscriber)
+		subscribers = append(subscribers, &subscriber)
+	}
+	return subscribers, nil
+}
+
 func CountSubscriber() (int, error) {
 	var count int
 	err := DB.Model(&Subscriber{}).Where("verify_state = ? and subscribe_state = ?", true, true).Count(&count).Error
@@ -3,31 +3,112 @@ package models
 import (
 	"github.com/cihub/seelog"
 	. "blog/helpers"
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
 	)
 
 // table tags
 type Tag struct {
 	BaseModel
-	Name  string         // tag name
-	Total int `gorm:"-"` // count of post
+	Name        string             // tag name
+	Description string `gorm:"type:text"` // 标签介绍，显示在标签页
+	Cover       string             // 封面图片地址
+	Total       int `gorm:"-"`     // count of post
 }
 
+// 名称已被其他标签使用
+var ErrTagNameExists = errors.New("tag name already exists")
+
 // Tag
 func (tag *Tag) Insert() error {
 	return DB.FirstOrCreate(tag, "name = ?", tag.Name).Error
 }
 
+// 重命名为已有标签的名称时返回ErrTagNameExists，应改用合并
 func (tag *Tag) Update() error {
-	return DB.Save(tag).Error
+	var count int
+	if err := DB.Model(&Tag{}).Where("name = ? and id <> ?", tag.Name, tag.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrTagNameExists
+	}
+	return DB.Model(tag).Updates(map[string]interface{}{
+		"name":        tag.Name,
+		"description": tag.Description,
+		"cover":       tag.Cover,
+	}).Error
+}
+
+func GetTagById(id uint) (*Tag, error) {
+	var tag Tag
+	err := DB.First(&tag, id).Error
+	return &tag, err
+}
+
+// 删除标签，同时删除文章和订阅者与该标签的关联
+func DeleteTag(id uint) error {
+	return Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&PostTag{}, "tag_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&SubscriberTag{}, "tag_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Tag{}, "id = ?", id).Error
+	})
 }
 
-func (tag *Tag) Delete() error {
-	return DB.Delete(tag).Error
+// 将标签sourceId合并到targetId：文章和订阅者改为关联targetId(已关联的不重复添加)，然后删除sourceId
+func MergeTag(sourceId, targetId uint) error {
+	if sourceId == targetId {
+		return errors.New("cannot merge a tag into itself")
+	}
+	return Transaction(func(tx *gorm.DB) error {
+		var count int
+		if err := tx.Model(&Tag{}).Where("id in (?)", []uint{sourceId, targetId}).Count(&count).Error; err != nil {
+			return err
+		}
+		if count != 2 {
+			return ErrTagNotFound
+		}
+		now := GetCurrentTime()
+		err := tx.Exec("insert into post_tags (created_at, updated_at, post_id, tag_id) select ?, ?, post_id, ? from post_tags where tag_id = ? and post_id not in (select post_id from post_tags where tag_id = ?)",
+			now, now, targetId, sourceId, targetId).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Exec("insert into subscriber_tags (created_at, updated_at, subscriber_id, tag_id) select ?, ?, subscriber_id, ? from subscriber_tags where tag_id = ? and subscriber_id not in (select subscriber_id from subscriber_tags where tag_id = ?)",
+			now, now, targetId, sourceId, targetId).Error
+		if err != nil {
+			return err
+		}
+		if err = tx.Delete(&PostTag{}, "tag_id = ?", sourceId).Error; err != nil {
+			return err
+		}
+		if err = tx.Delete(&SubscriberTag{}, "tag_id = ?", sourceId).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Tag{}, "id = ?", sourceId).Error
+	})
+}
+
+// 按名称查找标签，不存在时创建，返回标签id；用于编辑文章时直接输入新标签
+func findOrCreateTags(tx *gorm.DB, names []string) ([]uint, error) {
+	var tagIds []uint
+	for _, name := range names {
+		tag := Tag{Name: name}
+		if err := tx.Where("name = ?", name).FirstOrCreate(&tag).Error; err != nil {
+			return nil, err
+		}
+		tagIds = append(tagIds, tag.ID)
+	}
+	return tagIds, nil
 }
 
 func ListTag() ([]*Tag, error) {
 	var tags []*Tag
-	rows, err := DB.Raw("select t.*,count(*) total from tags t inner join post_tags pt on t.id = pt.tag_id inner join posts p on pt.post_id = p.id where p.is_published = ? group by pt.tag_id", true).Rows()
+	rows, err := DB.Raw("select t.*,c.total from tags t inner join (select pt.tag_id,count(*) as total from post_tags pt inner join posts p on pt.post_id = p.id where p.is_published = ? group by pt.tag_id) c on t.id = c.tag_id", true).Rows()
 	if err != nil {
 		seelog.Error("[ListTag]db raw err", err)
 		return nil, err
@@ -66,15 +147,50 @@ func ListTagByPostId(id string) ([]*Tag, error) {
 	return tags, nil
 }
 
+// 一次查询一页文章的标签，按文章id分组
+func ListTagByPostIds(postIds []uint) (map[uint][]*Tag, error) {
+	postTags := make(map[uint][]*Tag)
+	if len(postIds) == 0 {
+		return postTags, nil
+	}
+	rows, err := DB.Raw("select t.*, pt.post_id from tags t inner join post_tags pt on t.id = pt.tag_id where pt.post_id in (?) order by t.id", postIds).Rows()
+	if err != nil {
+		seelog.Error("[ListTagByPostIds]db raw err", err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var row struct {
+			Tag
+			PostId uint
+		}
+		DB.ScanRows(rows, &row)
+		tag := row.Tag
+		postTags[row.PostId] = append(postTags[row.PostId], &tag)
+	}
+	return postTags, nil
+}
+
 func CountTag() int {
 	var count int
 	DB.Model(&Tag{}).Count(&count)
 	return count
 }
 
+// 全部标签，Total为关联的文章数(包括未发布的文章)
 func ListAllTag() ([]*Tag, error) {
 	var tags []*Tag
-	err := DB.Model(&Tag{}).Find(&tags).Error
-	return tags, err
+	rows, err := DB.Raw("select t.*, (select count(*) from post_tags pt where pt.tag_id = t.id) as total from tags t order by t.id").Rows()
+	if err != nil {
+		seelog.Error("[ListAllTag]db raw err", err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tag Tag
+		DB.ScanRows(rows, &tag)
+		tags = append(tags, &tag)
+	}
+	return tags, nil
 }
 
@@ -0,0 +1,107 @@
+package models_test
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"blog/models"
+	"blog/models/testdb"
+)
+
+func tagNames(tags []*models.Tag) []string {
+	names := make([]string, len(tags))
+	for i, tag := range tags {
+		names[i] = tag.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+// INSERT ... SELECT把文章和订阅者改为关联目标标签，已关联的不重复添加
+func TestMergeTag(t *testing.T) {
+	db := testdb.Open(t)
+	source := createTag(t, "golang")
+	target := createTag(t, "go")
+	other := createTag(t, "rust")
+	onlySource := createPost(t, "only-source", true, time.Now(), source.ID)
+	both := createPost(t, "both", true, time.Now(), source.ID, target.ID, other.ID)
+	subscriber := &models.Subscriber{Email: "gopher@example.com"}
+	if err := subscriber.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.SetSubscriberTags(subscriber.ID, []uint{source.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := models.MergeTag(source.ID, target.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, post := range []*models.Post{onlySource, both} {
+		var count int
+		if err := db.Model(&models.PostTag{}).Where("post_id = ? and tag_id = ?", post.ID, target.ID).Count(&count).Error; err != nil {
+			t.Fatal(err)
+		}
+		if count != 1 {
+			t.Errorf("post %s has %d links to the target tag, want 1", post.Title, count)
+		}
+	}
+	postTags, err := models.ListTagByPostIds([]uint{onlySource.ID, both.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := tagNames(postTags[both.ID]); !equalStrings(names, []string{"go", "rust"}) {
+		t.Errorf("tags of both = %v", names)
+	}
+	tags, err := models.ListTagBySubscriberId(subscriber.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := tagNames(tags); !equalStrings(names, []string{"go"}) {
+		t.Errorf("subscriber tags = %v, want [go]", names)
+	}
+	if _, err = models.GetTagById(source.ID); err == nil {
+		t.Error("source tag still exists")
+	}
+
+	if err = models.MergeTag(source.ID, target.ID); err != models.ErrTagNotFound {
+		t.Errorf("merging a deleted tag = %v, want %v", err, models.ErrTagNotFound)
+	}
+	if err = models.MergeTag(target.ID, target.ID); err == nil {
+		t.Error("merging a tag into itself succeeded")
+	}
+}
+
+// 标签列表中的文章数由子查询统计
+func TestListTagTotals(t *testing.T) {
+	testdb.Open(t)
+	golang := createTag(t, "go")
+	rust := createTag(t, "rust")
+	createTag(t, "unused")
+	createPost(t, "published", true, time.Now(), golang.ID, rust.ID)
+	createPost(t, "draft", false, time.Now(), golang.ID)
+
+	tags, err := models.ListTag()
+	if err != nil {
+		t.Fatal(err)
+	}
+	totals := make(map[string]int)
+	for _, tag := range tags {
+		totals[tag.Name] = tag.Total
+	}
+	if len(totals) != 2 || totals["go"] != 1 || totals["rust"] != 1 {
+		t.Errorf("published tag totals = %v, want go 1 and rust 1", totals)
+	}
+
+	tags, err = models.ListAllTag()
+	if err != nil {
+		t.Fatal(err)
+	}
+	totals = make(map[string]int)
+	for _, tag := range tags {
+		totals[tag.Name] = tag.Total
+	}
+	if len(totals) != 3 || totals["go"] != 2 || totals["rust"] != 1 || totals["unused"] != 0 {
+		t.Errorf("tag totals = %v, want go 2, rust 1 and unused 0", totals)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build mysql
+// +build mysql
+
+package testdb
+
+import (
+	"os"
+	"testing"
+
+	"blog/models"
+)
+
+const driver = models.DriverMysql
+
+// 如root:secret@tcp(127.0.0.1:3306)/blog_test?parseTime=true&loc=Local
+func dsn(t testing.TB, dir string) string {
+	dsn := os.Getenv("BLOG_TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("BLOG_TEST_MYSQL_DSN is not set")
+	}
+	return dsn
+}
@@ -0,0 +1,18 @@
+//go:build !mysql && !postgres
+// +build !mysql,!postgres
+
+package testdb
+
+import (
+	"path/filepath"
+	"testing"
+
+	"blog/models"
+)
+
+const driver = models.DriverSqlite
+
+// 每个测试使用临时目录中新的数据库文件
+func dsn(t testing.TB, dir string) string {
+	return filepath.Join(dir, "blog.db")
+}
@@ -0,0 +1,59 @@
+// Package testdb 为测试准备数据库：默认使用临时的sqlite文件，使用-tags mysql、-tags postgres编译时
+// 分别连接环境变量BLOG_TEST_MYSQL_DSN、BLOG_TEST_POSTGRES_DSN指向的数据库，未设置时跳过测试。
+// 连接后会删除已有的表再执行全部迁移，不要指向保存有数据的数据库
+package testdb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+
+	"blog/models"
+	"blog/system"
+)
+
+// 迁移创建的全部表，包括迁移记录
+var tables = []string{
+	"bounce_events", "related_posts", "series_posts", "series", "categories", "backups", "media_variants", "media",
+	"subscriber_tags", "smms_files", "links", "subscribers", "comments", "users", "post_tags",
+	"tags", "posts", "pages", "schema_migrations",
+}
+
+// Open 加载测试配置，连接数据库并迁移到最新版本，测试结束时关闭连接
+func Open(t testing.TB) *gorm.DB {
+	t.Helper()
+	dir := t.TempDir()
+	config := fmt.Sprintf("db_driver: %s\ndsn: %q\nmigrate_on_startup: false\n", driver, dsn(t, dir))
+	path := filepath.Join(dir, "conf.yaml")
+	if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := system.LoadConfiguration(path); err != nil {
+		t.Fatal(err)
+	}
+	db, err := models.InitDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	if err = db.DropTableIfExists(tablesToDrop()...).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err = models.MigrateUp(0); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func tablesToDrop() []interface{} {
+	values := make([]interface{}, len(tables))
+	for i, table := range tables {
+		values[i] = table
+	}
+	return values
+}
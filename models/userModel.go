@@ -46,9 +46,9 @@ func (user *User) FirstOrCreate() (*User, error) {
 	return user, err
 }
 
-func IsGithubIdExists(githubId string, id uint) (*User, error) {
+func GetUserByGithubId(githubId string) (*User, error) {
 	var user User
-	err := DB.First(&user, "github_login_id = ? and id != ?", githubId, id).Error
+	err := DB.First(&user, "github_login_id = ?", githubId).Error
 	return &user, err
 }
 
@@ -95,3 +95,10 @@ func ListUsers() ([]*User, error) {
 	err := DB.Find(&users, "is_admin = ?", false).Error
 	return users, err
 }
+
+// 包括管理员在内的全部用户
+func ListAllUser() ([]*User, error) {
+	var users []*User
+	err := DB.Order("id").Find(&users).Error
+	return users, err
+}
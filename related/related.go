@@ -0,0 +1,64 @@
+// Package related 根据共同标签和正文的TF-IDF相似度为每篇已发布的文章计算相关文章。
+// 文章变化后调用Refresh，后台任务合并短时间内的多次变化后重新计算，结果保存在related_posts中，文章页直接读取
+package related
+
+import (
+	"time"
+
+	"github.com/cihub/seelog"
+
+	"blog/models"
+)
+
+const (
+	Count      = 5                // 每篇文章保存的相关文章数
+	tagWeight  = 0.4              // 共同标签(Jaccard系数)的权重
+	textWeight = 0.6              // 正文TF-IDF余弦相似度的权重
+	minScore   = 0.05             // 低于该相似度的文章不作为相关文章
+	delay      = 10 * time.Second // 收到通知后等待一段时间，合并连续的修改
+)
+
+// 容量为1，计算期间再次收到的通知会在本次完成后触发一次重新计算
+var refresh = make(chan struct{}, 1)
+
+// Refresh 通知后台任务重新计算，不会阻塞；后台任务未启动时没有效果
+func Refresh() {
+	select {
+	case refresh <- struct{}{}:
+	default:
+	}
+}
+
+// Start 启动后台任务，并在启动后计算一次，覆盖迁移或导入等不经过Refresh的修改
+func Start() {
+	Refresh()
+	go func() {
+		for range refresh {
+			time.Sleep(delay)
+			if err := Run(); err != nil {
+				seelog.Error("[related]compute related posts err", err)
+			}
+		}
+	}()
+}
+
+// Run 重新计算全部已发布文章的相关文章
+func Run() error {
+	posts, err := models.ListPublishedPost("", nil)
+	if err != nil {
+		return err
+	}
+	postIds := make([]uint, len(posts))
+	for i, post := range posts {
+		postIds[i] = post.ID
+	}
+	postTags, err := models.ListTagByPostIds(postIds)
+	if err != nil {
+		return err
+	}
+	documents := make([]*document, len(posts))
+	for i, post := range posts {
+		documents[i] = newDocument(post, postTags[post.ID])
+	}
+	return models.ReplaceRelatedPosts(compute(documents))
+}
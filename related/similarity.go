@@ -0,0 +1,167 @@
+package related
+
+import (
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/russross/blackfriday"
+
+	"blog/models"
+)
+
+// 参与计算的文章
+type document struct {
+	id     uint
+	tags   map[uint]bool
+	terms  map[string]int     // 词频
+	vector map[string]float64 // 归一化的TF-IDF向量
+}
+
+// 分词时忽略的常见英文单词
+var stopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "that": true, "this": true, "with": true, "are": true,
+	"was": true, "you": true, "not": true, "but": true, "have": true, "from": true, "can": true,
+	"will": true, "its": true, "his": true, "her": true, "they": true, "all": true, "has": true,
+	"been": true, "into": true, "then": true, "than": true, "use": true, "our": true, "out": true,
+}
+
+func newDocument(post *models.Post, tags []*models.Tag) *document {
+	doc := &document{
+		id:    post.ID,
+		tags:  make(map[uint]bool, len(tags)),
+		terms: make(map[string]int),
+	}
+	for _, tag := range tags {
+		doc.tags[tag.ID] = true
+	}
+	for _, term := range tokenize(post.Title + "\n\n" + post.Body) {
+		doc.terms[term]++
+	}
+	return doc
+}
+
+// 将Markdown转为纯文本后分词：英文和数字按单词切分，中日韩文字没有空格分隔，按相邻两个字切分
+func tokenize(markdown string) []string {
+	policy := bluemonday.StrictPolicy()
+	text := html.UnescapeString(policy.Sanitize(string(blackfriday.Run([]byte(markdown), blackfriday.WithNoExtensions()))))
+	var (
+		tokens []string
+		word   []rune
+		cjk    []rune
+	)
+	flushWord := func() {
+		if len(word) >= 2 && !stopWords[string(word)] {
+			tokens = append(tokens, string(word))
+		}
+		word = word[:0]
+	}
+	flushCjk := func() {
+		if len(cjk) == 1 {
+			tokens = append(tokens, string(cjk))
+		}
+		for i := 0; i+1 < len(cjk); i++ {
+			tokens = append(tokens, string(cjk[i:i+2]))
+		}
+		cjk = cjk[:0]
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCjk()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushCjk()
+		}
+	}
+	flushWord()
+	flushCjk()
+	return tokens
+}
+
+// 计算每篇文章的TF-IDF向量，再按标签和正文的加权相似度为每篇文章选出最多Count篇相关文章
+func compute(documents []*document) []*models.RelatedPost {
+	df := make(map[string]int)
+	for _, doc := range documents {
+		for term := range doc.terms {
+			df[term]++
+		}
+	}
+	type posting struct {
+		doc    int
+		weight float64
+	}
+	postings := make(map[string][]posting)
+	n := float64(len(documents))
+	for i, doc := range documents {
+		doc.vector = make(map[string]float64, len(doc.terms))
+		var norm float64
+		for term, count := range doc.terms {
+			// 所有文章都包含的词idf为0，不影响相似度
+			weight := (1 + math.Log(float64(count))) * math.Log(n/float64(df[term]))
+			if weight > 0 {
+				doc.vector[term] = weight
+				norm += weight * weight
+			}
+		}
+		norm = math.Sqrt(norm)
+		for term, weight := range doc.vector {
+			doc.vector[term] = weight / norm
+			postings[term] = append(postings[term], posting{i, weight / norm})
+		}
+	}
+
+	var related []*models.RelatedPost
+	for i, doc := range documents {
+		// 余弦相似度，只累加有共同词的文章
+		cosine := make([]float64, len(documents))
+		for term, weight := range doc.vector {
+			for _, p := range postings[term] {
+				cosine[p.doc] += weight * p.weight
+			}
+		}
+		var candidates []*models.RelatedPost
+		for j, other := range documents {
+			if j == i {
+				continue
+			}
+			score := textWeight*cosine[j] + tagWeight*jaccard(doc.tags, other.tags)
+			if score >= minScore {
+				candidates = append(candidates, &models.RelatedPost{PostId: doc.id, RelatedId: other.id, Score: score})
+			}
+		}
+		// 相似度相同时优先较新的文章
+		sort.Slice(candidates, func(a, b int) bool {
+			if candidates[a].Score != candidates[b].Score {
+				return candidates[a].Score > candidates[b].Score
+			}
+			return candidates[a].RelatedId > candidates[b].RelatedId
+		})
+		if len(candidates) > Count {
+			candidates = candidates[:Count]
+		}
+		related = append(related, candidates...)
+	}
+	return related
+}
+
+// 两篇文章标签集合的交集与并集之比
+func jaccard(a, b map[uint]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for tagId := range a {
+		if b[tagId] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
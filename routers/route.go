@@ -15,20 +15,23 @@ import (
 	"strings"
 )
 
-func ListTag() (tagStr string) {
-	tags, err := models.ListTag()
-	if err != nil {
+// 模板中的listTag，返回逗号分隔的已发布文章标签
+func ListTag(tags models.TagRepository) func() string {
+	return func() (tagStr string) {
+		published, err := tags.ListPublished()
+		if err != nil {
+			return
+		}
+		tagNames := make([]string, 0)
+		for _, tag := range published {
+			tagNames = append(tagNames, tag.Name)
+		}
+		tagStr = strings.Join(tagNames, ",")
 		return
 	}
-	tagNames := make([]string, 0)
-	for _, tag := range tags {
-		tagNames = append(tagNames, tag.Name)
-	}
-	tagStr = strings.Join(tagNames, ",")
-	return
 }
 
-func setTemplate(engine *gin.Engine) {
+func setTemplate(engine *gin.Engine, h *controllers.Handler) {
 
 	funcMap := template.FuncMap{
 		"dateFormat": helpers.DateFormat,
@@ -38,7 +41,9 @@ func setTemplate(engine *gin.Engine) {
 		"truncate":   helpers.Truncate,
 		"add":        helpers.Add,
 		"minus":      helpers.Minus,
-		"listTag":    ListTag,
+		"fileSize":   helpers.FileSize,
+		"repeat":     strings.Repeat,
+		"listTag":    ListTag(h.Tags),
 	}
 
 	engine.SetFuncMap(funcMap)
@@ -65,11 +70,11 @@ func setSessions(router *gin.Engine) {
 //+++++++++++++ middlewares +++++++++++++++++++++++
 
 //SharedData fills in common data, such as user info, etc...
-func SharedData() gin.HandlerFunc {
+func SharedData(users models.UserRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		session := sessions.Default(c)
-		if uID := session.Get(helpers.SessionKey); uID != nil {
-			user, err := models.GetUser(uID)
+		if uID, ok := session.Get(helpers.SessionKey).(uint); ok {
+			user, err := users.GetById(uID)
 			if err == nil {
 				c.Set(helpers.ContextUserKey, user)
 			}
@@ -110,31 +115,31 @@ func AuthRequired() gin.HandlerFunc {
 	}
 }
 
-func InitRouter() *gin.Engine {
+func InitRouter(h *controllers.Handler) *gin.Engine {
 	router := gin.Default()
 
-	setTemplate(router)
+	setTemplate(router, h)
 	setSessions(router)
-	router.Use(SharedData())
+	router.Use(SharedData(h.Users))
 	router.Static("/static", filepath.Join(helpers.GetCurrentDirectory(), "/static"))
 
 	router.NoRoute(helpers.Handle404)
-	router.GET("/", controllers.IndexGet)
-	router.GET("/index", controllers.IndexGet)
-	router.GET("/rss", controllers.RssGet)
+	router.GET("/", h.IndexGet)
+	router.GET("/index", h.IndexGet)
+	router.GET("/rss", h.RssGet)
 
 	// user
 	user := router.Group("/user")
 	if system.GetConfiguration().SignupEnabled {
 		user.GET("/register", controllers.RegisterGet)
-		user.POST("/register", controllers.RegisterPost)
+		user.POST("/register", h.RegisterPost)
 	}
 	user.GET("/login", controllers.LoginGet)
-	user.POST("/login", controllers.LoginPost)
+	user.POST("/login", h.LoginPost)
 	user.GET("/logout", controllers.LogoutGet)
 
 	// third party login
-	router.GET("/oauth2callback", controllers.Oauth2Callback)
+	router.GET("/oauth2callback", h.Oauth2Callback)
 	router.GET("/auth/:authType", controllers.AuthGet)
 
 	// captcha
@@ -143,88 +148,121 @@ func InitRouter() *gin.Engine {
 	visitor := router.Group("/visitor")
 	visitor.Use(AuthRequired())
 	{
-		visitor.POST("/new_comment", controllers.CommentPost)
-		visitor.POST("/comment/:id/delete", controllers.CommentDelete)
+		visitor.POST("/new_comment", h.CommentPost)
+		visitor.POST("/comment/:id/delete", h.CommentDelete)
 	}
 
 	// subscriber
-	router.GET("/subscribe", controllers.SubscribeGet)
-	router.POST("/subscribe", controllers.Subscribe)
-	router.GET("/active", controllers.ActiveSubscriber)
-	router.GET("/unsubscribe", controllers.UnSubscribe)
-
-	router.GET("/page/:id", controllers.PageGet)
-	router.GET("/post/:id", controllers.PostGet)
-	router.GET("/tag/:tag", controllers.TagGet)
-	router.GET("/archives/:year/:month", controllers.ArchiveGet)
-
-	router.GET("/link/:id", controllers.LinkGet)
+	router.GET("/subscribe", h.SubscribeGet)
+	router.POST("/subscribe", h.Subscribe)
+	router.GET("/active", h.ActiveSubscriber)
+	router.GET("/unsubscribe", h.UnSubscribeGet)
+	router.POST("/unsubscribe", h.UnSubscribe)
+	router.GET("/subscription", h.SubscriptionGet)
+	router.POST("/subscription", h.SubscriptionPost)
+	router.POST("/bounce/webhook", h.BounceWebhook)
+
+	router.GET("/page/:id", h.PageGet)
+	router.GET("/post/:id", h.PostGet)
+	router.GET("/tag/:tag", h.TagGet)
+	router.GET("/category/*path", h.CategoryGet)
+	router.GET("/series/:slug", h.SeriesGet)
+	router.GET("/archives/:year/:month", h.ArchiveGet)
+
+	router.GET("/link/:id", h.LinkGet)
 
 	authorized := router.Group("/admin")
 	authorized.Use(AdminScopeRequired())
 	{
 		// index
-		authorized.GET("/index", controllers.AdminIndex)
+		authorized.GET("/index", h.AdminIndex)
 
 		// image upload
-		authorized.POST("/upload", controllers.Upload)
+		authorized.POST("/upload", h.Upload)
 
 		// page
-		authorized.GET("/page", controllers.PageIndex)
-		authorized.GET("/new_page", controllers.PageNew)
-		authorized.POST("/new_page", controllers.PageCreate)
-		authorized.GET("/page/:id/edit", controllers.PageEdit)
-		authorized.POST("/page/:id/edit", controllers.PageUpdate)
-		authorized.POST("/page/:id/publish", controllers.PagePublish)
-		authorized.POST("/page/:id/delete", controllers.PageDelete)
+		authorized.GET("/page", h.PageIndex)
+		authorized.GET("/new_page", h.PageNew)
+		authorized.POST("/new_page", h.PageCreate)
+		authorized.GET("/page/:id/edit", h.PageEdit)
+		authorized.POST("/page/:id/edit", h.PageUpdate)
+		authorized.POST("/page/:id/publish", h.PagePublish)
+		authorized.POST("/page/:id/delete", h.PageDelete)
 
 		// post
-		authorized.GET("/post", controllers.PostIndex)
-		authorized.GET("/new_post", controllers.PostNew)
-		authorized.POST("/new_post", controllers.PostCreate)
-		authorized.GET("/post/:id/edit", controllers.PostEdit)
-		authorized.POST("/post/:id/edit", controllers.PostUpdate)
-		authorized.POST("/post/:id/publish", controllers.PostPublish)
-		authorized.POST("/post/:id/delete", controllers.PostDelete)
+		authorized.GET("/post", h.PostIndex)
+		authorized.GET("/new_post", h.PostNew)
+		authorized.POST("/new_post", h.PostCreate)
+		authorized.GET("/post/:id/edit", h.PostEdit)
+		authorized.POST("/post/:id/edit", h.PostUpdate)
+		authorized.POST("/post/:id/publish", h.PostPublish)
+		authorized.POST("/post/:id/delete", h.PostDelete)
 
 		// tag
-		authorized.GET("/tag", controllers.TagIndex)
-		authorized.POST("/new_tag", controllers.TagCreate)
-		authorized.POST("/tag/:id/edit", controllers.TagUpdate)
-		authorized.POST("/tag/:id/delete", controllers.TagDelete)
+		authorized.GET("/tag", h.TagIndex)
+		authorized.POST("/new_tag", h.TagCreate)
+		authorized.POST("/tag/:id/edit", h.TagUpdate)
+		authorized.POST("/tag/:id/delete", h.TagDelete)
+		authorized.POST("/tag/:id/merge", h.TagMerge)
+
+		// category
+		authorized.GET("/category", h.CategoryIndex)
+		authorized.POST("/new_category", h.CategoryCreate)
+		authorized.POST("/category/:id/edit", h.CategoryUpdate)
+		authorized.POST("/category/:id/delete", h.CategoryDelete)
+
+		// series
+		authorized.GET("/series", h.SeriesIndex)
+		authorized.POST("/new_series", h.SeriesCreate)
+		authorized.POST("/series/:id/edit", h.SeriesUpdate)
+		authorized.POST("/series/:id/delete", h.SeriesDelete)
 
 		// user
-		authorized.GET("/user", controllers.UserIndex)
-		authorized.POST("/user/:id/lock", controllers.UserLock)
+		authorized.GET("/user", h.UserIndex)
+		authorized.POST("/user/:id/lock", h.UserLock)
 
 		// profile
-		authorized.GET("/profile", controllers.ProfileGet)
-		authorized.POST("/profile", controllers.ProfileUpdate)
-		authorized.POST("/profile/email/bind", controllers.BindEmail)
-		authorized.POST("/profile/email/unbind", controllers.UnbindEmail)
-		authorized.POST("/profile/github/unbind", controllers.UnbindGithub)
+		authorized.GET("/profile", h.ProfileGet)
+		authorized.POST("/profile", h.ProfileUpdate)
+		authorized.POST("/profile/email/bind", h.BindEmail)
+		authorized.POST("/profile/email/unbind", h.UnbindEmail)
+		authorized.POST("/profile/github/unbind", h.UnbindGithub)
 
 		// subscriber
-		authorized.GET("/subscriber", controllers.SubscriberIndex)
-		authorized.POST("/subscriber", controllers.SubscriberPost)
+		authorized.GET("/subscriber", h.SubscriberIndex)
+		authorized.POST("/subscriber", h.SubscriberPost)
+		authorized.GET("/subscriber/export", h.SubscriberExport)
+		authorized.POST("/subscriber/import", h.SubscriberImport)
 
 		// link
-		authorized.GET("/link", controllers.LinkIndex)
-		authorized.POST("/new_link", controllers.LinkCreate)
-		authorized.POST("/link/:id/edit", controllers.LinkUpdate)
-		authorized.POST("/link/:id/delete", controllers.LinkDelete)
+		authorized.GET("/link", h.LinkIndex)
+		authorized.POST("/new_link", h.LinkCreate)
+		authorized.POST("/link/:id/edit", h.LinkUpdate)
+		authorized.POST("/link/:id/delete", h.LinkDelete)
 
 		// comment
-		authorized.POST("/comment/:id", controllers.CommentRead)
-		authorized.POST("/read_all", controllers.CommentReadAll)
+		authorized.POST("/comment/:id", h.CommentRead)
+		authorized.POST("/read_all", h.CommentReadAll)
 
 		// backup
+		authorized.GET("/backup", h.BackupIndex)
 		authorized.POST("/backup", controllers.BackupPost)
 		authorized.POST("/restore", controllers.RestorePost)
+		authorized.POST("/restore/confirm", controllers.RestoreConfirm)
+
+		// export
+		authorized.GET("/export", controllers.ExportGet)
+
+		// media
+		authorized.GET("/media", h.MediaIndex)
+		authorized.GET("/media/list", h.MediaList)
+		authorized.POST("/media/:id/delete", h.MediaDelete)
 
 		// mail
-		authorized.POST("/new_mail", controllers.SendMail)
-		authorized.POST("/new_batchmail", controllers.SendBatchMail)
+		authorized.POST("/new_mail", h.SendMail)
+		authorized.POST("/new_batchmail", h.SendBatchMail)
+		authorized.GET("/mail/outbox", h.MailOutbox)
+		authorized.GET("/mail/outbox/:id", controllers.MailOutboxGet)
 	}
 	return router
 }
\ No newline at end of file
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"blog/helpers"
+)
+
+const DefaultLocalDir = "static/uploads"
+
+// 保存到本地磁盘，默认目录位于static下，由/static路由直接访问；其他目录需要配置访问地址BaseUrl
+type LocalStorage struct {
+	Dir     string
+	BaseUrl string
+}
+
+func (s *LocalStorage) dir() string {
+	dir := s.Dir
+	if dir == "" {
+		dir = DefaultLocalDir
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(helpers.GetCurrentDirectory(), dir)
+	}
+	return dir
+}
+
+// 未配置访问地址时，由目录在static下的位置得到/static路由中的地址；目录不在static下时无法访问，返回错误
+func (s *LocalStorage) initBaseUrl() error {
+	if s.BaseUrl == "" {
+		static := filepath.Join(helpers.GetCurrentDirectory(), "static")
+		rel, err := filepath.Rel(static, s.dir())
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return errors.Errorf("storage_local_dir %s is outside static, storage_local_url is required", s.dir())
+		}
+		s.BaseUrl = path.Join("/static", filepath.ToSlash(rel))
+	}
+	if !strings.HasSuffix(s.BaseUrl, "/") {
+		s.BaseUrl += "/"
+	}
+	return nil
+}
+
+// 将key转为本地路径，拒绝跳出存储目录的key
+func (s *LocalStorage) path(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if cleaned == "/" || strings.Contains(key, "..") {
+		return "", errors.New("invalid key")
+	}
+	return filepath.Join(s.dir(), filepath.FromSlash(cleaned)), nil
+}
+
+func (s *LocalStorage) Put(key string, r io.Reader, size int64, contentType string) (*Object, error) {
+	fullPath, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(filepath.Dir(fullPath), os.ModePerm); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(fullPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+	written, err := io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(fullPath)
+		return nil, err
+	}
+	return &Object{Key: key, Url: s.URL(key), Size: written}, nil
+}
+
+func (s *LocalStorage) Get(key string) (io.ReadCloser, error) {
+	fullPath, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(fullPath)
+}
+
+func (s *LocalStorage) Delete(key string) error {
+	fullPath, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(fullPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *LocalStorage) URL(key string) string {
+	return s.BaseUrl + strings.TrimPrefix(key, "/")
+}
@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+
+	"blog/helpers"
+)
+
+func TestLocalStorageBaseUrl(t *testing.T) {
+	static := filepath.Join(helpers.GetCurrentDirectory(), "static")
+	tests := []struct {
+		dir     string
+		baseUrl string
+		want    string
+	}{
+		{"", "", "/static/uploads/"},
+		{"static/files", "", "/static/files/"},
+		{filepath.Join(static, "media"), "", "/static/media/"},
+		{"static", "", "/static/"},
+		{"data/uploads", "https://cdn.example.com/files", "https://cdn.example.com/files/"},
+		{"static/files", "/files/", "/files/"},
+	}
+	for _, test := range tests {
+		local := &LocalStorage{Dir: test.dir, BaseUrl: test.baseUrl}
+		if err := local.initBaseUrl(); err != nil {
+			t.Errorf("%q: %v", test.dir, err)
+			continue
+		}
+		if local.BaseUrl != test.want {
+			t.Errorf("%q: base url %s, want %s", test.dir, local.BaseUrl, test.want)
+		}
+	}
+
+	// 不在static下的目录无法通过/static访问，必须配置访问地址
+	for _, dir := range []string{"data/uploads", "../uploads", "static/../uploads", filepath.Dir(static)} {
+		if err := (&LocalStorage{Dir: dir}).initBaseUrl(); err == nil {
+			t.Errorf("%q without a base url was accepted", dir)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/qiniu/go-sdk/v7/auth/qbox"
+	qiniu "github.com/qiniu/go-sdk/v7/storage"
+)
+
+// 构造返回值字段
+type PutRet struct {
+	Hash string `json:"hash"`
+	Key  string `json:"key"`
+}
+
+type QiniuStorage struct {
+	AccessKey  string
+	SecretKey  string
+	Bucket     string
+	FileServer string
+}
+
+func (s *QiniuStorage) Put(key string, r io.Reader, size int64, contentType string) (*Object, error) {
+	var ret PutRet
+	putPolicy := qiniu.PutPolicy{
+		Scope: s.Bucket,
+	}
+	mac := qbox.NewMac(s.AccessKey, s.SecretKey)
+	token := putPolicy.UploadToken(mac)
+	uploader := qiniu.NewFormUploader(&qiniu.Config{})
+	putExtra := qiniu.PutExtra{MimeType: contentType}
+	if err := uploader.Put(context.Background(), &ret, token, key, r, size, &putExtra); err != nil {
+		return nil, err
+	}
+	return &Object{Key: ret.Key, Url: s.URL(ret.Key), Size: size}, nil
+}
+
+// 使用带签名的下载地址，私有空间同样可以读取
+func (s *QiniuStorage) Get(key string) (io.ReadCloser, error) {
+	mac := qbox.NewMac(s.AccessKey, s.SecretKey)
+	deadline := time.Now().Add(time.Hour).Unix()
+	return httpGet(qiniu.MakePrivateURLv2(mac, strings.TrimRight(s.FileServer, "/"), key, deadline))
+}
+
+func (s *QiniuStorage) Delete(key string) error {
+	mac := qbox.NewMac(s.AccessKey, s.SecretKey)
+	return qiniu.NewBucketManager(mac, &qiniu.Config{}).Delete(s.Bucket, key)
+}
+
+func (s *QiniuStorage) URL(key string) string {
+	return s.FileServer + key
+}
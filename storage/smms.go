@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"path"
+
+	"github.com/pkg/errors"
+
+	"blog/models"
+)
+
+// SM.MS图床，文件名由SM.MS生成，以返回的path作为key，删除链接记录在smms_files表中
+type SmmsStorage struct {
+	FileServer string
+}
+
+type SmmsRet struct {
+	Code string `json:"code"`
+	Data struct {
+		FileName  string `json:"filename"`
+		StoreName string `json:"storename"`
+		Size      int    `json:"size"`
+		Width     int    `json:"width"`
+		Height    int    `json:"height"`
+		Hash      string `json:"hash"`
+		Delete    string `json:"delete"`
+		Url       string `json:"url"`
+		Path      string `json:"path"`
+		Msg       string `json:"msg"`
+	} `json:"data"`
+}
+
+func (s *SmmsStorage) Put(key string, r io.Reader, size int64, contentType string) (*Object, error) {
+	var (
+		ret     SmmsRet
+		bodyBuf = &bytes.Buffer{}
+	)
+	bodyWriter := multipart.NewWriter(bodyBuf)
+	fileWriter, err := bodyWriter.CreateFormFile("smfile", path.Base(key))
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.Copy(fileWriter, r); err != nil {
+		return nil, err
+	}
+	bodyWriter.Close()
+
+	resp, err := http.Post(s.FileServer, bodyWriter.FormDataContentType(), bodyBuf)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(bodyBytes, &ret); err != nil {
+		return nil, err
+	}
+	if ret.Code == "error" {
+		return nil, errors.New(ret.Data.Msg)
+	}
+	smmsFile := models.SmmsFile{
+		FileName:  ret.Data.FileName,
+		StoreName: ret.Data.StoreName,
+		Size:      ret.Data.Size,
+		Width:     ret.Data.Width,
+		Height:    ret.Data.Height,
+		Hash:      ret.Data.Hash,
+		Delete:    ret.Data.Delete,
+		Url:       ret.Data.Url,
+		Path:      ret.Data.Path,
+	}
+	if err = smmsFile.Insert(); err != nil {
+		return nil, err
+	}
+	return &Object{Key: ret.Data.Path, Url: ret.Data.Url, Size: int64(ret.Data.Size)}, nil
+}
+
+func (s *SmmsStorage) Get(key string) (io.ReadCloser, error) {
+	smmsFile, err := models.GetSmmsFileByPath(key)
+	if err != nil {
+		return nil, err
+	}
+	return httpGet(smmsFile.Url)
+}
+
+// 通过上传时返回的删除链接删除文件
+func (s *SmmsStorage) Delete(key string) error {
+	smmsFile, err := models.GetSmmsFileByPath(key)
+	if err != nil {
+		return err
+	}
+	resp, err := http.Get(smmsFile.Delete)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return errors.New("smms delete failed: " + resp.Status)
+	}
+	return smmsFile.Remove()
+}
+
+func (s *SmmsStorage) URL(key string) string {
+	smmsFile, err := models.GetSmmsFileByPath(key)
+	if err != nil {
+		return ""
+	}
+	return smmsFile.Url
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"blog/helpers"
+	"blog/system"
+)
+
+const (
+	DriverLocal = "local" // 本地磁盘，通过/static/uploads访问
+	DriverS3    = "s3"    // S3兼容的对象存储
+	DriverQiniu = "qiniu" // 七牛云
+	DriverSmms  = "smms"  // SM.MS图床
+)
+
+// 已保存的文件
+type Object struct {
+	Key  string // 文件在存储中的标识
+	Url  string // 访问地址
+	Size int64  // 文件大小
+}
+
+// 文件存储
+type Storage interface {
+	// 保存文件，key为建议的文件标识，实际标识以返回的Object.Key为准
+	Put(key string, r io.Reader, size int64, contentType string) (*Object, error)
+	// 读取文件，调用方负责关闭
+	Get(key string) (io.ReadCloser, error)
+	// 删除文件
+	Delete(key string) error
+	// 生成文件的访问地址
+	URL(key string) string
+}
+
+var (
+	storage Storage
+	driver  string
+)
+
+// 根据配置初始化上传文件的存储
+func InitStorage() (err error) {
+	driver = system.GetConfiguration().StorageDriver
+	if driver == "" {
+		driver = DriverLocal
+	}
+	storage, err = NewStorage(driver)
+	return
+}
+
+func GetStorage() Storage {
+	return storage
+}
+
+// 当前使用的存储驱动
+func GetDriver() string {
+	return driver
+}
+
+// 创建指定驱动的存储，为空时使用本地磁盘
+func NewStorage(driver string) (Storage, error) {
+	c := system.GetConfiguration()
+	switch driver {
+	case "", DriverLocal:
+		local := &LocalStorage{Dir: c.StorageLocalDir, BaseUrl: c.StorageLocalUrl}
+		if err := local.initBaseUrl(); err != nil {
+			return nil, err
+		}
+		return local, nil
+	case DriverS3:
+		return &S3Storage{
+			Endpoint:  c.S3Endpoint,
+			Region:    c.S3Region,
+			Bucket:    c.S3Bucket,
+			AccessKey: c.S3AccessKey,
+			SecretKey: c.S3SecretKey,
+			PublicUrl: c.S3PublicUrl,
+		}, nil
+	case DriverQiniu:
+		return &QiniuStorage{
+			AccessKey:  c.QiniuAccessKey,
+			SecretKey:  c.QiniuSecretKey,
+			Bucket:     c.QiniuBucket,
+			FileServer: c.QiniuFileServer,
+		}, nil
+	case DriverSmms:
+		return &SmmsStorage{FileServer: c.SmmsFileServer}, nil
+	}
+	return nil, fmt.Errorf("unknown storage driver %s", driver)
+}
+
+// 根据扩展名生成按年月归档的文件标识，如2021/09/xxx.png
+func NewKey(ext string) string {
+	return path.Join(helpers.GetCurrentTime().Format("2006/01"), helpers.UUID()+strings.ToLower(ext))
+}
+
+// 衍生文件的标识，如2021/09/xxx_thumb.webp
+func VariantKey(key, name, ext string) string {
+	key = strings.TrimSuffix(key, path.Ext(key))
+	if name != "" {
+		key += "_" + name
+	}
+	return key + ext
+}
+
+// 通过http下载文件，非2xx响应视为失败
+func httpGet(url string) (io.ReadCloser, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("get %s: %s", url, resp.Status)
+	}
+	return resp.Body, nil
+}
@@ -7,35 +7,75 @@ import (
 )
 
 type Configuration struct {
-	SignupEnabled      bool   `yaml:"signup_enabled"`  // signup enabled or not
-	QiniuAccessKey     string `yaml:"qiniu_accesskey"` // qiniu
-	QiniuSecretKey     string `yaml:"qiniu_secretkey"`
-	QiniuFileServer    string `yaml:"qiniu_fileserver"`
-	QiniuBucket        string `yaml:"qiniu_bucket"`
-	GithubClientId     string `yaml:"github_clientid"` // github
-	GithubClientSecret string `yaml:"github_clientsecret"`
-	GithubAuthUrl      string `yaml:"github_authurl"`
-	GithubRedirectURL  string `yaml:"github_redirecturl"`
-	GithubTokenUrl     string `yaml:"github_tokenurl"`
-	GithubScope        string `yaml:"github_scope"`
-	SmtpUsername       string `yaml:"smtp_username"`  // username
-	SmtpPassword       string `yaml:"smtp_password"`  //password
-	SmtpHost           string `yaml:"smtp_host"`      //host
-	SessionSecret      string `yaml:"session_secret"` //session_secret
-	Domain             string `yaml:"domain"`         //domain
-	Public             string `yaml:"public"`         //public
-	Addr               string `yaml:"addr"`           //addr
-	BackupKey          string `yaml:"backup_key"`     //backup_key
-	DSN                string `yaml:"dsn"`            //database dsn
-	NotifyEmails       string `yaml:"notify_emails"`  //notify_emails
-	PageSize           int    `yaml:"page_size"`      //page_size
-	SmmsFileServer     string `yaml:"smms_fileserver"`
+	SignupEnabled       bool     `yaml:"signup_enabled"`  // signup enabled or not
+	QiniuAccessKey      string   `yaml:"qiniu_accesskey"` // qiniu
+	QiniuSecretKey      string   `yaml:"qiniu_secretkey"`
+	QiniuFileServer     string   `yaml:"qiniu_fileserver"`
+	QiniuBucket         string   `yaml:"qiniu_bucket"`
+	GithubClientId      string   `yaml:"github_clientid"` // github
+	GithubClientSecret  string   `yaml:"github_clientsecret"`
+	GithubAuthUrl       string   `yaml:"github_authurl"`
+	GithubRedirectURL   string   `yaml:"github_redirecturl"`
+	GithubTokenUrl      string   `yaml:"github_tokenurl"`
+	GithubScope         string   `yaml:"github_scope"`
+	SmtpUsername        string   `yaml:"smtp_username"`        // username
+	SmtpPassword        string   `yaml:"smtp_password"`        //password
+	SmtpHost            string   `yaml:"smtp_host"`            //host
+	MailTransport       string   `yaml:"mail_transport"`       //smtp, file or memory
+	MailDir             string   `yaml:"mail_dir"`             //directory of .eml files for file transport
+	BounceMaildir       string   `yaml:"bounce_maildir"`       //maildir receiving bounce messages
+	BounceWebhookToken  string   `yaml:"bounce_webhook_token"` //token of bounce webhook, empty to disable
+	BounceLimit         int      `yaml:"bounce_limit"`         //hard bounces before unsubscribing
+	SessionSecret       string   `yaml:"session_secret"`       //session_secret
+	Domain              string   `yaml:"domain"`               //domain
+	Public              string   `yaml:"public"`               //public
+	Addr                string   `yaml:"addr"`                 //addr
+	BackupKey           string   `yaml:"backup_key"`           //backup_key
+	BackupDestinations  []string `yaml:"backup_destinations"`  //local, s3, qiniu
+	BackupDir           string   `yaml:"backup_dir"`           //directory of local backups
+	BackupSchedule      string   `yaml:"backup_schedule"`      //e.g. 1d@03:00, off to disable
+	BackupKeepDaily     int      `yaml:"backup_keep_daily"`    //retention, keep the latest backup of N days
+	BackupKeepWeekly    int      `yaml:"backup_keep_weekly"`   //N weeks
+	BackupKeepMonthly   int      `yaml:"backup_keep_monthly"`  //N months
+	Mysqldump           string   `yaml:"mysqldump"`            //path of mysqldump for mysql backups
+	PgDump              string   `yaml:"pg_dump"`              // path of pg_dump for postgres backups
+	DbDriver            string   `yaml:"db_driver"`            // sqlite3, mysql或postgres
+	DSN                 string   `yaml:"dsn"`                  //database dsn
+	MigrateOnStartup    bool     `yaml:"migrate_on_startup"`   // 启动时执行未执行的数据库迁移，默认开启
+	NotifyEmails        string   `yaml:"notify_emails"`        //notify_emails
+	PageSize            int      `yaml:"page_size"`            //page_size
+	AdminPageSize       int      `yaml:"admin_page_size"`      //page size of admin lists
+	MaxPageSize         int      `yaml:"max_page_size"`        //upper bound of page_size requested by clients
+	SmmsFileServer      string   `yaml:"smms_fileserver"`
+	StorageDriver       string   `yaml:"storage_driver"`    //local, s3, qiniu or smms
+	StorageLocalDir     string   `yaml:"storage_local_dir"` //directory of local storage
+	StorageLocalUrl     string   `yaml:"storage_local_url"` //url prefix of local storage, required when storage_local_dir is outside static
+	S3Endpoint          string   `yaml:"s3_endpoint"`       // s3
+	S3Region            string   `yaml:"s3_region"`
+	S3Bucket            string   `yaml:"s3_bucket"`
+	S3AccessKey         string   `yaml:"s3_accesskey"`
+	S3SecretKey         string   `yaml:"s3_secretkey"`
+	S3PublicUrl         string   `yaml:"s3_publicurl"`
+	ImageMaxWidth       int      `yaml:"image_max_width"`       //wider images are downscaled
+	ImageThumbnailWidth int      `yaml:"image_thumbnail_width"` //width of thumbnails
+	ImageWebpEncoder    string   `yaml:"image_webp_encoder"`    //path of cwebp, empty to disable webp
+	ImageMaxPixels      int      `yaml:"image_max_pixels"`      //max width*height of jpeg/png uploads, checked before decoding
+	UploadMaxSize       int64    `yaml:"upload_max_size"`       //max size of a single upload in MB
+	UploadAllowedTypes  []string `yaml:"upload_allowed_types"`  //allowed mime types, detected from content
+	UploadUserQuota     int64    `yaml:"upload_user_quota"`     //total upload size per user in MB, 0 for unlimited
 }
 
 const (
-	DefaultPageSize = 10
+	DefaultPageSize      = 10
+	DefaultAdminPageSize = 20
+	DefaultMaxPageSize   = 100
+	DefaultBounceLimit   = 1
+	DefaultUploadMaxSize = 10
 )
 
+// 默认允许上传的文件类型
+var DefaultUploadAllowedTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp", "application/pdf"}
+
 var configuration *Configuration
 
 func LoadConfiguration(path string) error {
@@ -43,7 +83,7 @@ func LoadConfiguration(path string) error {
 	if err != nil {
 		return err
 	}
-	var config Configuration
+	config := Configuration{MigrateOnStartup: true}
 	err = yaml.Unmarshal(data, &config)
 	if err != nil {
 		return err
@@ -51,6 +91,21 @@ func LoadConfiguration(path string) error {
 	if config.PageSize <= 0 {
 		config.PageSize = DefaultPageSize
 	}
+	if config.AdminPageSize <= 0 {
+		config.AdminPageSize = DefaultAdminPageSize
+	}
+	if config.MaxPageSize <= 0 {
+		config.MaxPageSize = DefaultMaxPageSize
+	}
+	if config.BounceLimit <= 0 {
+		config.BounceLimit = DefaultBounceLimit
+	}
+	if config.UploadMaxSize <= 0 {
+		config.UploadMaxSize = DefaultUploadMaxSize
+	}
+	if len(config.UploadAllowedTypes) == 0 {
+		config.UploadAllowedTypes = DefaultUploadAllowedTypes
+	}
 	configuration = &config
 	return err
 }